@@ -1,15 +1,58 @@
 package telosairduetcommon
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 )
 
+const (
+	KEY_OPC_SAMPLE_FLOW_RATE = "opc_sfr"
+	KEY_OPC_SAMPLING_PERIOD  = "opc_period"
+)
+
 type AlphasenseOpcN3Measurement struct {
 	PM1, PM2p5, PM10 float32
 	Temp, Rh         float32
 	Bins             [24]float32
+
+	SampleFlowRate float32 // ml/s
+	SamplingPeriod float32 // s
+	flowSet        bool
+}
+
+/*
+Read the OPC-N3 block as the firmware packs it, all little endian float32s:
+temperature, RH, PM1, PM2.5, PM10, then the 24 histogram bins.
+*/
+func (m *AlphasenseOpcN3Measurement) PopulateFromBytesReader(reader io.Reader) error {
+	for _, p := range []*float32{&m.Temp, &m.Rh, &m.PM1, &m.PM2p5, &m.PM10} {
+		if err := binary.Read(reader, binary.LittleEndian, p); err != nil {
+			return fmt.Errorf("error converting bytes to float: %w", err)
+		}
+	}
+	for i := range m.Bins {
+		if err := binary.Read(reader, binary.LittleEndian, &m.Bins[i]); err != nil {
+			return fmt.Errorf("error converting bytes to float (for OPCN3 bin #%d): %w", i, err)
+		}
+	}
+	return nil
+}
+
+/*
+Read the sample flow rate and sampling period, little endian float32s, sent by newer firmware.
+*/
+func (m *AlphasenseOpcN3Measurement) PopulateFlowFromBytesReader(reader io.Reader) error {
+	if err := binary.Read(reader, binary.LittleEndian, &m.SampleFlowRate); err != nil {
+		return fmt.Errorf("error converting bytes to float (for OPCN3 flow rate): %w", err)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &m.SamplingPeriod); err != nil {
+		return fmt.Errorf("error converting bytes to float (for OPCN3 sampling period): %w", err)
+	}
+	m.flowSet = true
+	return nil
 }
 
 func (m *AlphasenseOpcN3Measurement) PopulateBinsFromString(s string) error {
@@ -35,13 +78,18 @@ func (m AlphasenseOpcN3Measurement) DirectoryName() string {
 }
 
 func (m AlphasenseOpcN3Measurement) DirectoryData() map[string]float32 {
-	return map[string]float32{
+	ret := map[string]float32{
 		"PM1":   m.PM1,
 		"PM2.5": m.PM2p5,
 		"PM10":  m.PM10,
 		"TEMP":  m.Temp,
 		"RH":    m.Rh,
 	}
+	if m.flowSet {
+		ret["SFR"] = m.SampleFlowRate
+		ret["PERIOD"] = m.SamplingPeriod
+	}
+	return ret
 }
 
 func (m AlphasenseOpcN3Measurement) String() string {
@@ -56,6 +104,14 @@ func (m AlphasenseOpcN3Measurement) ToMapPm(suff string) map[string]any {
 	}
 }
 
+func (m AlphasenseOpcN3Measurement) FieldSpecsPm(suff string) []FieldSpec {
+	return []FieldSpec{
+		rangedField("pm10"+suff, "float32", UNIT_UG_M3, 0, 2000, "OPC-N3 PM1"),
+		rangedField("pm25"+suff, "float32", UNIT_UG_M3, 0, 2000, "OPC-N3 PM2.5"),
+		rangedField("pm100"+suff, "float32", UNIT_UG_M3, 0, 2000, "OPC-N3 PM10"),
+	}
+}
+
 func (m AlphasenseOpcN3Measurement) ToMapTempRh() map[string]any {
 	return map[string]any{
 		"temp_opcn3": m.Temp,
@@ -63,6 +119,13 @@ func (m AlphasenseOpcN3Measurement) ToMapTempRh() map[string]any {
 	}
 }
 
+func (m AlphasenseOpcN3Measurement) FieldSpecsTempRh() []FieldSpec {
+	return []FieldSpec{
+		rangedField("temp_opcn3", "float32", UNIT_CELSIUS, -40, 125, "OPC-N3 internal temperature"),
+		rangedField("hum_opcn3", "float32", UNIT_PERCENT_RH, 0, 100, "OPC-N3 internal relative humidity"),
+	}
+}
+
 func (m AlphasenseOpcN3Measurement) ToMapBins() map[string]any {
 	ret := map[string]any{}
 	for i, v := range m.Bins {
@@ -71,3 +134,31 @@ func (m AlphasenseOpcN3Measurement) ToMapBins() map[string]any {
 
 	return ret
 }
+
+func (m AlphasenseOpcN3Measurement) FieldSpecsBins() []FieldSpec {
+	ret := make([]FieldSpec, len(m.Bins))
+	for i := range m.Bins {
+		ret[i] = field(fmt.Sprintf("opc_bin%d", i), "float32", "", fmt.Sprintf("OPC-N3 bin %d count", i))
+	}
+	return ret
+}
+
+func (m AlphasenseOpcN3Measurement) ToMapFlow() map[string]any {
+	if !m.flowSet {
+		return nil
+	}
+	return map[string]any{
+		KEY_OPC_SAMPLE_FLOW_RATE: m.SampleFlowRate,
+		KEY_OPC_SAMPLING_PERIOD:  m.SamplingPeriod,
+	}
+}
+
+/*
+Optional, only in samples that carried flow info.
+*/
+func (m AlphasenseOpcN3Measurement) FieldSpecsFlow() []FieldSpec {
+	return optionalFields([]FieldSpec{
+		field(KEY_OPC_SAMPLE_FLOW_RATE, "float32", UNIT_ML_S, "OPC-N3 sample flow rate"),
+		field(KEY_OPC_SAMPLING_PERIOD, "float32", UNIT_SECONDS, "OPC-N3 sampling period"),
+	})
+}
@@ -0,0 +1,221 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+/* ~~ Per-Device Calibration Profiles ~~ */
+
+const (
+	KEY_CALIBRATION_VERSION = "cal_version"
+
+	CALIBRATION_FORMAT_VERSION = 1
+
+	CAL_CHANNEL_PM25 = "pm25"
+	CAL_CHANNEL_TEMP = "temp"
+	CAL_CHANNEL_HUM  = "hum"
+	CAL_CHANNEL_CO2  = "co2"
+)
+
+// `ToMap()` keys each named channel corrects. Any other channel name is taken to be a `ToMap()` key itself.
+var calibrationChannelKeys = map[string][]string{
+	CAL_CHANNEL_PM25: {"pm25_m", "pm25_t", "pm25_b"},
+	CAL_CHANNEL_TEMP: {KEY_TEMP},
+	CAL_CHANNEL_HUM:  {KEY_HUM},
+	CAL_CHANNEL_CO2:  {KEY_SCD_CO2, KEY_SCD_CO2_LEGACY},
+}
+
+/*
+corrected = raw * Slope + Offset + TempCoeff * temp + HumCoeff * hum. A zero Slope is treated as 1.
+The temperature & humidity terms come from multi-linear colocation fits, see colocation.go.
+*/
+type ChannelCorrection struct {
+	Slope     float64 `json:"slope"`
+	Offset    float64 `json:"offset"`
+	TempCoeff float64 `json:"temp_coeff,omitempty"`
+	HumCoeff  float64 `json:"hum_coeff,omitempty"`
+}
+
+/*
+Apply the slope & offset only.
+*/
+func (c ChannelCorrection) Apply(raw float64) float64 {
+	slope := c.Slope
+	if slope == 0 {
+		slope = 1
+	}
+	return raw*slope + c.Offset
+}
+
+/*
+Apply the full correction using the sample's (uncorrected) temperature & humidity.
+*/
+func (c ChannelCorrection) ApplyWith(raw, tempC, hum float64) float64 {
+	v := c.Apply(raw)
+	if c.TempCoeff != 0 {
+		v += c.TempCoeff * tempC
+	}
+	if c.HumCoeff != 0 {
+		v += c.HumCoeff * hum
+	}
+	return v
+}
+
+/*
+Corrections for one device over a period of time, e.g. from one colocation campaign.
+*/
+type CalibrationProfile struct {
+	SerialNumber uint16 `json:"serial_number"`
+	Version      string `json:"version"`
+	// Unix seconds. ValidTo of 0 means open-ended.
+	ValidFrom uint32                       `json:"valid_from"`
+	ValidTo   uint32                       `json:"valid_to,omitempty"`
+	Channels  map[string]ChannelCorrection `json:"channels"`
+}
+
+func (p CalibrationProfile) ValidAt(unixSec uint32) bool {
+	return unixSec >= p.ValidFrom && (p.ValidTo == 0 || unixSec < p.ValidTo)
+}
+
+func (p CalibrationProfile) validate() error {
+	if p.Version == "" {
+		return fmt.Errorf("profile for device %d has no version", p.SerialNumber)
+	}
+	if p.ValidTo != 0 && p.ValidTo <= p.ValidFrom {
+		return fmt.Errorf("profile %q for device %d ends (%d) before it starts (%d)", p.Version, p.SerialNumber, p.ValidTo, p.ValidFrom)
+	}
+	return nil
+}
+
+/*
+On-disk format:
+
+	{"format_version": 1, "profiles": [{"serial_number": 12, "version": "2024-06-colo", "valid_from": 1717200000,
+		"channels": {"pm25": {"slope": 0.52, "offset": 1.1}, "temp": {"slope": 1, "offset": -1.8}}}]}
+*/
+type CalibrationProfileFile struct {
+	FormatVersion int                  `json:"format_version"`
+	Profiles      []CalibrationProfile `json:"profiles"`
+}
+
+func ReadCalibrationProfiles(r io.Reader) ([]CalibrationProfile, error) {
+	var f CalibrationProfileFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to decode calibration profiles: %w", err)
+	}
+	if f.FormatVersion != CALIBRATION_FORMAT_VERSION {
+		return nil, fmt.Errorf("unsupported calibration profile format version %d", f.FormatVersion)
+	}
+	for _, p := range f.Profiles {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return f.Profiles, nil
+}
+
+func WriteCalibrationProfiles(w io.Writer, profiles []CalibrationProfile) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(CalibrationProfileFile{FormatVersion: CALIBRATION_FORMAT_VERSION, Profiles: profiles})
+}
+
+/*
+Calibration profiles keyed by device serial. Safe for concurrent use.
+*/
+type CalibrationStore struct {
+	mu       sync.RWMutex
+	profiles map[uint16][]CalibrationProfile
+}
+
+func NewCalibrationStore() *CalibrationStore {
+	return &CalibrationStore{profiles: map[uint16][]CalibrationProfile{}}
+}
+
+func (s *CalibrationStore) Add(p CalibrationProfile) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.profiles == nil {
+		s.profiles = map[uint16][]CalibrationProfile{}
+	}
+	ps := s.profiles[p.SerialNumber]
+	// Replace a profile with the same version
+	for i := range ps {
+		if ps[i].Version == p.Version {
+			ps = append(ps[:i], ps[i+1:]...)
+			break
+		}
+	}
+	ps = append(ps, p)
+	sort.Slice(ps, func(i, j int) bool { return ps[i].ValidFrom < ps[j].ValidFrom })
+	s.profiles[p.SerialNumber] = ps
+	return nil
+}
+
+/*
+Add every profile from a file in the CalibrationProfileFile format.
+*/
+func (s *CalibrationStore) Load(r io.Reader) error {
+	profiles, err := ReadCalibrationProfiles(r)
+	if err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		if err := s.Add(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+The profile in effect for a device at a time. Where profiles overlap, the one that started most recently wins.
+*/
+func (s *CalibrationStore) Active(serialNumber uint16, unixSec uint32) (CalibrationProfile, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ps := s.profiles[serialNumber]
+	for i := len(ps) - 1; i >= 0; i-- {
+		if ps[i].ValidAt(unixSec) {
+			return ps[i], true
+		}
+	}
+	return CalibrationProfile{}, false
+}
+
+/*
+Apply the sample's active profile to its `ToMap()` result: corrected values replace the originals, which are kept
+under `<key>_raw`, and the profile version is added. Returns false if no profile applies.
+*/
+func (s *CalibrationStore) ApplyToMap(d DuetData, m map[string]any) (CalibrationProfile, bool) {
+	p, ok := s.Active(d.GetSerialNumber(), d.Timestamp())
+	if !ok {
+		return p, false
+	}
+	// Covariates before any of them are corrected
+	tempC, _ := mapFloat(m, KEY_TEMP)
+	hum, _ := mapFloat(m, KEY_HUM)
+	for channel, c := range p.Channels {
+		keys, ok := calibrationChannelKeys[channel]
+		if !ok {
+			keys = []string{channel}
+		}
+		for _, k := range keys {
+			raw, ok := mapFloat(m, k)
+			if !ok {
+				continue
+			}
+			m[k+KEY_SUFFIX_RAW] = raw
+			m[k] = c.ApplyWith(raw, tempC, hum)
+		}
+	}
+	m[KEY_CALIBRATION_VERSION] = p.Version
+	return p, true
+}
@@ -0,0 +1,199 @@
+package telosairduetcommon
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCalibrationStoreActive(t *testing.T) {
+	s := NewCalibrationStore()
+	for _, p := range []CalibrationProfile{
+		{SerialNumber: 7, Version: "v1", ValidFrom: 1000, ValidTo: 2000},
+		{SerialNumber: 7, Version: "v2", ValidFrom: 1500},
+		{SerialNumber: 8, Version: "other", ValidFrom: 0},
+	} {
+		if err := s.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, td := range []struct {
+		unix    uint32
+		version string
+	}{
+		{500, ""},
+		{1000, "v1"},
+		{1499, "v1"},
+		// Overlapping, the later start wins
+		{1500, "v2"},
+		{1999, "v2"},
+		{5000, "v2"},
+	} {
+		p, ok := s.Active(7, td.unix)
+		if ok != (td.version != "") || p.Version != td.version {
+			t.Errorf("Active(7, %d) = %q, %v; want %q", td.unix, p.Version, ok, td.version)
+		}
+	}
+
+	// Same version replaces
+	if err := s.Add(CalibrationProfile{SerialNumber: 7, Version: "v2", ValidFrom: 3000}); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := s.Active(7, 1600); p.Version != "v1" {
+		t.Errorf("expected v1 once v2 moved to 3000, got %q", p.Version)
+	}
+
+	for _, bad := range []CalibrationProfile{
+		{SerialNumber: 7, ValidFrom: 1000},
+		{SerialNumber: 7, Version: "v3", ValidFrom: 2000, ValidTo: 1000},
+	} {
+		if err := s.Add(bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestCalibrationProfileFile(t *testing.T) {
+	var buf bytes.Buffer
+	in := []CalibrationProfile{{SerialNumber: 7, Version: "v1", ValidFrom: 1000, Channels: map[string]ChannelCorrection{
+		CAL_CHANNEL_PM25: {Slope: 0.5, Offset: 1},
+	}}}
+	if err := WriteCalibrationProfiles(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	s := NewCalibrationStore()
+	if err := s.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := s.Active(7, 1000); !ok || p.Channels[CAL_CHANNEL_PM25].Slope != 0.5 {
+		t.Errorf("unexpected profile after a round trip: %+v", p)
+	}
+
+	if err := s.Load(bytes.NewBufferString(`{"format_version": 2, "profiles": []}`)); err == nil {
+		t.Error("expected an unsupported format version to be rejected")
+	}
+}
+
+func calibrationTestStore(t *testing.T) *CalibrationStore {
+	s := NewCalibrationStore()
+	err := s.Add(CalibrationProfile{SerialNumber: 7, Version: "2024-06-colo", ValidFrom: 1000, Channels: map[string]ChannelCorrection{
+		CAL_CHANNEL_PM25: {Slope: 0.5, Offset: 1},
+		// Against the uncorrected humidity
+		CAL_CHANNEL_TEMP: {Slope: 1, Offset: -1, HumCoeff: -0.02},
+		CAL_CHANNEL_CO2:  {Offset: 20},
+		"pn10_m":         {Slope: 2},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func calibrationTestSample() *DuetDataMk4Var7 {
+	return &DuetDataMk4Var7{
+		SerialNumber: 7, UnixSec: 2000,
+		Sps:    Sps30Measurement{PM2p5: 10, PN1: 30},
+		Scd:    Scd41Measurement{Co2: 600},
+		TempRh: CombinedTempRhMeasurements{Temp: 20, Hum: 50},
+		Mprls:  MprlsMeasurement{Pressure: 101.325},
+	}
+}
+
+func TestCalibrationStoreApplyToMap(t *testing.T) {
+	s := calibrationTestStore(t)
+	d := calibrationTestSample()
+	m := d.ToMap("")
+	if _, ok := s.ApplyToMap(d, m); !ok {
+		t.Fatal("expected the profile to apply")
+	}
+	for k, want := range map[string]float64{
+		"pm25_m": 6, "pm25_m" + KEY_SUFFIX_RAW: 10,
+		"pm25_t": 6, "pm25_b": 6,
+		KEY_TEMP: 18, KEY_TEMP + KEY_SUFFIX_RAW: 20,
+		KEY_SCD_CO2: 620, KEY_SCD_CO2_LEGACY: 620, KEY_SCD_CO2 + KEY_SUFFIX_RAW: 600,
+		"pn10_m": 60,
+		KEY_HUM:  50,
+	} {
+		if v, ok := mapFloat(m, k); !ok || v != want {
+			t.Errorf("%s = %v; want %v", k, m[k], want)
+		}
+	}
+	if _, ok := m[KEY_HUM+KEY_SUFFIX_RAW]; ok {
+		t.Error("an uncorrected channel must not get a raw copy")
+	}
+	if m[KEY_CALIBRATION_VERSION] != "2024-06-colo" {
+		t.Errorf("%s = %v", KEY_CALIBRATION_VERSION, m[KEY_CALIBRATION_VERSION])
+	}
+
+	d.UnixSec = 999
+	m = d.ToMap("")
+	if _, ok := s.ApplyToMap(d, m); ok {
+		t.Error("expected no profile before it starts")
+	}
+	if _, ok := m[KEY_CALIBRATION_VERSION]; ok {
+		t.Error("unexpected calibration version without a profile")
+	}
+}
+
+/*
+Directory output must carry the same corrected & converted values as the map.
+*/
+func TestWriteDuetDataToDirWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	d := calibrationTestSample()
+	opts := ToMapOptions{Calibrations: calibrationTestStore(t), GasUnits: GasUnitMass, GasStandardConditions: true, DerivedMeteorology: true}
+	if err := WriteDuetDataToDirWithOptions(d, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	m := ToMapWithOptions(d, "", opts)
+
+	read := func(name string) string {
+		b, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+		}
+		return string(b)
+	}
+	for file, key := range map[string]string{
+		"pms5003/pm2p5":                        "pm25_m",
+		"pms5003/pm2p5" + KEY_SUFFIX_RAW:       "pm25_m" + KEY_SUFFIX_RAW,
+		"pms5003/pn1":                          "pn10_m",
+		"combined_temp_rh/temperature":         KEY_TEMP,
+		"combined_temp_rh/temperature_raw":     KEY_TEMP + KEY_SUFFIX_RAW,
+		"combined_temp_rh/humidity":            KEY_HUM,
+		"scd41/co2":                            KEY_SCD_CO2,
+		"scd41/co2" + KEY_SUFFIX_RAW:           KEY_SCD_CO2 + KEY_SUFFIX_RAW,
+		"derived_meteorology/" + KEY_DEW_POINT: KEY_DEW_POINT,
+	} {
+		v, _ := mapFloat(m, key)
+		if got, want := read(file), fmt.Sprintf("%v\n", float32(v)); got != want {
+			t.Errorf("%s = %q; the map has %q", file, got, want)
+		}
+	}
+	// 620 ppm of CO2 is 1115 mg/m³ at 25°C
+	if co2 := read("scd41/co2"); co2 != "1115.272\n" {
+		t.Errorf("scd41/co2 = %q", co2)
+	}
+	if v := read(KEY_CALIBRATION_VERSION); v != "2024-06-colo\n" {
+		t.Errorf("%s = %q", KEY_CALIBRATION_VERSION, v)
+	}
+	if v := read(KEY_GAS_UNITS); v != "mass\n" {
+		t.Errorf("%s = %q", KEY_GAS_UNITS, v)
+	}
+
+	// Without options the output is unchanged
+	plain := t.TempDir()
+	if err := WriteDuetDataToDirWithOptions(d, plain, ToMapOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path.Join(plain, "pms5003/pm2p5")); string(b) != "10\n" {
+		t.Errorf("uncalibrated pm2p5 = %q", b)
+	}
+	for _, name := range []string{"pms5003/pm2p5_raw", KEY_CALIBRATION_VERSION, KEY_GAS_UNITS} {
+		if _, err := os.Stat(path.Join(plain, name)); err == nil {
+			t.Errorf("unexpected %s without options", name)
+		}
+	}
+}
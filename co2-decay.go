@@ -0,0 +1,159 @@
+package telosairduetcommon
+
+import (
+	"errors"
+	"math"
+)
+
+/* ~~ CO2 Decay ~~ */
+
+const DEFAULT_OUTDOOR_CO2_PPM = 420.0
+
+// Defaults for finding CO2 rises & decays, see FindCo2Decays()
+const (
+	// A decay must start this far above outdoor (and a rise climb this far) to be worth fitting
+	DEFAULT_CO2_MIN_EVENT_PPM = 100.0
+	// Movement against the trend tolerated within a run; the SCD41 repeats to ±10 ppm
+	DEFAULT_CO2_NOISE_PPM = 15.0
+	// Fewer points give unstable fits
+	DEFAULT_CO2_MIN_EVENT_POINTS = 5
+	// Samples further apart, in seconds, are not joined into one run
+	DEFAULT_CO2_MAX_GAP_SEC = 15 * 60
+)
+
+type Co2Point struct {
+	UnixSec uint32
+	Ppm     float64
+}
+
+/*
+Result of fitting C(t) = Cout + (C0 - Cout) * exp(-λt) to a falling CO2 series. With no occupants or other sources,
+λ is the room's outdoor air change rate.
+*/
+type Co2DecayFit struct {
+	Start, End   uint32
+	N            int
+	StartPpm     float64
+	AirChangesPH float64 // λ, per hour
+	R2           float64 // of ln(C - Cout) against time
+}
+
+var ErrNoCo2Decay = errors.New("no usable co2 decay")
+
+/*
+Fit an exponential decay towards the outdoor concentration by linear regression of ln(C - Cout) on time.
+Points at or below the outdoor concentration are skipped.
+*/
+func FitCo2Decay(points []Co2Point, outdoorPpm float64) (Co2DecayFit, error) {
+	var fit Co2DecayFit
+	var xs, ys []float64
+	for _, p := range points {
+		if p.Ppm <= outdoorPpm {
+			continue
+		}
+		if len(xs) == 0 {
+			fit.Start, fit.StartPpm = p.UnixSec, p.Ppm
+		}
+		xs = append(xs, float64(p.UnixSec-fit.Start)/3600)
+		ys = append(ys, math.Log(p.Ppm-outdoorPpm))
+		fit.End = p.UnixSec
+	}
+	fit.N = len(xs)
+	if fit.N < 3 || fit.End == fit.Start {
+		return fit, ErrNoCo2Decay
+	}
+
+	n := float64(fit.N)
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return fit, ErrNoCo2Decay
+	}
+	slope := (n*sxy - sx*sy) / den
+	intercept := (sy - slope*sx) / n
+	if slope >= 0 {
+		return fit, ErrNoCo2Decay
+	}
+	fit.AirChangesPH = -slope
+
+	meanY := sy / n
+	var ssRes, ssTot float64
+	for i := range xs {
+		e := ys[i] - (intercept + slope*xs[i])
+		ssRes += e * e
+		ssTot += (ys[i] - meanY) * (ys[i] - meanY)
+	}
+	if ssTot > 0 {
+		fit.R2 = 1 - ssRes/ssTot
+	}
+	return fit, nil
+}
+
+/*
+Split a time-ordered CO2 series into decay periods: runs that fall (allowing rises of up to noisePpm) for at least
+minPoints samples, starting at least minRisePpm above outdoor. Runs are broken by gaps longer than maxGapSec.
+*/
+func FindCo2Decays(points []Co2Point, outdoorPpm, minRisePpm, noisePpm float64, minPoints int, maxGapSec uint32) [][]Co2Point {
+	var ret [][]Co2Point
+	for _, run := range co2Trends(points, -1, noisePpm, maxGapSec) {
+		if len(run) >= minPoints && run[0].Ppm-outdoorPpm >= minRisePpm {
+			ret = append(ret, run)
+		}
+	}
+	return ret
+}
+
+/*
+Split a time-ordered CO2 series into build-ups: runs that rise (allowing falls of up to noisePpm) by at least
+minRisePpm over at least minPoints samples. Runs are broken by gaps longer than maxGapSec.
+*/
+func FindCo2Rises(points []Co2Point, minRisePpm, noisePpm float64, minPoints int, maxGapSec uint32) [][]Co2Point {
+	var ret [][]Co2Point
+	for _, run := range co2Trends(points, 1, noisePpm, maxGapSec) {
+		if len(run) >= minPoints && run[len(run)-1].Ppm-run[0].Ppm >= minRisePpm {
+			ret = append(ret, run)
+		}
+	}
+	return ret
+}
+
+/*
+Runs trending in the direction of sign (1 rising, -1 falling). A run ends when a point moves back more than noisePpm
+past the furthest point so far, and starts at the last point before the trend begins.
+*/
+func co2Trends(points []Co2Point, sign, noisePpm float64, maxGapSec uint32) [][]Co2Point {
+	var ret [][]Co2Point
+	var run []Co2Point
+	furthest := math.Inf(-1)
+
+	flush := func() {
+		// Start from the turning point, not a plateau before it
+		for len(run) > 1 && sign*run[1].Ppm <= sign*run[0].Ppm {
+			run = run[1:]
+		}
+		if len(run) > 1 {
+			ret = append(ret, run)
+		}
+		run = nil
+		furthest = math.Inf(-1)
+	}
+
+	for _, p := range points {
+		if len(run) > 0 {
+			last := run[len(run)-1]
+			if p.UnixSec-last.UnixSec > maxGapSec || sign*p.Ppm < furthest-noisePpm {
+				flush()
+			}
+		}
+		run = append(run, p)
+		furthest = math.Max(furthest, sign*p.Ppm)
+	}
+	flush()
+	return ret
+}
@@ -0,0 +1,220 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+/* ~~ CO2 Ventilation & Occupancy ~~ */
+
+const (
+	CO2_EVENT_RISE  = "rise"
+	CO2_EVENT_DECAY = "decay"
+)
+
+// CO2 exhaled by a seated adult, L/s
+const DEFAULT_CO2_GENERATION_LPS = 0.0052
+
+type Co2VentilationConfig struct {
+	RoomVolumeM3  float64 `json:"room_volume_m3"`
+	OutdoorCo2Ppm float64 `json:"outdoor_co2_ppm"`
+	// Per occupant, L/s
+	Co2GenerationLps float64 `json:"co2_generation_lps"`
+	// Used for occupancy until a decay has been fitted. 0 for none.
+	AssumedAirChangesPH float64 `json:"assumed_ach,omitempty"`
+	// Time above each is reported
+	ThresholdsPpm []float64 `json:"thresholds_ppm"`
+
+	// Event detection, 0 for the DEFAULT_CO2_* value
+	MinEventPpm   float64 `json:"min_event_ppm"`
+	NoisePpm      float64 `json:"noise_ppm"`
+	MinEventPoint int     `json:"min_event_points"`
+	// Samples further apart than this, in seconds, are not joined into events or counted towards time above thresholds
+	MaxGapSec uint32 `json:"max_gap_s"`
+	// Decay fits with a poorer R² are not used for the air change rate
+	MinDecayR2 float64 `json:"min_decay_r2"`
+}
+
+func NewCo2VentilationConfig(roomVolumeM3 float64) Co2VentilationConfig {
+	return Co2VentilationConfig{
+		RoomVolumeM3:     roomVolumeM3,
+		OutdoorCo2Ppm:    DEFAULT_OUTDOOR_CO2_PPM,
+		Co2GenerationLps: DEFAULT_CO2_GENERATION_LPS,
+		ThresholdsPpm:    []float64{800, 1000, 1400},
+		MinEventPpm:      DEFAULT_CO2_MIN_EVENT_PPM,
+		NoisePpm:         DEFAULT_CO2_NOISE_PPM,
+		MinEventPoint:    DEFAULT_CO2_MIN_EVENT_POINTS,
+		MaxGapSec:        DEFAULT_CO2_MAX_GAP_SEC,
+		MinDecayR2:       0.8,
+	}
+}
+
+func (c Co2VentilationConfig) validate() error {
+	if c.RoomVolumeM3 <= 0 {
+		return fmt.Errorf("invalid room volume %f m3", c.RoomVolumeM3)
+	}
+	if c.Co2GenerationLps <= 0 {
+		return fmt.Errorf("invalid co2 generation rate %f L/s", c.Co2GenerationLps)
+	}
+	return nil
+}
+
+func (c Co2VentilationConfig) withEventDefaults() Co2VentilationConfig {
+	if c.MinEventPpm == 0 {
+		c.MinEventPpm = DEFAULT_CO2_MIN_EVENT_PPM
+	}
+	if c.NoisePpm == 0 {
+		c.NoisePpm = DEFAULT_CO2_NOISE_PPM
+	}
+	if c.MinEventPoint == 0 {
+		c.MinEventPoint = DEFAULT_CO2_MIN_EVENT_POINTS
+	}
+	if c.MaxGapSec == 0 {
+		c.MaxGapSec = DEFAULT_CO2_MAX_GAP_SEC
+	}
+	return c
+}
+
+type Co2Event struct {
+	Kind       string // CO2_EVENT_RISE or CO2_EVENT_DECAY
+	Start, End uint32
+	StartPpm   float64
+	EndPpm     float64
+	// Decays only, nil if the fit failed
+	Fit *Co2DecayFit
+}
+
+type OccupancyEstimate struct {
+	UnixSec uint32
+	Co2Ppm  float64
+	People  float64
+}
+
+type Co2VentilationReport struct {
+	SerialNumber uint16
+	Start, End   uint32
+	Events       []Co2Event
+	// Median of the decays' fits, 0 if none were usable
+	AirChangesPH float64
+	// Outdoor air flow implied by AirChangesPH, m³/h
+	OutdoorAirM3h float64
+	Occupancy     []OccupancyEstimate
+	// Seconds spent above each threshold
+	TimeAbove map[float64]uint32
+	// Seconds covered by samples, for reading TimeAbove as a fraction
+	Covered uint32
+}
+
+/*
+Collects CO2 readings per device and reports ventilation and occupancy. Safe for concurrent use.
+*/
+type Co2Analyzer struct {
+	Config Co2VentilationConfig
+
+	mu     sync.Mutex
+	points map[uint16][]Co2Point
+}
+
+func NewCo2Analyzer(config Co2VentilationConfig) (*Co2Analyzer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &Co2Analyzer{Config: config, points: map[uint16][]Co2Point{}}, nil
+}
+
+/*
+Add a sample's CO2 reading. Returns false if the sample has none.
+*/
+func (a *Co2Analyzer) Add(d DuetData) bool {
+	co2, ok := SampleCo2(d)
+	if !ok || co2 == 0 {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.points == nil {
+		a.points = map[uint16][]Co2Point{}
+	}
+	a.points[d.GetSerialNumber()] = append(a.points[d.GetSerialNumber()], Co2Point{d.Timestamp(), float64(co2)})
+	return true
+}
+
+func (a *Co2Analyzer) Report(serialNumber uint16) Co2VentilationReport {
+	a.mu.Lock()
+	points := append([]Co2Point(nil), a.points[serialNumber]...)
+	a.mu.Unlock()
+	sort.Slice(points, func(i, j int) bool { return points[i].UnixSec < points[j].UnixSec })
+	return AnalyzeCo2(serialNumber, points, a.Config)
+}
+
+/*
+Ventilation and occupancy over a time-ordered CO2 series.
+
+Occupancy is from the mass balance V·dC/dt = N·G − Q·(C − Cout), with Q the outdoor air flow from the fitted (or
+assumed) air change rate. It is only estimated when an air change rate is known.
+*/
+func AnalyzeCo2(serialNumber uint16, points []Co2Point, c Co2VentilationConfig) Co2VentilationReport {
+	r := Co2VentilationReport{SerialNumber: serialNumber, TimeAbove: map[float64]uint32{}}
+	if len(points) == 0 {
+		return r
+	}
+	r.Start, r.End = points[0].UnixSec, points[len(points)-1].UnixSec
+	outdoor := c.OutdoorCo2Ppm
+	if outdoor <= 0 {
+		outdoor = DEFAULT_OUTDOOR_CO2_PPM
+	}
+	c = c.withEventDefaults()
+
+	for _, run := range FindCo2Rises(points, c.MinEventPpm, c.NoisePpm, c.MinEventPoint, c.MaxGapSec) {
+		r.Events = append(r.Events, newCo2Event(CO2_EVENT_RISE, run))
+	}
+	var rates []float64
+	for _, run := range FindCo2Decays(points, outdoor, c.MinEventPpm, c.NoisePpm, c.MinEventPoint, c.MaxGapSec) {
+		e := newCo2Event(CO2_EVENT_DECAY, run)
+		if fit, err := FitCo2Decay(run, outdoor); err == nil {
+			e.Fit = &fit
+			if fit.R2 >= c.MinDecayR2 {
+				rates = append(rates, fit.AirChangesPH)
+			}
+		}
+		r.Events = append(r.Events, e)
+	}
+	sort.Slice(r.Events, func(i, j int) bool { return r.Events[i].Start < r.Events[j].Start })
+
+	ach := c.AssumedAirChangesPH
+	if len(rates) > 0 {
+		r.AirChangesPH = median(rates)
+		ach = r.AirChangesPH
+	}
+	r.OutdoorAirM3h = r.AirChangesPH * c.RoomVolumeM3
+
+	genM3h := c.Co2GenerationLps * 3.6
+	for i := 1; i < len(points); i++ {
+		prev, p := points[i-1], points[i]
+		dt := p.UnixSec - prev.UnixSec
+		if dt == 0 || dt > c.MaxGapSec {
+			continue
+		}
+		r.Covered += dt
+		for _, t := range c.ThresholdsPpm {
+			if prev.Ppm > t {
+				r.TimeAbove[t] += dt
+			}
+		}
+		if ach <= 0 {
+			continue
+		}
+		dCdt := (p.Ppm - prev.Ppm) / (float64(dt) / 3600) * 1e-6
+		mean := (p.Ppm+prev.Ppm)/2 - outdoor
+		people := c.RoomVolumeM3 * (dCdt + ach*mean*1e-6) / genM3h
+		r.Occupancy = append(r.Occupancy, OccupancyEstimate{UnixSec: p.UnixSec, Co2Ppm: p.Ppm, People: math.Max(people, 0)})
+	}
+	return r
+}
+
+func newCo2Event(kind string, run []Co2Point) Co2Event {
+	first, last := run[0], run[len(run)-1]
+	return Co2Event{Kind: kind, Start: first.UnixSec, End: last.UnixSec, StartPpm: first.Ppm, EndPpm: last.Ppm}
+}
@@ -0,0 +1,135 @@
+package telosairduetcommon
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCo2AnalyzerAdd(t *testing.T) {
+	for _, bad := range []Co2VentilationConfig{NewCo2VentilationConfig(0), {RoomVolumeM3: 50}} {
+		if _, err := NewCo2Analyzer(bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+
+	a, err := NewCo2Analyzer(NewCo2VentilationConfig(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Out of order, Report sorts them
+	for _, td := range []struct {
+		d  DuetData
+		ok bool
+	}{
+		{&DuetDataMk4Var7{SerialNumber: 7, UnixSec: 1060, Scd: Scd41Measurement{Co2: 650}}, true},
+		{&DuetDataMk4Var7{SerialNumber: 7, UnixSec: 1000, Scd: Scd41Measurement{Co2: 600}}, true},
+		{&DuetDataMk4Var7{SerialNumber: 7, UnixSec: 1120}, false},
+		// The Plantower's CO2 counts too
+		{&DuetDataMk1Var0{SerialNumber: 8, UnixSec: 1000, Co2: PlantowerCo2Measurement{Co2: 900}}, true},
+		{&DuetDataMk1Var2{SerialNumber: 9, UnixSec: 1000}, false},
+	} {
+		if ok := a.Add(td.d); ok != td.ok {
+			t.Errorf("Add(%T %d) = %v; want %v", td.d, td.d.GetSerialNumber(), ok, td.ok)
+		}
+	}
+
+	r := a.Report(7)
+	if r.Start != 1000 || r.End != 1060 || r.Covered != 60 || r.TimeAbove[800] != 0 {
+		t.Errorf("unexpected report: %+v", r)
+	}
+	if r := a.Report(8); r.Start != 1000 || r.End != 1000 {
+		t.Errorf("unexpected Plantower report: %+v", r)
+	}
+	if r := a.Report(9); r.Start != 0 || len(r.Events) != 0 {
+		t.Errorf("expected an empty report, got %+v", r)
+	}
+}
+
+func TestAnalyzeCo2TimeAbove(t *testing.T) {
+	points := []Co2Point{{0, 900}, {60, 1100}, {120, 700}, {180, 1500}, {180 + DEFAULT_CO2_MAX_GAP_SEC + 1, 1500}}
+	r := AnalyzeCo2(7, points, NewCo2VentilationConfig(50))
+	// Each interval counts at its starting value; the one over the gap not at all
+	for threshold, want := range map[float64]uint32{800: 120, 1000: 60, 1400: 0} {
+		if r.TimeAbove[threshold] != want {
+			t.Errorf("time above %.0f ppm = %d s; want %d", threshold, r.TimeAbove[threshold], want)
+		}
+	}
+	if r.Covered != 180 {
+		t.Errorf("covered %d s; want 180", r.Covered)
+	}
+	if len(r.Occupancy) != 0 {
+		t.Error("expected no occupancy without an air change rate")
+	}
+}
+
+func TestAnalyzeCo2ZeroEventConfig(t *testing.T) {
+	points := []Co2Point{{0, 900}, {60, 1100}, {120, 700}, {180, 1500}, {180 + DEFAULT_CO2_MAX_GAP_SEC + 1, 1500}}
+	c := Co2VentilationConfig{RoomVolumeM3: 50, Co2GenerationLps: DEFAULT_CO2_GENERATION_LPS, ThresholdsPpm: []float64{800}}
+	if _, err := NewCo2Analyzer(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Zero gap and event settings fall back to the defaults rather than dropping every interval
+	r := AnalyzeCo2(7, points, c)
+	if r.Covered != 180 || r.TimeAbove[800] != 120 {
+		t.Errorf("covered %d s, %d s above 800 ppm; want 180 and 120", r.Covered, r.TimeAbove[800])
+	}
+	if len(r.Events) != 0 {
+		t.Errorf("expected no events from %d points, got %+v", len(points), r.Events)
+	}
+}
+
+func TestAnalyzeCo2RiseAndDecay(t *testing.T) {
+	c := NewCo2VentilationConfig(100)
+	var points []Co2Point
+	for i := 0; i < 10; i++ {
+		points = append(points, Co2Point{uint32(i * 60), DEFAULT_OUTDOOR_CO2_PPM})
+	}
+	// Occupied: up 50 ppm a minute to 1420
+	for i := 1; i <= 20; i++ {
+		points = append(points, Co2Point{uint32(540 + i*60), DEFAULT_OUTDOOR_CO2_PPM + float64(i)*50})
+	}
+	// Emptied, decaying at 2 air changes an hour
+	points = append(points, syntheticCo2Decay(1740, 40, 60, 1000, 2)[1:]...)
+
+	r := AnalyzeCo2(7, points, c)
+	if len(r.Events) != 2 || r.Events[0].Kind != CO2_EVENT_RISE || r.Events[1].Kind != CO2_EVENT_DECAY {
+		t.Fatalf("unexpected events: %+v", r.Events)
+	}
+	if rise := r.Events[0]; rise.StartPpm > DEFAULT_OUTDOOR_CO2_PPM+50 || rise.EndPpm != DEFAULT_OUTDOOR_CO2_PPM+1000 || rise.Fit != nil {
+		t.Errorf("unexpected rise: %+v", rise)
+	}
+	if decay := r.Events[1]; decay.Fit == nil || math.Abs(decay.Fit.AirChangesPH-2) > 1e-6 || decay.Fit.R2 < 0.999 {
+		t.Errorf("unexpected decay: %+v, fit %+v", decay, decay.Fit)
+	}
+	if math.Abs(r.AirChangesPH-2) > 1e-6 || math.Abs(r.OutdoorAirM3h-200) > 1e-4 {
+		t.Errorf("ACH %f, outdoor air %f m³/h; want 2, 200", r.AirChangesPH, r.OutdoorAirM3h)
+	}
+
+	// Nobody in while it decays
+	for _, o := range r.Occupancy {
+		if o.UnixSec > 1740 && o.People > 0.1 {
+			t.Errorf("%d people at %d during the decay", int(math.Round(o.People)), o.UnixSec)
+			break
+		}
+	}
+}
+
+func TestAnalyzeCo2SteadyOccupancy(t *testing.T) {
+	c := NewCo2VentilationConfig(100)
+	c.AssumedAirChangesPH = 1
+	// Two people at 1 ACH hold the room 374.4 ppm above outdoors
+	steady := DEFAULT_OUTDOOR_CO2_PPM + 2*DEFAULT_CO2_GENERATION_LPS*3.6/(100*1)*1e6
+	var points []Co2Point
+	for i := 0; i < 10; i++ {
+		points = append(points, Co2Point{uint32(i * 60), steady})
+	}
+	r := AnalyzeCo2(7, points, c)
+	if r.AirChangesPH != 0 || len(r.Occupancy) != 9 {
+		t.Fatalf("ACH %f, %d occupancy estimates", r.AirChangesPH, len(r.Occupancy))
+	}
+	for _, o := range r.Occupancy {
+		if math.Abs(o.People-2) > 1e-9 {
+			t.Errorf("%f people at %d; want 2", o.People, o.UnixSec)
+		}
+	}
+}
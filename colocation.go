@@ -0,0 +1,457 @@
+package telosairduetcommon
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* ~~ Colocation Calibration Fitting ~~ */
+
+/*
+One reading from a reference instrument. Pollutant is a calibration channel name, e.g. CAL_CHANNEL_PM25.
+*/
+type ReferenceSample struct {
+	UnixSec   uint32
+	Pollutant string
+	Value     float64
+}
+
+var referencePollutantAliases = map[string]string{
+	"pm2.5": CAL_CHANNEL_PM25, "pm25": CAL_CHANNEL_PM25, "pm2_5": CAL_CHANNEL_PM25,
+	"temp": CAL_CHANNEL_TEMP, "temperature": CAL_CHANNEL_TEMP,
+	"hum": CAL_CHANNEL_HUM, "rh": CAL_CHANNEL_HUM, "humidity": CAL_CHANNEL_HUM,
+	"co2": CAL_CHANNEL_CO2,
+}
+
+func normalizePollutant(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, ok := referencePollutantAliases[s]; ok {
+		return v
+	}
+	return s
+}
+
+func parseReferenceTime(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if v, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(v), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return uint32(t.Unix()), nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognised timestamp %q", s)
+}
+
+/*
+Read a reference CSV with columns timestamp, pollutant, value. Timestamps are unix seconds or RFC3339
+(times without a zone are UTC). A header row is skipped if present.
+*/
+func ReadReferenceCSV(r io.Reader) ([]ReferenceSample, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+
+	var ret []ReferenceSample
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reference csv: %w", err)
+		}
+		t, err := parseReferenceTime(rec[0])
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(rec[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to convert value %q to float64", line, rec[2])
+		}
+		ret = append(ret, ReferenceSample{UnixSec: t, Pollutant: normalizePollutant(rec[1]), Value: v})
+	}
+	return ret, nil
+}
+
+/*
+One aggregation window with both device and reference data for a channel.
+*/
+type ColocationPair struct {
+	WindowStart uint32
+	Device      float64
+	Reference   float64
+	Temp, Hum   float64 // device means over the window
+}
+
+type windowMean struct {
+	sum float64
+	n   int
+}
+
+func (w *windowMean) add(v float64) {
+	w.sum += v
+	w.n++
+}
+func (w windowMean) mean() float64 {
+	return w.sum / float64(w.n)
+}
+
+type colocationWindow struct {
+	device, reference map[string]*windowMean
+	temp, hum         windowMean
+}
+
+/*
+Collects one device's samples and a reference instrument's readings, averaging both over fixed windows aligned to
+multiples of Window seconds.
+*/
+type Colocation struct {
+	SerialNumber uint16
+	Window       uint32
+	// Windows with fewer device samples than this are ignored.
+	MinSamples int
+
+	windows map[uint32]*colocationWindow
+}
+
+func NewColocation(serialNumber uint16, window time.Duration) *Colocation {
+	return &Colocation{
+		SerialNumber: serialNumber,
+		Window:       uint32(window / time.Second),
+		MinSamples:   1,
+		windows:      map[uint32]*colocationWindow{},
+	}
+}
+
+func (c *Colocation) window(unixSec uint32) *colocationWindow {
+	w := c.Window
+	if w == 0 {
+		w = 3600
+	}
+	start := unixSec - unixSec%w
+	if c.windows == nil {
+		c.windows = map[uint32]*colocationWindow{}
+	}
+	cw, ok := c.windows[start]
+	if !ok {
+		cw = &colocationWindow{device: map[string]*windowMean{}, reference: map[string]*windowMean{}}
+		c.windows[start] = cw
+	}
+	return cw
+}
+
+/*
+Add a device sample. Samples from other devices or without a resolved time are ignored; returns whether it was used.
+*/
+func (c *Colocation) AddSample(d DuetData) bool {
+	if d.GetSerialNumber() != c.SerialNumber || !d.TimeResolved() {
+		return false
+	}
+	m := d.ToMap("")
+	cw := c.window(d.Timestamp())
+	for channel, keys := range calibrationChannelKeys {
+		for _, k := range keys {
+			if v, ok := mapFloat(m, k); ok {
+				if cw.device[channel] == nil {
+					cw.device[channel] = &windowMean{}
+				}
+				cw.device[channel].add(v)
+				break
+			}
+		}
+	}
+	if t, ok := mapFloat(m, KEY_TEMP); ok {
+		cw.temp.add(t)
+	}
+	if h, ok := mapFloat(m, KEY_HUM); ok {
+		cw.hum.add(h)
+	}
+	return true
+}
+
+func (c *Colocation) AddReference(r ReferenceSample) {
+	cw := c.window(r.UnixSec)
+	p := normalizePollutant(r.Pollutant)
+	if cw.reference[p] == nil {
+		cw.reference[p] = &windowMean{}
+	}
+	cw.reference[p].add(r.Value)
+}
+
+/*
+Windows with both device and reference data for the channel, oldest first.
+*/
+func (c *Colocation) Pairs(channel string) []ColocationPair {
+	var ret []ColocationPair
+	for start, cw := range c.windows {
+		dev, ref := cw.device[channel], cw.reference[channel]
+		if dev == nil || ref == nil || dev.n < max(c.MinSamples, 1) {
+			continue
+		}
+		p := ColocationPair{WindowStart: start, Device: dev.mean(), Reference: ref.mean(), Temp: math.NaN(), Hum: math.NaN()}
+		if cw.temp.n > 0 {
+			p.Temp = cw.temp.mean()
+		}
+		if cw.hum.n > 0 {
+			p.Hum = cw.hum.mean()
+		}
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].WindowStart < ret[j].WindowStart })
+	return ret
+}
+
+/* ~~ Regression ~~ */
+
+type FitMethod int
+
+const (
+	FitLinear      FitMethod = iota // reference = slope*device + offset, least squares
+	FitMultiLinear                  // adds temperature & humidity terms
+	FitRobust                       // linear, Huber-weighted to limit the pull of outliers
+)
+
+func (m FitMethod) String() string {
+	switch m {
+	case FitMultiLinear:
+		return "multilinear"
+	case FitRobust:
+		return "robust"
+	default:
+		return "linear"
+	}
+}
+
+type FitResult struct {
+	Channel string
+	Method  FitMethod
+	N       int
+
+	Correction ChannelCorrection
+
+	// Of the corrected device values against the reference
+	R2   float64
+	RMSE float64
+	Bias float64 // mean of corrected - reference
+}
+
+var ErrTooFewPairs = errors.New("too few colocated windows to fit")
+
+func Fit(channel string, pairs []ColocationPair, method FitMethod) (FitResult, error) {
+	ret := FitResult{Channel: channel, Method: method}
+	var coeffs []float64
+	var err error
+
+	switch method {
+	case FitMultiLinear:
+		// Windows without temperature & humidity can't be used
+		var usable []ColocationPair
+		for _, p := range pairs {
+			if !math.IsNaN(p.Temp) && !math.IsNaN(p.Hum) {
+				usable = append(usable, p)
+			}
+		}
+		pairs = usable
+		coeffs, err = leastSquares(pairs, true, nil)
+	case FitRobust:
+		coeffs, err = huberFit(pairs)
+	default:
+		coeffs, err = leastSquares(pairs, false, nil)
+	}
+	if err != nil {
+		return ret, err
+	}
+
+	ret.N = len(pairs)
+	ret.Correction = ChannelCorrection{Slope: coeffs[0], Offset: coeffs[1]}
+	if len(coeffs) == 4 {
+		ret.Correction.TempCoeff, ret.Correction.HumCoeff = coeffs[2], coeffs[3]
+	}
+	ret.R2, ret.RMSE, ret.Bias = fitMetrics(pairs, ret.Correction)
+	return ret, nil
+}
+
+func fitRow(p ColocationPair, multi bool) []float64 {
+	if multi {
+		return []float64{p.Device, 1, p.Temp, p.Hum}
+	}
+	return []float64{p.Device, 1}
+}
+
+/*
+Weighted least squares via the normal equations. Coefficients are slope, offset[, temp, hum].
+*/
+func leastSquares(pairs []ColocationPair, multi bool, weights []float64) ([]float64, error) {
+	k := 2
+	if multi {
+		k = 4
+	}
+	if len(pairs) < k+1 {
+		return nil, ErrTooFewPairs
+	}
+	ata := make([][]float64, k)
+	for i := range ata {
+		ata[i] = make([]float64, k+1)
+	}
+	for n, p := range pairs {
+		w := 1.0
+		if weights != nil {
+			w = weights[n]
+		}
+		row := fitRow(p, multi)
+		for i := 0; i < k; i++ {
+			for j := 0; j < k; j++ {
+				ata[i][j] += w * row[i] * row[j]
+			}
+			ata[i][k] += w * row[i] * p.Reference
+		}
+	}
+	return solveLinearSystem(ata)
+}
+
+/*
+Gaussian elimination with partial pivoting on an augmented k x (k+1) matrix.
+*/
+func solveLinearSystem(a [][]float64) ([]float64, error) {
+	k := len(a)
+	for col := 0; col < k; col++ {
+		pivot := col
+		for r := col + 1; r < k; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, errors.New("fit is degenerate: device values don't vary enough")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := col + 1; r < k; r++ {
+			f := a[r][col] / a[col][col]
+			for c := col; c <= k; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+		}
+	}
+	x := make([]float64, k)
+	for r := k - 1; r >= 0; r-- {
+		s := a[r][k]
+		for c := r + 1; c < k; c++ {
+			s -= a[r][c] * x[c]
+		}
+		x[r] = s / a[r][r]
+	}
+	return x, nil
+}
+
+/*
+Huber regression by iteratively reweighted least squares, with the usual tuning constant of 1.345 robust standard deviations.
+*/
+func huberFit(pairs []ColocationPair) ([]float64, error) {
+	const huberK = 1.345
+	coeffs, err := leastSquares(pairs, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	weights := make([]float64, len(pairs))
+	resid := make([]float64, len(pairs))
+	for iter := 0; iter < 50; iter++ {
+		for i, p := range pairs {
+			resid[i] = math.Abs(p.Reference - (coeffs[0]*p.Device + coeffs[1]))
+		}
+		// Scale from the median absolute deviation
+		scale := median(resid) / 0.6745
+		if scale < 1e-9 {
+			break
+		}
+		for i, r := range resid {
+			if u := r / scale; u <= huberK {
+				weights[i] = 1
+			} else {
+				weights[i] = huberK / u
+			}
+		}
+		next, err := leastSquares(pairs, false, weights)
+		if err != nil {
+			return nil, err
+		}
+		converged := math.Abs(next[0]-coeffs[0]) < 1e-9 && math.Abs(next[1]-coeffs[1]) < 1e-9
+		coeffs = next
+		if converged {
+			break
+		}
+	}
+	return coeffs, nil
+}
+
+func fitMetrics(pairs []ColocationPair, c ChannelCorrection) (r2, rmse, bias float64) {
+	n := float64(len(pairs))
+	meanRef := 0.0
+	for _, p := range pairs {
+		meanRef += p.Reference
+	}
+	meanRef /= n
+
+	var ssRes, ssTot, sumErr float64
+	for _, p := range pairs {
+		e := c.ApplyWith(p.Device, p.Temp, p.Hum) - p.Reference
+		ssRes += e * e
+		sumErr += e
+		ssTot += (p.Reference - meanRef) * (p.Reference - meanRef)
+	}
+	if ssTot > 0 {
+		r2 = 1 - ssRes/ssTot
+	}
+	return r2, math.Sqrt(ssRes / n), sumErr / n
+}
+
+/*
+Fit every channel with colocated data and build a profile for the device. The profile holds every channel that could
+be fit; the error reports any that couldn't, and the profile is unusable if it has no channels.
+*/
+func (c *Colocation) Profile(version string, validFrom, validTo uint32, method FitMethod) (CalibrationProfile, map[string]FitResult, error) {
+	p := CalibrationProfile{
+		SerialNumber: c.SerialNumber,
+		Version:      version,
+		ValidFrom:    validFrom,
+		ValidTo:      validTo,
+		Channels:     map[string]ChannelCorrection{},
+	}
+	results := map[string]FitResult{}
+	var errs []error
+	for channel := range calibrationChannelKeys {
+		pairs := c.Pairs(channel)
+		if len(pairs) == 0 {
+			continue
+		}
+		m := method
+		if m == FitMultiLinear && (channel == CAL_CHANNEL_TEMP || channel == CAL_CHANNEL_HUM) {
+			// Their own covariates; a multi-linear fit would be degenerate
+			m = FitLinear
+		}
+		res, err := Fit(channel, pairs, m)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to fit %s: %w", channel, err))
+			continue
+		}
+		results[channel] = res
+		p.Channels[channel] = res.Correction
+	}
+	if len(p.Channels) == 0 {
+		errs = append(errs, fmt.Errorf("no channel of device %d could be fit", c.SerialNumber))
+	} else if err := p.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return p, results, errors.Join(errs...)
+}
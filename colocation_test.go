@@ -0,0 +1,145 @@
+package telosairduetcommon
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func colocationTestPairs(devices []float64, reference func(device, temp, hum float64) float64) []ColocationPair {
+	ret := make([]ColocationPair, len(devices))
+	for i, dev := range devices {
+		// Temperature & humidity that vary independently of the device value & each other
+		temp, hum := 15+float64(i%3)*5, 40+float64(i%4)*10
+		ret[i] = ColocationPair{WindowStart: uint32(i * 3600), Device: dev, Reference: reference(dev, temp, hum), Temp: temp, Hum: hum}
+	}
+	return ret
+}
+
+func checkFitCoefficient(t *testing.T, name string, got, want, epsilon float64) {
+	t.Helper()
+	if math.Abs(got-want) > epsilon {
+		t.Errorf("%s = %f; want %f", name, got, want)
+	}
+}
+
+func TestFitLinear(t *testing.T) {
+	pairs := colocationTestPairs([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, func(dev, _, _ float64) float64 { return 0.5*dev + 2 })
+	res, err := Fit(CAL_CHANNEL_PM25, pairs, FitLinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFitCoefficient(t, "slope", res.Correction.Slope, 0.5, 1e-9)
+	checkFitCoefficient(t, "offset", res.Correction.Offset, 2, 1e-9)
+	checkFitCoefficient(t, "R2", res.R2, 1, 1e-9)
+	checkFitCoefficient(t, "RMSE", res.RMSE, 0, 1e-9)
+	if res.N != 10 || res.Correction.TempCoeff != 0 || res.Correction.HumCoeff != 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	// Not an exact fit: slope 0.5, offset 1 by hand, residuals -0.5, 1, -0.5
+	pairs = []ColocationPair{{Device: 1, Reference: 1}, {Device: 2, Reference: 3}, {Device: 3, Reference: 2}}
+	res, err = Fit(CAL_CHANNEL_PM25, pairs, FitLinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFitCoefficient(t, "slope", res.Correction.Slope, 0.5, 1e-9)
+	checkFitCoefficient(t, "offset", res.Correction.Offset, 1, 1e-9)
+	checkFitCoefficient(t, "R2", res.R2, 0.25, 1e-9)
+	checkFitCoefficient(t, "RMSE", res.RMSE, math.Sqrt(0.5), 1e-9)
+	checkFitCoefficient(t, "bias", res.Bias, 0, 1e-9)
+}
+
+func TestFitMultiLinear(t *testing.T) {
+	pairs := colocationTestPairs([]float64{3, 8, 1, 12, 6, 9, 2, 15, 4, 11, 7, 5}, func(dev, temp, hum float64) float64 {
+		return 0.8*dev + 1 + 0.1*temp - 0.05*hum
+	})
+	// Windows without temperature & humidity are left out
+	pairs = append(pairs, ColocationPair{Device: 20, Reference: 1000, Temp: math.NaN(), Hum: 50})
+	res, err := Fit(CAL_CHANNEL_PM25, pairs, FitMultiLinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := res.Correction
+	checkFitCoefficient(t, "slope", c.Slope, 0.8, 1e-9)
+	checkFitCoefficient(t, "offset", c.Offset, 1, 1e-9)
+	checkFitCoefficient(t, "temp coeff", c.TempCoeff, 0.1, 1e-9)
+	checkFitCoefficient(t, "hum coeff", c.HumCoeff, -0.05, 1e-9)
+	checkFitCoefficient(t, "RMSE", res.RMSE, 0, 1e-9)
+	if res.N != 12 {
+		t.Errorf("fit %d windows; want 12", res.N)
+	}
+}
+
+func TestFitRobust(t *testing.T) {
+	pairs := colocationTestPairs([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, func(dev, _, _ float64) float64 {
+		// Small alternating noise around 2x + 1
+		return 2*dev + 1 + 0.1*math.Cos(math.Pi*dev)
+	})
+	pairs[11].Reference = 200
+
+	ols, err := Fit(CAL_CHANNEL_PM25, pairs, FitLinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	robust, err := Fit(CAL_CHANNEL_PM25, pairs, FitRobust)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(ols.Correction.Slope-2) < 1 {
+		t.Errorf("expected the outlier to pull least squares, slope %f", ols.Correction.Slope)
+	}
+	checkFitCoefficient(t, "robust slope", robust.Correction.Slope, 2, 0.1)
+	checkFitCoefficient(t, "robust offset", robust.Correction.Offset, 1, 0.5)
+
+	// Without outliers, the same as least squares
+	exact := colocationTestPairs([]float64{1, 2, 3, 4, 5}, func(dev, _, _ float64) float64 { return 3*dev - 1 })
+	if res, err := Fit(CAL_CHANNEL_PM25, exact, FitRobust); err != nil || math.Abs(res.Correction.Slope-3) > 1e-9 || math.Abs(res.Correction.Offset+1) > 1e-9 {
+		t.Errorf("robust fit of exact data: %+v, %v", res.Correction, err)
+	}
+}
+
+func TestFitDegenerate(t *testing.T) {
+	constant := colocationTestPairs([]float64{5, 5, 5, 5, 5, 5}, func(dev, _, _ float64) float64 { return dev })
+	for _, m := range []FitMethod{FitLinear, FitMultiLinear, FitRobust} {
+		if _, err := Fit(CAL_CHANNEL_PM25, constant, m); err == nil || errors.Is(err, ErrTooFewPairs) {
+			t.Errorf("%s: expected a degenerate fit error for a constant device, got %v", m, err)
+		}
+	}
+
+	// Constant temperature is collinear with the offset
+	flatTemp := colocationTestPairs([]float64{1, 2, 3, 4, 5, 6}, func(dev, _, _ float64) float64 { return dev })
+	for i := range flatTemp {
+		flatTemp[i].Temp = 20
+	}
+	if _, err := Fit(CAL_CHANNEL_PM25, flatTemp, FitMultiLinear); err == nil {
+		t.Error("expected a degenerate fit error for a constant temperature")
+	}
+}
+
+func TestFitTooFewPairs(t *testing.T) {
+	two := colocationTestPairs([]float64{1, 2}, func(dev, _, _ float64) float64 { return dev })
+	for _, m := range []FitMethod{FitLinear, FitRobust} {
+		if _, err := Fit(CAL_CHANNEL_PM25, two, m); !errors.Is(err, ErrTooFewPairs) {
+			t.Errorf("%s: expected ErrTooFewPairs for two windows, got %v", m, err)
+		}
+	}
+	if _, err := Fit(CAL_CHANNEL_PM25, nil, FitLinear); !errors.Is(err, ErrTooFewPairs) {
+		t.Errorf("expected ErrTooFewPairs without windows, got %v", err)
+	}
+
+	// Enough for a linear fit, not for four coefficients
+	four := colocationTestPairs([]float64{1, 2, 3, 4}, func(dev, _, _ float64) float64 { return dev })
+	if _, err := Fit(CAL_CHANNEL_PM25, four, FitLinear); err != nil {
+		t.Errorf("linear fit of four windows: %v", err)
+	}
+	if _, err := Fit(CAL_CHANNEL_PM25, four, FitMultiLinear); !errors.Is(err, ErrTooFewPairs) {
+		t.Errorf("expected ErrTooFewPairs for a multi-linear fit of four windows, got %v", err)
+	}
+	// Five windows, but one lacks humidity
+	five := colocationTestPairs([]float64{1, 2, 3, 4, 5}, func(dev, _, _ float64) float64 { return dev })
+	five[0].Hum = math.NaN()
+	if _, err := Fit(CAL_CHANNEL_PM25, five, FitMultiLinear); !errors.Is(err, ErrTooFewPairs) {
+		t.Errorf("expected ErrTooFewPairs once windows without humidity are dropped, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package telosairduetcommon
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/* ~~ Sample Deduplication ~~ */
+
+// LastResetUnix is derived from each gateway's own receive time, so copies of one sample may disagree by a second or two.
+const dedupResetSlackSec = 2
+
+type dedupKey struct {
+	serialNumber uint16
+	sampleTimeMs uint32
+}
+
+/*
+One sample as received, possibly several times, through one or more gateways.
+*/
+type DedupEntry struct {
+	Sample        DuetData
+	GatewaySerial string   // gateway that delivered the kept (best-link) copy
+	Gateways      []string // every gateway that delivered a copy, in arrival order
+	Copies        int
+	FirstSeen     time.Time
+}
+
+/*
+Collapses copies of the same sample, keyed by (SerialNumber, SampleTimeMs, LastResetUnix), that arrive within a time window
+through overlapping gateways or mesh retransmissions. The copy with the best link is kept.
+Safe for concurrent use from several gateway readers.
+*/
+type Deduplicator struct {
+	Window time.Duration
+
+	mu      sync.Mutex
+	entries map[dedupKey][]*DedupEntry
+}
+
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{Window: window}
+}
+
+/*
+Offer a received sample. Returns true if it is the first copy of that sample within the window.
+*/
+func (dd *Deduplicator) Offer(d DuetData, gatewaySerial string, now time.Time) bool {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	if dd.entries == nil {
+		dd.entries = map[dedupKey][]*DedupEntry{}
+	}
+
+	k := dedupKey{d.GetSerialNumber(), d.GetSampleTimeMs()}
+	resetUnix := d.GetLastResetUnix()
+	for _, e := range dd.entries[k] {
+		// A copy arriving after the window is a new entry, even if the old one has not been flushed yet
+		if now.Sub(e.FirstSeen) >= dd.Window || absDiffUint32(e.Sample.GetLastResetUnix(), resetUnix) > dedupResetSlackSec {
+			continue
+		}
+		e.Copies++
+		if !containsString(e.Gateways, gatewaySerial) {
+			e.Gateways = append(e.Gateways, gatewaySerial)
+		}
+		if betterLink(d.GetRadioData(), e.Sample.GetRadioData()) {
+			e.Sample = d
+			e.GatewaySerial = gatewaySerial
+		}
+		return false
+	}
+
+	dd.entries[k] = append(dd.entries[k], &DedupEntry{
+		Sample:        d,
+		GatewaySerial: gatewaySerial,
+		Gateways:      []string{gatewaySerial},
+		Copies:        1,
+		FirstSeen:     now,
+	})
+	return true
+}
+
+/*
+Remove and return every entry whose window has elapsed, oldest first.
+*/
+func (dd *Deduplicator) Flush(now time.Time) []DedupEntry {
+	return dd.flush(func(e *DedupEntry) bool { return now.Sub(e.FirstSeen) >= dd.Window })
+}
+
+/*
+Remove and return every entry regardless of age, e.g. at shutdown.
+*/
+func (dd *Deduplicator) FlushAll() []DedupEntry {
+	return dd.flush(func(*DedupEntry) bool { return true })
+}
+
+func (dd *Deduplicator) flush(done func(*DedupEntry) bool) []DedupEntry {
+	dd.mu.Lock()
+	var ret []DedupEntry
+	for k, entries := range dd.entries {
+		kept := entries[:0]
+		for _, e := range entries {
+			if done(e) {
+				ret = append(ret, *e)
+			} else {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) == 0 {
+			delete(dd.entries, k)
+		} else {
+			dd.entries[k] = kept
+		}
+	}
+	dd.mu.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].FirstSeen.Before(ret[j].FirstSeen) })
+	return ret
+}
+
+func (dd *Deduplicator) Pending() int {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	n := 0
+	for _, entries := range dd.entries {
+		n += len(entries)
+	}
+	return n
+}
+
+/*
+Whether link a is better than link b: any metadata beats none, then higher RSSI, higher SNR, and fewer hops.
+*/
+func betterLink(a, b RadioMetadata) bool {
+	if a.Present != b.Present {
+		return a.Present
+	}
+	if a.LastRssi != b.LastRssi {
+		return a.LastRssi > b.LastRssi
+	}
+	if a.LastSnr != b.LastSnr {
+		return a.LastSnr > b.LastSnr
+	}
+	return a.Hops < b.Hops
+}
+
+func absDiffUint32(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeduplicatorKeepsBestLink(t *testing.T) {
+	dd := NewDeduplicator(10 * time.Second)
+	start := time.Unix(1_000_000, 0)
+
+	newSample := func(resetUnix uint32, rssi int16) DuetData {
+		return &DuetDataMk4Var17{
+			SerialNumber:  7,
+			SampleTimeMs:  60_000,
+			LastResetUnix: resetUnix,
+			RadioMeta:     NewRadioMetadata(rssi, 5, 1, 61_000),
+		}
+	}
+
+	var wg sync.WaitGroup
+	firsts := make(chan bool, 3)
+	for i, rssi := range []int16{-110, -95, -120} {
+		wg.Add(1)
+		go func(i int, rssi int16) {
+			defer wg.Done()
+			// Gateways disagree on the reset time by a second
+			firsts <- dd.Offer(newSample(999_000+uint32(i%2), rssi), fmt.Sprintf("gw%d", i), start)
+		}(i, rssi)
+	}
+	wg.Wait()
+	close(firsts)
+	nFirst := 0
+	for f := range firsts {
+		if f {
+			nFirst++
+		}
+	}
+	if nFirst != 1 {
+		t.Errorf("expected exactly one first copy, got %d", nFirst)
+	}
+
+	// A reboot gives a new sample with the same SampleTimeMs
+	if !dd.Offer(newSample(999_500, -100), "gw0", start) {
+		t.Error("expected sample from after a reset to be distinct")
+	}
+
+	if got := dd.Flush(start.Add(5 * time.Second)); len(got) != 0 {
+		t.Errorf("expected nothing flushed inside the window, got %d", len(got))
+	}
+	got := dd.Flush(start.Add(10 * time.Second))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries flushed, got %d", len(got))
+	}
+	for _, e := range got {
+		if e.Sample.GetLastResetUnix() == 999_500 {
+			continue
+		}
+		if e.Copies != 3 || len(e.Gateways) != 3 {
+			t.Errorf("expected 3 copies from 3 gateways, got %d from %v", e.Copies, e.Gateways)
+		}
+		if e.GatewaySerial != "gw1" || e.Sample.GetRadioData().LastRssi != -95 {
+			t.Errorf("expected best copy from gw1 at -95dBm, got %s at %d", e.GatewaySerial, e.Sample.GetRadioData().LastRssi)
+		}
+	}
+	if n := dd.Pending(); n != 0 {
+		t.Errorf("expected nothing pending, got %d", n)
+	}
+}
+
+func TestDeduplicatorWindow(t *testing.T) {
+	dd := NewDeduplicator(10 * time.Second)
+	start := time.Unix(1_000_000, 0)
+	d := &DuetDataMk4Var17{SerialNumber: 7, SampleTimeMs: 60_000, LastResetUnix: 999_000}
+
+	if !dd.Offer(d, "gw0", start) {
+		t.Fatal("expected the first copy to be new")
+	}
+	if dd.Offer(d, "gw1", start.Add(9*time.Second)) {
+		t.Error("expected a copy inside the window to be a duplicate")
+	}
+	// Not flushed yet, but the window has passed
+	if !dd.Offer(d, "gw2", start.Add(10*time.Second)) {
+		t.Error("expected a copy after the window to be new")
+	}
+	if dd.Offer(d, "gw0", start.Add(15*time.Second)) {
+		t.Error("expected a copy inside the second window to be a duplicate")
+	}
+
+	got := dd.Flush(start.Add(20 * time.Second))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries flushed, got %d", len(got))
+	}
+	if got[0].Copies != 2 || got[0].Gateways[1] != "gw1" || got[1].Copies != 2 || got[1].Gateways[0] != "gw2" {
+		t.Errorf("unexpected entries: %+v", got)
+	}
+}
@@ -0,0 +1,320 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+/* ~~ Device Locations & Map Export ~~ */
+
+const (
+	LOCATION_SOURCE_GPS  = "gps"
+	LOCATION_SOURCE_SITE = "site"
+)
+
+/*
+Where a fixed device is installed.
+*/
+type Site struct {
+	SerialNumber uint16  `json:"serial_number"`
+	Name         string  `json:"name"`
+	Lat          float64 `json:"lat"`
+	Lon          float64 `json:"lon"`
+	ElevationM   float64 `json:"elevation_m,omitempty"`
+}
+
+/*
+Static device locations keyed by serial. Safe for concurrent use.
+*/
+type SiteRegistry struct {
+	mu    sync.RWMutex
+	sites map[uint16]Site
+}
+
+func NewSiteRegistry() *SiteRegistry {
+	return &SiteRegistry{sites: map[uint16]Site{}}
+}
+
+func (r *SiteRegistry) Set(s Site) error {
+	if err := ValidateGpsFix(s.Lat, s.Lon); err != nil {
+		return fmt.Errorf("invalid location for site %q (device %d): %w", s.Name, s.SerialNumber, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sites == nil {
+		r.sites = map[uint16]Site{}
+	}
+	r.sites[s.SerialNumber] = s
+	return nil
+}
+
+func (r *SiteRegistry) Get(serialNumber uint16) (Site, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sites[serialNumber]
+	return s, ok
+}
+
+/*
+Load sites from a JSON array of Site.
+*/
+func (r *SiteRegistry) Load(rd io.Reader) error {
+	var sites []Site
+	if err := json.NewDecoder(rd).Decode(&sites); err != nil {
+		return fmt.Errorf("failed to decode sites: %w", err)
+	}
+	for _, s := range sites {
+		if err := r.Set(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* ~~ US EPA PM2.5 AQI ~~ */
+
+type AqiCategory struct {
+	Name  string
+	Color string // hex, as published by the EPA
+}
+
+var (
+	AqiGood                       = AqiCategory{"Good", "#00E400"}
+	AqiModerate                   = AqiCategory{"Moderate", "#FFFF00"}
+	AqiUnhealthyForSensitiveGroup = AqiCategory{"Unhealthy for Sensitive Groups", "#FF7E00"}
+	AqiUnhealthy                  = AqiCategory{"Unhealthy", "#FF0000"}
+	AqiVeryUnhealthy              = AqiCategory{"Very Unhealthy", "#8F3F97"}
+	AqiHazardous                  = AqiCategory{"Hazardous", "#7E0023"}
+)
+
+type aqiBreakpoint struct {
+	cLo, cHi float64
+	iLo, iHi float64
+	category AqiCategory
+}
+
+// PM2.5 breakpoints in µg/m³, as revised by the EPA in 2024
+var pm25AqiBreakpoints = []aqiBreakpoint{
+	{0.0, 9.0, 0, 50, AqiGood},
+	{9.1, 35.4, 51, 100, AqiModerate},
+	{35.5, 55.4, 101, 150, AqiUnhealthyForSensitiveGroup},
+	{55.5, 125.4, 151, 200, AqiUnhealthy},
+	{125.5, 225.4, 201, 300, AqiVeryUnhealthy},
+	{225.5, 325.4, 301, 500, AqiHazardous},
+}
+
+/*
+US AQI for a PM2.5 concentration in µg/m³. Officially the AQI is of a 24 hour mean; applied to a single sample it is
+only indicative. Concentrations beyond the last breakpoint are reported as 500.
+*/
+func Pm25Aqi(pm25 float64) (int, AqiCategory) {
+	c := math.Floor(math.Max(pm25, 0)*10) / 10
+	for _, bp := range pm25AqiBreakpoints {
+		if c <= bp.cHi {
+			return int(math.Round((bp.iHi-bp.iLo)/(bp.cHi-bp.cLo)*(c-bp.cLo) + bp.iLo)), bp.category
+		}
+	}
+	return 500, AqiHazardous
+}
+
+/* ~~ Latest Readings per Device ~~ */
+
+type DeviceLocation struct {
+	SerialNumber uint16
+	Lat, Lon     float64
+	Source       string // LOCATION_SOURCE_GPS or LOCATION_SOURCE_SITE
+	SiteName     string
+	SampleUnix   uint32
+	Values       map[string]any
+}
+
+/*
+Tracks each device's latest sample and where it is: the GPS fix for GPS variants, else the site registry.
+Safe for concurrent use.
+*/
+type DeviceLocator struct {
+	Sites *SiteRegistry
+
+	mu     sync.RWMutex
+	latest map[uint16]DeviceLocation
+}
+
+func NewDeviceLocator(sites *SiteRegistry) *DeviceLocator {
+	return &DeviceLocator{Sites: sites, latest: map[uint16]DeviceLocation{}}
+}
+
+/*
+Record a sample if it is newer than the device's latest.
+*/
+func (l *DeviceLocator) Update(d DuetData, gatewaySerial string) {
+	sn := d.GetSerialNumber()
+	loc := DeviceLocation{SerialNumber: sn, SampleUnix: d.Timestamp(), Values: d.ToMap(gatewaySerial)}
+	if gd, ok := d.(GpsLocated); ok {
+		lat, lon := gd.Location()
+		if ValidateGpsFix(float64(lat), float64(lon)) == nil {
+			loc.Lat, loc.Lon, loc.Source = float64(lat), float64(lon), LOCATION_SOURCE_GPS
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.latest == nil {
+		l.latest = map[uint16]DeviceLocation{}
+	}
+	prev, ok := l.latest[sn]
+	if ok && prev.SampleUnix > loc.SampleUnix {
+		return
+	}
+	// Keep the last good fix if this sample has none
+	if loc.Source == "" && prev.Source == LOCATION_SOURCE_GPS {
+		loc.Lat, loc.Lon, loc.Source = prev.Lat, prev.Lon, prev.Source
+	}
+	l.latest[sn] = loc
+}
+
+/*
+Every device with a known location, by serial.
+*/
+func (l *DeviceLocator) Locations() []DeviceLocation {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var ret []DeviceLocation
+	for _, loc := range l.latest {
+		if loc.Source == "" && l.Sites != nil {
+			if s, ok := l.Sites.Get(loc.SerialNumber); ok {
+				loc.Lat, loc.Lon, loc.Source, loc.SiteName = s.Lat, s.Lon, LOCATION_SOURCE_SITE, s.Name
+			}
+		}
+		if loc.Source == "" {
+			continue
+		}
+		ret = append(ret, loc)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].SerialNumber < ret[j].SerialNumber })
+	return ret
+}
+
+/*
+The latest values plus location source, site name, sample age in seconds and, where PM2.5 is known, AQI.
+*/
+func (loc DeviceLocation) Properties(now time.Time) map[string]any {
+	props := map[string]any{}
+	for k, v := range loc.Values {
+		props[k] = v
+	}
+	props["location_source"] = loc.Source
+	if loc.SiteName != "" {
+		props["site_name"] = loc.SiteName
+	}
+	props["sample_age_s"] = now.Unix() - int64(loc.SampleUnix)
+	if pm25, ok := mapFloat(loc.Values, "pm25_m"); ok {
+		aqi, cat := Pm25Aqi(pm25)
+		props["aqi"] = aqi
+		props["aqi_category"] = cat.Name
+		props["aqi_color"] = cat.Color
+	}
+	return props
+}
+
+func (l *DeviceLocator) GeoJSON(now time.Time) GeoJSONFeatureCollection {
+	var features []GeoJSONFeature
+	for _, loc := range l.Locations() {
+		features = append(features, NewGeoJSONFeature(NewGeoJSONPoint(loc.Lat, loc.Lon), loc.Properties(now)))
+	}
+	return NewGeoJSONFeatureCollection(features...)
+}
+
+/* ~~ KML ~~ */
+
+type kmlDocument struct {
+	XMLName  xml.Name `xml:"kml"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Document struct {
+		Name       string         `xml:"name"`
+		Styles     []kmlStyle     `xml:"Style"`
+		Placemarks []kmlPlacemark `xml:"Placemark"`
+	} `xml:"Document"`
+}
+
+type kmlStyle struct {
+	ID    string `xml:"id,attr"`
+	Color string `xml:"IconStyle>color"`
+}
+
+type kmlPlacemark struct {
+	Name        string    `xml:"name"`
+	StyleURL    string    `xml:"styleUrl,omitempty"`
+	Data        []kmlData `xml:"ExtendedData>Data"`
+	Coordinates string    `xml:"Point>coordinates"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+/*
+KML colours are aabbggrr.
+*/
+func kmlColor(hex string) string {
+	if len(hex) != 7 {
+		return "ffffffff"
+	}
+	return "ff" + hex[5:7] + hex[3:5] + hex[1:3]
+}
+
+func kmlStyleID(c AqiCategory) string {
+	return "aqi-" + c.Color[1:]
+}
+
+/*
+Write a KML document with a placemark per located device, styled by AQI category.
+*/
+func (l *DeviceLocator) WriteKML(w io.Writer, now time.Time) error {
+	var doc kmlDocument
+	doc.Xmlns = "http://www.opengis.net/kml/2.2"
+	doc.Document.Name = "Duet devices"
+	for _, bp := range pm25AqiBreakpoints {
+		doc.Document.Styles = append(doc.Document.Styles, kmlStyle{ID: kmlStyleID(bp.category), Color: kmlColor(bp.category.Color)})
+	}
+
+	for _, loc := range l.Locations() {
+		props := loc.Properties(now)
+		pm := kmlPlacemark{
+			Name:        fmt.Sprintf("Duet %d", loc.SerialNumber),
+			Coordinates: fmt.Sprintf("%f,%f,0", loc.Lon, loc.Lat),
+		}
+		if loc.SiteName != "" {
+			pm.Name += " (" + loc.SiteName + ")"
+		}
+		if pm25, ok := mapFloat(loc.Values, "pm25_m"); ok {
+			_, cat := Pm25Aqi(pm25)
+			pm.StyleURL = "#" + kmlStyleID(cat)
+		}
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			pm.Data = append(pm.Data, kmlData{Name: k, Value: fmt.Sprint(props[k])})
+		}
+		doc.Document.Placemarks = append(doc.Document.Placemarks, pm)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode kml: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package telosairduetcommon
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPm25Aqi(t *testing.T) {
+	for _, td := range []struct {
+		pm25     float64
+		aqi      int
+		category AqiCategory
+	}{
+		{-3, 0, AqiGood},
+		{0, 0, AqiGood},
+		{9.0, 50, AqiGood},
+		// Truncated to one decimal, so still in the first band
+		{9.09, 50, AqiGood},
+		{9.1, 51, AqiModerate},
+		// 49/26.3 * 13.1 + 51
+		{22.2, 75, AqiModerate},
+		{35.4, 100, AqiModerate},
+		{35.5, 101, AqiUnhealthyForSensitiveGroup},
+		{55.4, 150, AqiUnhealthyForSensitiveGroup},
+		{55.5, 151, AqiUnhealthy},
+		{125.4, 200, AqiUnhealthy},
+		{125.5, 201, AqiVeryUnhealthy},
+		{225.4, 300, AqiVeryUnhealthy},
+		{225.5, 301, AqiHazardous},
+		{325.4, 500, AqiHazardous},
+		// Beyond the top band
+		{325.5, 500, AqiHazardous},
+		{1000, 500, AqiHazardous},
+	} {
+		aqi, cat := Pm25Aqi(td.pm25)
+		if aqi != td.aqi || cat != td.category {
+			t.Errorf("Pm25Aqi(%.2f) = %d, %s; want %d, %s", td.pm25, aqi, cat.Name, td.aqi, td.category.Name)
+		}
+	}
+}
+
+func TestSiteRegistry(t *testing.T) {
+	r := NewSiteRegistry()
+	if err := r.Load(bytes.NewBufferString(`[{"serial_number": 7, "name": "roof", "lat": 52.39, "lon": 13.06}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := r.Get(7); !ok || s.Name != "roof" || s.Lat != 52.39 {
+		t.Errorf("unexpected site: %+v, %v", s, ok)
+	}
+	if _, ok := r.Get(8); ok {
+		t.Error("unexpected site for device 8")
+	}
+	for _, bad := range []Site{{SerialNumber: 8, Lat: 91, Lon: 0}, {SerialNumber: 8}} {
+		if err := r.Set(bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+	if err := r.Load(bytes.NewBufferString(`{"serial_number": 7}`)); err == nil {
+		t.Error("expected an error for a non-array")
+	}
+}
+
+func TestDeviceLocator(t *testing.T) {
+	sites := NewSiteRegistry()
+	if err := sites.Set(Site{SerialNumber: 7, Name: "roof", Lat: 52.39, Lon: 13.06}); err != nil {
+		t.Fatal(err)
+	}
+	l := NewDeviceLocator(sites)
+
+	fixed := &DuetDataMk4Var7{SerialNumber: 7, UnixSec: 1000, Sps: Sps30Measurement{PM2p5: 40}}
+	l.Update(fixed, "gw")
+	l.Update(gpsTestSample(1000, 48.1, 11.5), "gw")
+	// Neither a site nor a fix
+	l.Update(&DuetDataMk4Var7{SerialNumber: 9, UnixSec: 1000}, "gw")
+
+	locs := l.Locations()
+	if len(locs) != 2 {
+		t.Fatalf("got %d locations; want 2: %+v", len(locs), locs)
+	}
+	if gps := locs[0]; gps.SerialNumber != 5 || gps.Source != LOCATION_SOURCE_GPS || gps.Lat != float64(float32(48.1)) {
+		t.Errorf("unexpected GPS location: %+v", gps)
+	}
+	if site := locs[1]; site.SerialNumber != 7 || site.Source != LOCATION_SOURCE_SITE || site.SiteName != "roof" || site.Lon != 13.06 {
+		t.Errorf("unexpected site location: %+v", site)
+	}
+
+	// A later sample without a fix keeps the last one, an older sample is ignored
+	l.Update(gpsTestSample(1060, 0, 0), "gw")
+	l.Update(gpsTestSample(900, 40, 10), "gw")
+	if loc := l.Locations()[0]; loc.SampleUnix != 1060 || loc.Source != LOCATION_SOURCE_GPS || loc.Lat != float64(float32(48.1)) {
+		t.Errorf("unexpected location after later samples: %+v", loc)
+	}
+
+	props := l.Locations()[1].Properties(time.Unix(1090, 0))
+	for k, want := range map[string]any{
+		"location_source":  LOCATION_SOURCE_SITE,
+		"site_name":        "roof",
+		"sample_age_s":     int64(90),
+		"aqi":              112,
+		"aqi_category":     AqiUnhealthyForSensitiveGroup.Name,
+		"aqi_color":        AqiUnhealthyForSensitiveGroup.Color,
+		KEY_GATEWAY_SERIAL: "gw",
+	} {
+		if props[k] != want {
+			t.Errorf("%s = %v; want %v", k, props[k], want)
+		}
+	}
+
+	if fc := l.GeoJSON(time.Unix(1090, 0)); len(fc.Features) != 2 {
+		t.Errorf("got %d GeoJSON features; want 2", len(fc.Features))
+	}
+}
@@ -0,0 +1,107 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* ~~ Device Type ~~ */
+
+const (
+	KEY_HW_VERSION        = "hw_version"
+	KEY_SENSOR_VARIANT    = "sensor_variant"
+	KEY_DEVICE_TYPE_ALIAS = "device_type_alias"
+)
+
+/*
+Hardware version & sensor variant of a Duet, e.g. {4, 10} for Mk4.10. Unlike the legacy float `deviceType`,
+this tells Mk4.1 and Mk4.10 apart.
+*/
+type DeviceType struct {
+	Hardware uint8
+	Variant  uint8
+}
+
+/*
+In the form of `DuetTypeInfo.TypeAlias`, e.g. "Mk4.10".
+*/
+func (t DeviceType) String() string {
+	return fmt.Sprintf("Mk%d.%d", t.Hardware, t.Variant)
+}
+
+/*
+The legacy `deviceType` value, which is ambiguous for variants 10 and up.
+*/
+func (t DeviceType) Float() float64 {
+	f, _ := strconv.ParseFloat(fmt.Sprintf("%d.%d", t.Hardware, t.Variant), 64)
+	return f
+}
+
+/*
+Parse "Mk4.10" or "4.10". Note "4.1" is Mk4.1, never Mk4.10.
+*/
+func ParseDeviceType(s string) (DeviceType, error) {
+	trimmed := strings.TrimSpace(s)
+	if len(trimmed) >= 2 && strings.EqualFold(trimmed[:2], "mk") {
+		trimmed = trimmed[2:]
+	}
+	hw, variant, ok := strings.Cut(trimmed, ".")
+	if !ok {
+		return DeviceType{}, fmt.Errorf("invalid device type %q, expected e.g. Mk4.10", s)
+	}
+	h, err := strconv.ParseUint(hw, 10, 8)
+	if err != nil {
+		return DeviceType{}, fmt.Errorf("invalid hardware version in device type %q: %w", s, err)
+	}
+	v, err := strconv.ParseUint(variant, 10, 8)
+	if err != nil {
+		return DeviceType{}, fmt.Errorf("invalid sensor variant in device type %q: %w", s, err)
+	}
+	return DeviceType{uint8(h), uint8(v)}, nil
+}
+
+func (t DeviceType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *DeviceType) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("device type must be a string: %w", err)
+	}
+	parsed, err := ParseDeviceType(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+/*
+The registered type info for this device type, if any.
+*/
+func (t DeviceType) TypeInfo() (*DuetTypeInfo, bool) {
+	ti := getTypeInfo(t.Hardware, t.Variant)
+	return ti, ti != nil
+}
+
+/*
+The structured fields emitted alongside the legacy `deviceType`.
+*/
+func (t DeviceType) ToMap() map[string]any {
+	return map[string]any{
+		KEY_HW_VERSION:        t.Hardware,
+		KEY_SENSOR_VARIANT:    t.Variant,
+		KEY_DEVICE_TYPE_ALIAS: t.String(),
+	}
+}
+
+func (t DeviceType) FieldSpecs() []FieldSpec {
+	return []FieldSpec{
+		field(KEY_HW_VERSION, "uint8", "", "Hardware version"),
+		field(KEY_SENSOR_VARIANT, "uint8", "", "Sensor variant"),
+		field(KEY_DEVICE_TYPE_ALIAS, "string", "", "Device type, e.g. Mk4.10"),
+	}
+}
@@ -0,0 +1,278 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+/* ~~ Duct Flow & Ventilation ~~ */
+
+const (
+	KEY_DUCT_FLOW          = "duct_flow_m3h"
+	KEY_AIR_CHANGES        = "ach"
+	KEY_VENTILATION_OK     = "ventilation_ok"
+	KEY_VENTILATION_CO2_OK = "ventilation_co2_ok"
+)
+
+/*
+Implemented by variants carrying an air velocity sensor.
+*/
+type AirflowData interface {
+	DuetData
+	AirVelocity() float32 // m/s
+}
+
+/*
+Duct cross-section. Round if DiameterM is set, else rectangular.
+*/
+type DuctConfig struct {
+	DiameterM float64 `json:"diameter_m,omitempty"`
+	WidthM    float64 `json:"width_m,omitempty"`
+	HeightM   float64 `json:"height_m,omitempty"`
+	// Mean over the cross-section relative to the point velocity measured. 0 is treated as 1.
+	ProfileFactor float64 `json:"profile_factor,omitempty"`
+}
+
+func (c DuctConfig) Area() float64 {
+	if c.DiameterM > 0 {
+		return math.Pi * c.DiameterM * c.DiameterM / 4
+	}
+	return c.WidthM * c.HeightM
+}
+
+/*
+Volumetric flow in m³/s for a velocity measured in the duct.
+*/
+func (c DuctConfig) Flow(velocityMps float64) float64 {
+	f := c.ProfileFactor
+	if f == 0 {
+		f = 1
+	}
+	return velocityMps * f * c.Area()
+}
+
+type HvacConfig struct {
+	Duct DuctConfig `json:"duct"`
+	// Volume of the space the duct serves, m³
+	RoomVolumeM3 float64 `json:"room_volume_m3"`
+	// Adequacy thresholds
+	MinAirChanges float64 `json:"min_ach"`
+	MaxCo2Ppm     float64 `json:"max_co2_ppm"`
+	OutdoorCo2Ppm float64 `json:"outdoor_co2_ppm"`
+
+	// CO2 decay detection in `HvacAnalyzer.Windows()`, see FindCo2Decays(). Zero values use the DEFAULT_CO2_* defaults.
+	DecayMinRisePpm float64 `json:"decay_min_rise_ppm,omitempty"`
+	DecayNoisePpm   float64 `json:"decay_noise_ppm,omitempty"`
+	DecayMinPoints  int     `json:"decay_min_points,omitempty"`
+	DecayMaxGapSec  uint32  `json:"decay_max_gap_s,omitempty"`
+}
+
+func NewHvacConfig(duct DuctConfig, roomVolumeM3 float64) HvacConfig {
+	return HvacConfig{
+		Duct:          duct,
+		RoomVolumeM3:  roomVolumeM3,
+		MinAirChanges: 4,
+		MaxCo2Ppm:     1000,
+		OutdoorCo2Ppm: DEFAULT_OUTDOOR_CO2_PPM,
+
+		DecayMinRisePpm: DEFAULT_CO2_MIN_EVENT_PPM,
+		DecayNoisePpm:   DEFAULT_CO2_NOISE_PPM,
+		DecayMinPoints:  DEFAULT_CO2_MIN_EVENT_POINTS,
+		DecayMaxGapSec:  DEFAULT_CO2_MAX_GAP_SEC,
+	}
+}
+
+func (c HvacConfig) validate() error {
+	if c.Duct.Area() <= 0 {
+		return fmt.Errorf("duct has no cross-section: %+v", c.Duct)
+	}
+	if c.RoomVolumeM3 <= 0 {
+		return fmt.Errorf("invalid room volume %f m3", c.RoomVolumeM3)
+	}
+	return nil
+}
+
+func (c HvacConfig) findDecays(co2 []Co2Point, outdoorPpm float64) [][]Co2Point {
+	minRise, noise := c.DecayMinRisePpm, c.DecayNoisePpm
+	if minRise == 0 {
+		minRise = DEFAULT_CO2_MIN_EVENT_PPM
+	}
+	if noise == 0 {
+		noise = DEFAULT_CO2_NOISE_PPM
+	}
+	minPoints, maxGap := c.DecayMinPoints, c.DecayMaxGapSec
+	if minPoints == 0 {
+		minPoints = DEFAULT_CO2_MIN_EVENT_POINTS
+	}
+	if maxGap == 0 {
+		maxGap = DEFAULT_CO2_MAX_GAP_SEC
+	}
+	return FindCo2Decays(co2, outdoorPpm, minRise, noise, minPoints, maxGap)
+}
+
+/*
+Air changes per hour for a flow in m³/s. Only meaningful for a config that passes validate().
+*/
+func (c HvacConfig) AirChanges(flowM3s float64) float64 {
+	return flowM3s * 3600 / c.RoomVolumeM3
+}
+
+type DuctFlowSample struct {
+	UnixSec      uint32
+	VelocityMps  float64
+	FlowM3h      float64
+	AirChangesPH float64
+	Co2Ppm       float64
+	hasCo2       bool
+
+	AirChangesOk bool
+	Co2Ok        bool // true if the sample has no CO2
+}
+
+func (s DuctFlowSample) Adequate() bool {
+	return s.AirChangesOk && s.Co2Ok
+}
+
+func (s DuctFlowSample) ToMap() map[string]any {
+	return map[string]any{
+		KEY_DUCT_FLOW:          s.FlowM3h,
+		KEY_AIR_CHANGES:        s.AirChangesPH,
+		KEY_VENTILATION_OK:     s.Adequate(),
+		KEY_VENTILATION_CO2_OK: s.Co2Ok,
+	}
+}
+
+/*
+Flow, air changes and adequacy for one sample. Returns false for variants without an air velocity sensor, and for a
+config without a duct cross-section or room volume.
+*/
+func (c HvacConfig) Analyze(d DuetData) (DuctFlowSample, bool) {
+	ad, ok := d.(AirflowData)
+	if !ok || c.validate() != nil {
+		return DuctFlowSample{}, false
+	}
+	v := float64(ad.AirVelocity())
+	flow := c.Duct.Flow(v)
+	s := DuctFlowSample{
+		UnixSec:      d.Timestamp(),
+		VelocityMps:  v,
+		FlowM3h:      flow * 3600,
+		AirChangesPH: c.AirChanges(flow),
+		Co2Ok:        true,
+	}
+	s.AirChangesOk = s.AirChangesPH >= c.MinAirChanges
+	if co2, ok := SampleCo2(d); ok && co2 > 0 {
+		s.Co2Ppm, s.hasCo2 = float64(co2), true
+		s.Co2Ok = c.MaxCo2Ppm <= 0 || s.Co2Ppm <= c.MaxCo2Ppm
+	}
+	return s, true
+}
+
+/*
+Ventilation summary over one window.
+*/
+type VentilationWindow struct {
+	Start, End   uint32
+	N            int
+	MeanFlowM3h  float64
+	MeanAch      float64
+	MaxCo2Ppm    float64
+	AdequateFrac float64 // fraction of samples adequate
+
+	// From the longest CO2 decay in the window, if there was one
+	Co2Decay *Co2DecayFit
+	// Outdoor air changes (from the decay) over total air changes (from the duct), clamped to [0, 1]
+	OutdoorAirFraction float64
+}
+
+/*
+Accumulates per-sample analyses per device and summarises them over fixed windows. Safe for concurrent use.
+*/
+type HvacAnalyzer struct {
+	Config HvacConfig
+	Window uint32 // seconds
+
+	mu      sync.Mutex
+	samples map[uint16][]DuctFlowSample
+}
+
+func NewHvacAnalyzer(config HvacConfig, windowSec uint32) (*HvacAnalyzer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &HvacAnalyzer{Config: config, Window: windowSec, samples: map[uint16][]DuctFlowSample{}}, nil
+}
+
+func (a *HvacAnalyzer) Add(d DuetData) (DuctFlowSample, bool) {
+	s, ok := a.Config.Analyze(d)
+	if !ok {
+		return s, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.samples == nil {
+		a.samples = map[uint16][]DuctFlowSample{}
+	}
+	a.samples[d.GetSerialNumber()] = append(a.samples[d.GetSerialNumber()], s)
+	return s, true
+}
+
+/*
+Summaries for each window with samples from the device, oldest first.
+*/
+func (a *HvacAnalyzer) Windows(serialNumber uint16) []VentilationWindow {
+	a.mu.Lock()
+	samples := append([]DuctFlowSample(nil), a.samples[serialNumber]...)
+	a.mu.Unlock()
+	sort.Slice(samples, func(i, j int) bool { return samples[i].UnixSec < samples[j].UnixSec })
+
+	window := a.Window
+	if window == 0 {
+		window = 3600
+	}
+	outdoor := a.Config.OutdoorCo2Ppm
+	if outdoor <= 0 {
+		outdoor = DEFAULT_OUTDOOR_CO2_PPM
+	}
+
+	var ret []VentilationWindow
+	for i := 0; i < len(samples); {
+		start := samples[i].UnixSec - samples[i].UnixSec%window
+		w := VentilationWindow{Start: start, End: start + window}
+		var co2 []Co2Point
+		adequate := 0
+		for ; i < len(samples) && samples[i].UnixSec < w.End; i++ {
+			s := samples[i]
+			w.N++
+			w.MeanFlowM3h += s.FlowM3h
+			w.MeanAch += s.AirChangesPH
+			if s.Adequate() {
+				adequate++
+			}
+			if s.hasCo2 {
+				w.MaxCo2Ppm = math.Max(w.MaxCo2Ppm, s.Co2Ppm)
+				co2 = append(co2, Co2Point{s.UnixSec, s.Co2Ppm})
+			}
+		}
+		w.MeanFlowM3h /= float64(w.N)
+		w.MeanAch /= float64(w.N)
+		w.AdequateFrac = float64(adequate) / float64(w.N)
+
+		var best []Co2Point
+		for _, run := range a.Config.findDecays(co2, outdoor) {
+			if len(run) > len(best) {
+				best = run
+			}
+		}
+		if fit, err := FitCo2Decay(best, outdoor); err == nil {
+			w.Co2Decay = &fit
+			if w.MeanAch > 0 {
+				w.OutdoorAirFraction = math.Min(math.Max(fit.AirChangesPH/w.MeanAch, 0), 1)
+			}
+		}
+		ret = append(ret, w)
+	}
+	return ret
+}
@@ -0,0 +1,126 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// 420 ppm outdoor plus an excess decaying at achPH, sampled every stepSec
+func syntheticCo2Decay(start uint32, n int, stepSec uint32, excessPpm, achPH float64) []Co2Point {
+	ret := make([]Co2Point, n)
+	for i := range ret {
+		dt := float64(uint32(i)*stepSec) / 3600
+		ret[i] = Co2Point{start + uint32(i)*stepSec, DEFAULT_OUTDOOR_CO2_PPM + excessPpm*math.Exp(-achPH*dt)}
+	}
+	return ret
+}
+
+func TestDuctConfig(t *testing.T) {
+	round := DuctConfig{DiameterM: 0.2}
+	if a := round.Area(); math.Abs(a-0.0314159) > 1e-6 {
+		t.Errorf("round area = %f", a)
+	}
+	rect := DuctConfig{WidthM: 0.4, HeightM: 0.25, ProfileFactor: 0.9}
+	if f := rect.Flow(2); math.Abs(f-0.18) > 1e-9 {
+		t.Errorf("rectangular flow = %f; want 0.18", f)
+	}
+}
+
+func TestHvacAnalyze(t *testing.T) {
+	d := &DuetDataMk4Var16{UnixSec: 1000, Fs3000Velocity: 2, Scd: Scd41Measurement{Co2: 1200}}
+	cfg := NewHvacConfig(DuctConfig{DiameterM: 0.2}, 50)
+	s, ok := cfg.Analyze(d)
+	if !ok {
+		t.Fatal("expected an analysis for Mk4.16")
+	}
+	// 2 m/s through 0.0314 m² is 226 m³/h, 4.5 air changes in 50 m³
+	if math.Abs(s.FlowM3h-226.19) > 0.01 || math.Abs(s.AirChangesPH-4.524) > 0.001 {
+		t.Errorf("flow %f m3/h, %f ach", s.FlowM3h, s.AirChangesPH)
+	}
+	if !s.AirChangesOk || s.Co2Ok || s.Adequate() {
+		t.Errorf("expected enough air changes but too much CO2: %+v", s)
+	}
+
+	if _, ok := cfg.Analyze(&DuetDataMk4Var7{}); ok {
+		t.Error("expected no analysis without an air velocity sensor")
+	}
+
+	// An invalid config must not put Inf / NaN into the map
+	for _, bad := range []HvacConfig{NewHvacConfig(DuctConfig{DiameterM: 0.2}, 0), NewHvacConfig(DuctConfig{}, 50)} {
+		if _, ok := bad.Analyze(d); ok {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+		m := ToMapWithOptions(d, "", ToMapOptions{Hvac: &bad})
+		if _, ok := m[KEY_AIR_CHANGES]; ok {
+			t.Errorf("expected no %s for %+v", KEY_AIR_CHANGES, bad)
+		}
+		if _, err := json.Marshal(m); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFitCo2Decay(t *testing.T) {
+	fit, err := FitCo2Decay(syntheticCo2Decay(0, 13, 300, 600, 2), DEFAULT_OUTDOOR_CO2_PPM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(fit.AirChangesPH-2) > 1e-6 || fit.R2 < 0.999 || fit.N != 13 || fit.End != 3600 {
+		t.Errorf("unexpected fit: %+v", fit)
+	}
+
+	for name, points := range map[string][]Co2Point{
+		"too few":       syntheticCo2Decay(0, 2, 300, 600, 2),
+		"rising":        syntheticCo2Decay(0, 10, 300, 600, -1),
+		"below outdoor": {{0, 400}, {300, 410}, {600, 405}, {900, 400}},
+	} {
+		if _, err := FitCo2Decay(points, DEFAULT_OUTDOOR_CO2_PPM); err != ErrNoCo2Decay {
+			t.Errorf("%s: expected ErrNoCo2Decay, got %v", name, err)
+		}
+	}
+}
+
+func TestFindCo2Decays(t *testing.T) {
+	// Plateau, decay, then a rise after a gap
+	points := []Co2Point{{0, 1020}, {300, 1025}, {600, 1020}}
+	points = append(points, syntheticCo2Decay(900, 10, 300, 600, 2)...)
+	points = append(points, Co2Point{900 + 9*300 + 3600, 900})
+
+	runs := FindCo2Decays(points, DEFAULT_OUTDOOR_CO2_PPM, DEFAULT_CO2_MIN_EVENT_PPM, DEFAULT_CO2_NOISE_PPM,
+		DEFAULT_CO2_MIN_EVENT_POINTS, DEFAULT_CO2_MAX_GAP_SEC)
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 decay, got %d", len(runs))
+	}
+	// Starts at the turning point, not the plateau before it
+	if runs[0][0].UnixSec != 300 || runs[0][len(runs[0])-1].UnixSec != 900+9*300 {
+		t.Errorf("unexpected decay bounds: %v", runs[0])
+	}
+}
+
+func TestHvacAnalyzerWindows(t *testing.T) {
+	cfg := NewHvacConfig(DuctConfig{DiameterM: 0.2}, 50)
+	a, err := NewHvacAnalyzer(cfg, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHvacAnalyzer(NewHvacConfig(DuctConfig{}, 50), 3600); err == nil {
+		t.Error("expected an error for a duct without a cross-section")
+	}
+
+	// A 1.5 ach outdoor-air decay under a steady 4.5 ach of duct flow
+	for _, p := range syntheticCo2Decay(7200, 12, 300, 800, 1.5) {
+		a.Add(&DuetDataMk4Var16{SerialNumber: 7, UnixSec: p.UnixSec, Fs3000Velocity: 2, Scd: Scd41Measurement{Co2: uint16(p.Ppm)}})
+	}
+	windows := a.Windows(7)
+	if len(windows) != 1 {
+		t.Fatalf("expected 1 window, got %d", len(windows))
+	}
+	w := windows[0]
+	if w.N != 12 || w.Start != 7200 || w.Co2Decay == nil {
+		t.Fatalf("unexpected window: %+v", w)
+	}
+	if math.Abs(w.Co2Decay.AirChangesPH-1.5) > 0.05 || math.Abs(w.OutdoorAirFraction-1.5/4.524) > 0.02 {
+		t.Errorf("decay %f ach, outdoor air fraction %f", w.Co2Decay.AirChangesPH, w.OutdoorAirFraction)
+	}
+}
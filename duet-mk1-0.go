@@ -14,6 +14,7 @@ var DuetTypeMk1Var0 = DuetTypeInfo{
 	ExpectedStringLen:    12,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk1Var0{} },
 	TypeAlias:            "Mk1.0",
+	DeviceType:           DeviceType{1, 0},
 }
 
 /*
@@ -40,8 +41,6 @@ type DuetDataMk1Var0 struct {
 	LastResetUnix  uint32
 	SensorStates   uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Pt1 Pms5003Measurement
 	Pt2 Pms5003Measurement
@@ -53,6 +52,12 @@ type DuetDataMk1Var0 struct {
 	Co2       PlantowerCo2Measurement
 	RadioMeta RadioMetadata
 
+	OpcMerge      string
+	OpcMergeRules OpcMergeDiagnostics
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -68,17 +73,70 @@ func (d *DuetDataMk1Var0) Timestamp() uint32 {
 func (d *DuetDataMk1Var0) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk1Var0) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk1Var0) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk1Var0) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk1Var0) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk1Var0) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.PtM, d.Si, d.Co2, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
 
+func (d *DuetDataMk1Var0) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_PMS5003:
+		return d.PtM, true
+	case SENSOR_SI7021:
+		return d.Si, true
+	case SENSOR_PLANTOWER_CO2:
+		return d.Co2, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.Si.TempRh(), true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk1Var0) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
+
 func (d *DuetDataMk1Var0) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk1Var0) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk1Var0) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk1Var0) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk1Var0) OpcChannels() (opc1, opc2, merged *Pms5003Measurement) {
+	return &d.Pt1, &d.Pt2, &d.PtM
+}
+func (d *DuetDataMk1Var0) SetOpcMerge(strategy string, diag OpcMergeDiagnostics) {
+	d.OpcMerge = strategy
+	d.OpcMergeRules = diag
+}
+func (d *DuetDataMk1Var0) SensorStateBits() uint8 {
+	return d.SensorStates
 }
 func (d *DuetDataMk1Var0) String() string {
 	return fmt.Sprintf("[Duet %d, Type %d.%d | Unix %d | Si7021 %s | PT CO2: %s | MPRLS: %s | SGP: %s | PT1: %s | PT2: %s | PTM: %s | Radio: %s | Errstate %d ]",
@@ -237,6 +295,7 @@ func (d *DuetDataMk1Var0) ToMap(gatewaySerial string) map[string]any {
 		KEY_LAST_RESET_TIME: d.LastResetUnix,
 		KEY_GATEWAY_SERIAL:  gatewaySerial,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Pt1.ToMap("_t"))
 	maps.Copy(ret, d.Pt2.ToMap("_b"))
 	maps.Copy(ret, d.PtM.ToMap("_m"))
@@ -246,9 +305,29 @@ func (d *DuetDataMk1Var0) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.OpcMerge != "" {
+		ret[KEY_OPC_MERGE] = d.OpcMerge
+		d.OpcMergeRules.toMap(ret)
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk1Var0) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Pt1.FieldSpecs("_t"),
+		d.Pt2.FieldSpecs("_b"),
+		d.PtM.FieldSpecs("_m"),
+		d.Si.FieldSpecs(),
+		d.Si.TempRh().FieldSpecs(),
+		d.Co2.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		opcMergeFieldSpecs(opcMergeFields),
+		d.Gateway.FieldSpecs(),
+	)
+}
@@ -14,6 +14,7 @@ var DuetTypeMk1Var2 = DuetTypeInfo{
 	ExpectedStringLen:    10,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk1Var2{} },
 	TypeAlias:            "Mk1.2",
+	DeviceType:           DeviceType{1, 2},
 }
 
 /*
@@ -40,8 +41,6 @@ type DuetDataMk1Var2 struct {
 	LastResetUnix  uint32
 	SensorStates   uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Sps Pms5003Measurement
 
@@ -50,6 +49,9 @@ type DuetDataMk1Var2 struct {
 	Sgp       Sgp40Measurement
 	RadioMeta RadioMetadata
 
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -65,17 +67,58 @@ func (d *DuetDataMk1Var2) Timestamp() uint32 {
 func (d *DuetDataMk1Var2) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk1Var2) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk1Var2) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk1Var2) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk1Var2) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk1Var2) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Sps, d.Si, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
 
+func (d *DuetDataMk1Var2) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.Sps, true
+	case SENSOR_SI7021:
+		return d.Si, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.Si.TempRh(), true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk1Var2) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
+
 func (d *DuetDataMk1Var2) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk1Var2) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk1Var2) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk1Var2) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
 }
 func (d *DuetDataMk1Var2) String() string {
 	return fmt.Sprintf("[Duet %d, Type %d.%d | Unix %d | Si7021 %s | MPRLS: %s | SGP: %s | SPS30: %s | Radio: %s | Errstate %d ]",
@@ -200,6 +243,7 @@ func (d *DuetDataMk1Var2) ToMap(gatewaySerial string) map[string]any {
 		KEY_LAST_RESET_TIME: d.LastResetUnix,
 		KEY_GATEWAY_SERIAL:  gatewaySerial,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Sps.ToMap("_t"))
 	maps.Copy(ret, d.Sps.ToMap("_b"))
 	maps.Copy(ret, d.Sps.ToMap("_m"))
@@ -208,9 +252,23 @@ func (d *DuetDataMk1Var2) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
-	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk1Var2) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps.FieldSpecs("_t"),
+		d.Sps.FieldSpecs("_b"),
+		d.Sps.FieldSpecs("_m"),
+		d.Si.FieldSpecs(),
+		d.Si.TempRh().FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		d.Gateway.FieldSpecs(),
+	)
+}
@@ -14,6 +14,7 @@ var DuetTypeMk1Var3 = DuetTypeInfo{
 	ExpectedStringLen:    14,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk1Var3{} },
 	TypeAlias:            "Mk1.3",
+	DeviceType:           DeviceType{1, 3},
 }
 
 /*
@@ -40,8 +41,6 @@ type DuetDataMk1Var3 struct {
 	LastResetUnix  uint32
 	SensorStates   uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Sps Pms5003Measurement
 
@@ -53,6 +52,11 @@ type DuetDataMk1Var3 struct {
 	RadioMeta RadioMetadata
 	TempRh    CombinedTempRhMeasurements
 
+	TempRhFusion string
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -68,17 +72,72 @@ func (d *DuetDataMk1Var3) Timestamp() uint32 {
 func (d *DuetDataMk1Var3) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk1Var3) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk1Var3) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk1Var3) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk1Var3) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk1Var3) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Sps, d.Si, d.Scd, d.Mprls, d.Sgp30, d.Sgp40, DuetSensorState{d.SensorStates}}
 }
 
+func (d *DuetDataMk1Var3) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.Sps, true
+	case SENSOR_SI7021:
+		return d.Si, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP30:
+		return d.Sgp30, true
+	case SENSOR_SGP40:
+		return d.Sgp40, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk1Var3) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
+
 func (d *DuetDataMk1Var3) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk1Var3) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk1Var3) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk1Var3) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk1Var3) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Scd.DirectoryName(), d.Scd}, {d.Si.DirectoryName(), d.Si}}
+}
+func (d *DuetDataMk1Var3) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk1Var3) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
 }
 func (d *DuetDataMk1Var3) String() string {
 	return fmt.Sprintf("[Duet %d, Type %d.%d | Unix %d | Si7021 %s | SCD41 %s | MPRLS: %s | SGP's: %s, %s | SPS30: %s | Radio: %s | Errstate %d ]",
@@ -236,6 +295,7 @@ func (d *DuetDataMk1Var3) ToMap(gatewaySerial string) map[string]any {
 		KEY_TVOC:    d.Sgp30.Tvoc,
 		"voc_index": d.Sgp40.VocIndex, // TODO
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Sps.ToMap("_t"))
 	maps.Copy(ret, d.Sps.ToMap("_b"))
 	maps.Copy(ret, d.Sps.ToMap("_m"))
@@ -244,9 +304,29 @@ func (d *DuetDataMk1Var3) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.TempRh.ToMap())
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk1Var3) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields("voc_index"),
+		d.Sgp30.FieldSpecs(),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps.FieldSpecs("_t"),
+		d.Sps.FieldSpecs("_b"),
+		d.Sps.FieldSpecs("_m"),
+		d.Si.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_TEMP_RH_FUSION)),
+		d.Gateway.FieldSpecs(),
+	)
+}
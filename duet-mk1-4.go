@@ -14,6 +14,7 @@ var DuetTypeMk1Var4 = DuetTypeInfo{
 	ExpectedStringLen:    11,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk1Var4{} },
 	TypeAlias:            "Mk1.4",
+	DeviceType:           DeviceType{1, 4},
 }
 
 /*
@@ -40,8 +41,6 @@ type DuetDataMk1Var4 struct {
 	LastResetUnix  uint32
 	SensorStates   uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Pt Pms5003Measurement
 
@@ -51,6 +50,9 @@ type DuetDataMk1Var4 struct {
 	Co2       PlantowerCo2Measurement
 	RadioMeta RadioMetadata
 
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -66,17 +68,60 @@ func (d *DuetDataMk1Var4) Timestamp() uint32 {
 func (d *DuetDataMk1Var4) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk1Var4) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk1Var4) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk1Var4) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk1Var4) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk1Var4) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Pt, d.Si, d.Co2, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
 
+func (d *DuetDataMk1Var4) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_PMS5003:
+		return d.Pt, true
+	case SENSOR_SI7021:
+		return d.Si, true
+	case SENSOR_PLANTOWER_CO2:
+		return d.Co2, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.Si.TempRh(), true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk1Var4) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
+
 func (d *DuetDataMk1Var4) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk1Var4) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk1Var4) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk1Var4) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
 }
 func (d *DuetDataMk1Var4) String() string {
 	return fmt.Sprintf("[Duet %d, Type %d.%d | Unix %d | Si7021 %s | PT CO2: %s | MPRLS: %s | SGP: %s | PT: %s | Radio: %s | Errstate %d ]",
@@ -226,6 +271,7 @@ func (d *DuetDataMk1Var4) ToMap(gatewaySerial string) map[string]any {
 		KEY_LAST_RESET_TIME: d.LastResetUnix,
 		KEY_GATEWAY_SERIAL:  gatewaySerial,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Pt.ToMap("_t"))
 	maps.Copy(ret, d.Pt.ToMap("_b"))
 	maps.Copy(ret, d.Pt.ToMap("_m"))
@@ -235,9 +281,24 @@ func (d *DuetDataMk1Var4) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
-	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk1Var4) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Pt.FieldSpecs("_t"),
+		d.Pt.FieldSpecs("_b"),
+		d.Pt.FieldSpecs("_m"),
+		d.Si.FieldSpecs(),
+		d.Si.TempRh().FieldSpecs(),
+		d.Co2.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		d.Gateway.FieldSpecs(),
+	)
+}
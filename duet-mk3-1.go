@@ -14,6 +14,7 @@ var DuetTypeMk3Var1 = DuetTypeInfo{
 	ExpectedStringLen:    13,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk3Var1{} },
 	TypeAlias:            "Mk3.1",
+	DeviceType:           DeviceType{3, 1},
 }
 
 type DuetDataMk3Var1 struct {
@@ -23,8 +24,6 @@ type DuetDataMk3Var1 struct {
 	LastResetUnix  uint32
 	SensorStates   uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Sps Pms5003Measurement
 
@@ -35,6 +34,11 @@ type DuetDataMk3Var1 struct {
 	Sgp       Sgp40Measurement
 	RadioMeta RadioMetadata
 
+	TempRhFusion string
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -50,17 +54,70 @@ func (d *DuetDataMk3Var1) Timestamp() uint32 {
 func (d *DuetDataMk3Var1) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk3Var1) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk3Var1) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk3Var1) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk3Var1) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk3Var1) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Sps, d.Htu, d.Scd, d.TempRh, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
 
+func (d *DuetDataMk3Var1) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.Sps, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk3Var1) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
+
 func (d *DuetDataMk3Var1) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk3Var1) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk3Var1) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk3Var1) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk3Var1) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk3Var1) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk3Var1) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
 }
 func (d *DuetDataMk3Var1) String() string {
 	return fmt.Sprintf("[Duet %d, Type %d.%d | Unix %d | HTU %s | SCD: %s | TempRH: %s | MPRLS: %s | SGP: %s | SPS30: %s | Radio: %s | Errstate %d ]",
@@ -214,6 +271,7 @@ func (d *DuetDataMk3Var1) ToMap(gatewaySerial string) map[string]any {
 		KEY_LAST_RESET_TIME: d.LastResetUnix,
 		KEY_GATEWAY_SERIAL:  gatewaySerial,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Sps.ToMap("_t"))
 	maps.Copy(ret, d.Sps.ToMap("_b"))
 	maps.Copy(ret, d.Sps.ToMap("_m"))
@@ -223,9 +281,28 @@ func (d *DuetDataMk3Var1) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk3Var1) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps.FieldSpecs("_t"),
+		d.Sps.FieldSpecs("_b"),
+		d.Sps.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_TEMP_RH_FUSION)),
+		d.Gateway.FieldSpecs(),
+	)
+}
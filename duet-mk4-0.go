@@ -19,6 +19,7 @@ var DuetTypeMk4Var0 = DuetTypeInfo{
 	ExpectedStringLen:    15,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var0{} },
 	TypeAlias:            "Mk4.0",
+	DeviceType:           DeviceType{4, 0},
 }
 
 type DuetDataMk4Var0 struct {
@@ -29,8 +30,6 @@ type DuetDataMk4Var0 struct {
 	SensorStates   uint8
 	PoeUsbVoltage  uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Pt1       Pms5003Measurement
 	Pt2       Pms5003Measurement
@@ -42,6 +41,14 @@ type DuetDataMk4Var0 struct {
 	Sgp       Sgp40Measurement
 	RadioMeta RadioMetadata
 
+	TempRhFusion string
+
+	OpcMerge      string
+	OpcMergeRules OpcMergeDiagnostics
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -57,17 +64,77 @@ func (d *DuetDataMk4Var0) Timestamp() uint32 {
 func (d *DuetDataMk4Var0) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk4Var0) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var0) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var0) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var0) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk4Var0) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.PtM, d.TempRh, d.Scd, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
 
+func (d *DuetDataMk4Var0) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_PMS5003:
+		return d.PtM, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var0) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
+
 func (d *DuetDataMk4Var0) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk4Var0) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var0) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var0) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var0) OpcChannels() (opc1, opc2, merged *Pms5003Measurement) {
+	return &d.Pt1, &d.Pt2, &d.PtM
+}
+func (d *DuetDataMk4Var0) SetOpcMerge(strategy string, diag OpcMergeDiagnostics) {
+	d.OpcMerge = strategy
+	d.OpcMergeRules = diag
+}
+func (d *DuetDataMk4Var0) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var0) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var0) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
 }
 func (d *DuetDataMk4Var0) String() string {
 	return fmt.Sprintf("[Duet %d, Type %d.%d | Unix %d | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | PT1: %s | PT2: %s | PTM: %s | Radio: %s | Errstate %d | PoE Voltage %d]",
@@ -235,6 +302,7 @@ func (d *DuetDataMk4Var0) ToMap(gatewaySerial string) map[string]any {
 		KEY_GATEWAY_SERIAL:  gatewaySerial,
 		KEY_POE_USB_VOLTAGE: d.PoeUsbVoltage,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Pt1.ToMap("_t"))
 	maps.Copy(ret, d.Pt2.ToMap("_b"))
 	maps.Copy(ret, d.PtM.ToMap("_m"))
@@ -244,9 +312,34 @@ func (d *DuetDataMk4Var0) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
+	}
+	if d.OpcMerge != "" {
+		ret[KEY_OPC_MERGE] = d.OpcMerge
+		d.OpcMergeRules.toMap(ret)
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk4Var0) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Pt1.FieldSpecs("_t"),
+		d.Pt2.FieldSpecs("_b"),
+		d.PtM.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_TEMP_RH_FUSION)),
+		opcMergeFieldSpecs(opcMergeFields),
+		d.Gateway.FieldSpecs(),
+	)
+}
@@ -14,6 +14,7 @@ var DuetTypeMk4Var1 = DuetTypeInfo{
 	ExpectedStringLen:    15,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var1{} },
 	TypeAlias:            "Mk4.1",
+	DeviceType:           DeviceType{4, 1},
 }
 
 type DuetDataMk4Var1 struct {
@@ -24,8 +25,6 @@ type DuetDataMk4Var1 struct {
 	SensorStates   uint8
 	PoeUsbVoltage  uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Sps1      Sps30Measurement
 	Sps2      Sps30Measurement
@@ -37,6 +36,14 @@ type DuetDataMk4Var1 struct {
 	Sgp       Sgp40Measurement
 	RadioMeta RadioMetadata
 
+	TempRhFusion string
+
+	OpcMerge      string
+	OpcMergeRules OpcMergeDiagnostics
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -52,17 +59,77 @@ func (d *DuetDataMk4Var1) Timestamp() uint32 {
 func (d *DuetDataMk4Var1) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk4Var1) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var1) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var1) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var1) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk4Var1) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.SpsM, d.TempRh, d.Scd, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
 
+func (d *DuetDataMk4Var1) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.SpsM, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var1) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
+
 func (d *DuetDataMk4Var1) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk4Var1) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var1) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var1) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var1) OpcChannels() (opc1, opc2, merged *Pms5003Measurement) {
+	return &d.Sps1, &d.Sps2, &d.SpsM
+}
+func (d *DuetDataMk4Var1) SetOpcMerge(strategy string, diag OpcMergeDiagnostics) {
+	d.OpcMerge = strategy
+	d.OpcMergeRules = diag
+}
+func (d *DuetDataMk4Var1) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var1) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var1) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
 }
 func (d *DuetDataMk4Var1) String() string {
 	return fmt.Sprintf("[Duet %d, Type 4.1 | Unix %d | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | PT1: %s | PT2: %s | PTM: %s | Radio: %s | Errstate %d | PoE Voltage %d]",
@@ -230,6 +297,7 @@ func (d *DuetDataMk4Var1) ToMap(gatewaySerial string) map[string]any {
 		KEY_GATEWAY_SERIAL:  gatewaySerial,
 		KEY_POE_USB_VOLTAGE: d.PoeUsbVoltage,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Sps1.ToMap("_t"))
 	maps.Copy(ret, d.Sps2.ToMap("_b"))
 	maps.Copy(ret, d.SpsM.ToMap("_m"))
@@ -239,9 +307,34 @@ func (d *DuetDataMk4Var1) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
+	}
+	if d.OpcMerge != "" {
+		ret[KEY_OPC_MERGE] = d.OpcMerge
+		d.OpcMergeRules.toMap(ret)
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk4Var1) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps1.FieldSpecs("_t"),
+		d.Sps2.FieldSpecs("_b"),
+		d.SpsM.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_TEMP_RH_FUSION)),
+		opcMergeFieldSpecs(opcMergeFields),
+		d.Gateway.FieldSpecs(),
+	)
+}
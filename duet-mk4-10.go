@@ -14,6 +14,7 @@ var DuetTypeMk4Var10 = DuetTypeInfo{
 	ExpectedStringLen:    18,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var10{} },
 	TypeAlias:            "Mk4.10",
+	DeviceType:           DeviceType{4, 10},
 }
 
 type DuetDataMk4Var10 struct {
@@ -24,8 +25,6 @@ type DuetDataMk4Var10 struct {
 	SensorStates   uint8
 	PoeUsbVoltage  uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Sps       Sps30Measurement
 	Scd       Scd41Measurement
@@ -40,6 +39,14 @@ type DuetDataMk4Var10 struct {
 
 	Tgs2611_Rs, Tgs2600_Rs float32
 
+	Ch4Estimate    float32
+	ch4EstimateSet bool
+
+	TempRhFusion string
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -55,16 +62,81 @@ func (d *DuetDataMk4Var10) Timestamp() uint32 {
 func (d *DuetDataMk4Var10) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk4Var10) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var10) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var10) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var10) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk4Var10) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Sps, d.TempRh, d.Scd, d.Mprls, d.Sgp, &d.Gas, DuetSensorState{d.SensorStates}} // TODO add TGS
 }
+
+func (d *DuetDataMk4Var10) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.Sps, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_GAS:
+		return d.Gas, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var10) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
 func (d *DuetDataMk4Var10) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk4Var10) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var10) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var10) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var10) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var10) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var10) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
+}
+func (d *DuetDataMk4Var10) Tgs2611Resistances() []float32 {
+	return []float32{d.Tgs2611_Rs}
+}
+func (d *DuetDataMk4Var10) SetCh4Estimate(ppm float32) {
+	d.Ch4Estimate = ppm
+	d.ch4EstimateSet = true
+}
+func (d *DuetDataMk4Var10) Tgs2600Resistance() float32 {
+	return d.Tgs2600_Rs
 }
 func (d *DuetDataMk4Var10) String() string {
 	return fmt.Sprintf("[Duet %d, Type 4.10 | Unix %d | Co %.2f, NO2: %.2f | TGS %.3f & %.3f | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | SPS30 (as PMS5003): [%s] | Radio: %s | Errstate %d | PoE Voltage %d]",
@@ -270,6 +342,7 @@ func (d *DuetDataMk4Var10) ToMap(gatewaySerial string) map[string]any {
 		KEY_TGS2611_RS:      d.Tgs2611_Rs,
 		KEY_TGS2600_RS:      d.Tgs2600_Rs,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Sps.ToMap("_t"))
 	maps.Copy(ret, d.Sps.ToMap("_b"))
 	maps.Copy(ret, d.Sps.ToMap("_m"))
@@ -279,9 +352,32 @@ func (d *DuetDataMk4Var10) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.ch4EstimateSet {
+		ret[KEY_CH4_ESTIMATE] = d.Ch4Estimate
+	}
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk4Var10) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE, KEY_GAS_CO, KEY_GAS_NO2, KEY_TGS2611_RS, KEY_TGS2600_RS),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps.FieldSpecs("_t"),
+		d.Sps.FieldSpecs("_b"),
+		d.Sps.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_CH4_ESTIMATE, KEY_TEMP_RH_FUSION)),
+		d.Gateway.FieldSpecs(),
+	)
+}
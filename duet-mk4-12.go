@@ -14,6 +14,7 @@ var DuetTypeMk4Var12 = DuetTypeInfo{
 	ExpectedStringLen:    16,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var12{} },
 	TypeAlias:            "Mk4.12",
+	DeviceType:           DeviceType{4, 12},
 }
 
 type DuetDataMk4Var12 struct {
@@ -24,8 +25,6 @@ type DuetDataMk4Var12 struct {
 	SensorStates   uint8
 	PoeUsbVoltage  uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Sps       Sps30Measurement
 	Scd       Scd41Measurement
@@ -37,6 +36,11 @@ type DuetDataMk4Var12 struct {
 
 	Latitude, Longitude float32
 
+	TempRhFusion string
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -52,16 +56,72 @@ func (d *DuetDataMk4Var12) Timestamp() uint32 {
 func (d *DuetDataMk4Var12) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk4Var12) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var12) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var12) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var12) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk4Var12) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Sps, d.TempRh, d.Scd, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
+
+func (d *DuetDataMk4Var12) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.Sps, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var12) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
 func (d *DuetDataMk4Var12) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk4Var12) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var12) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var12) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var12) Location() (lat, lon float32) {
+	return d.Latitude, d.Longitude
+}
+func (d *DuetDataMk4Var12) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var12) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var12) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
 }
 func (d *DuetDataMk4Var12) String() string {
 	return fmt.Sprintf("[Duet %d, Type 4.12 | Unix %d | (%.f,%.f) | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | SPS: %s | Radio: %s | Errstate %d | PoE Voltage %d]",
@@ -240,6 +300,7 @@ func (d *DuetDataMk4Var12) ToMap(gatewaySerial string) map[string]any {
 		KEY_LATITUDE:        d.Latitude,
 		KEY_LONGITUDE:       d.Longitude,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Sps.ToMap("_t"))
 	maps.Copy(ret, d.Sps.ToMap("_b"))
 	maps.Copy(ret, d.Sps.ToMap("_m"))
@@ -249,9 +310,29 @@ func (d *DuetDataMk4Var12) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk4Var12) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE, KEY_LATITUDE, KEY_LONGITUDE),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps.FieldSpecs("_t"),
+		d.Sps.FieldSpecs("_b"),
+		d.Sps.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_TEMP_RH_FUSION)),
+		d.Gateway.FieldSpecs(),
+	)
+}
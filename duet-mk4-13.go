@@ -14,6 +14,7 @@ var DuetTypeMk4Var13 = DuetTypeInfo{
 	ExpectedStringLen:    21,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var13{} },
 	TypeAlias:            "Mk4.13",
+	DeviceType:           DeviceType{4, 13},
 }
 
 type DuetDataMk4Var13 struct {
@@ -24,8 +25,6 @@ type DuetDataMk4Var13 struct {
 	SensorStates   uint8
 	PoeUsbVoltage  uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Sps       Sps30Measurement
 	Scd       Scd41Measurement
@@ -38,6 +37,14 @@ type DuetDataMk4Var13 struct {
 	Co, No, No2, Ch2o, H2s float32
 	Tgs2611, Tgs2600       float32 // TODO: What are these called and also make a struct for it
 
+	Ch4Estimate    float32
+	ch4EstimateSet bool
+
+	TempRhFusion string
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -53,17 +60,89 @@ func (d *DuetDataMk4Var13) Timestamp() uint32 {
 func (d *DuetDataMk4Var13) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk4Var13) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var13) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var13) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var13) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk4Var13) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Sps, d.TempRh, d.Scd, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 } // TODO: See Tgs and gas
 
 func (d *DuetDataMk4Var13) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
+
+func (d *DuetDataMk4Var13) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.Sps, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_GAS:
+		return GasSensorsMeasurement{
+			SensorBitField: gasSensorBits(KEY_GAS_CO, KEY_GAS_NO, KEY_GAS_NO2, KEY_GAS_CH2O, KEY_GAS_H2S),
+			Co:             d.Co,
+			No:             d.No,
+			No2:            d.No2,
+			Ch2o:           d.Ch2o,
+			H2s:            d.H2s,
+		}, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var13) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
 func (d *DuetDataMk4Var13) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var13) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var13) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var13) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var13) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var13) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
+}
+func (d *DuetDataMk4Var13) Tgs2611Resistances() []float32 {
+	return []float32{d.Tgs2611}
+}
+func (d *DuetDataMk4Var13) SetCh4Estimate(ppm float32) {
+	d.Ch4Estimate = ppm
+	d.ch4EstimateSet = true
+}
+func (d *DuetDataMk4Var13) Tgs2600Resistance() float32 {
+	return d.Tgs2600
 }
 func (d *DuetDataMk4Var13) String() string {
 	return fmt.Sprintf("[Duet %d, Type 4.13 | Unix %d | Co %.3f, No: %.3f, No2: %.3f, Ch2o: %.3f, H2s: %.3f | TGS 2611: %.3f, 2600: %.3f | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | SPS30: %s | Radio: %s | Errstate %d | PoE Voltage %d]",
@@ -340,6 +419,7 @@ func (d *DuetDataMk4Var13) ToMap(gatewaySerial string) map[string]any {
 		KEY_TGS2611_RS:      d.Tgs2611,
 		KEY_TGS2600_RS:      d.Tgs2600,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Sps.ToMap("_t"))
 	maps.Copy(ret, d.Sps.ToMap("_b"))
 	maps.Copy(ret, d.Sps.ToMap("_m"))
@@ -349,9 +429,32 @@ func (d *DuetDataMk4Var13) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.ch4EstimateSet {
+		ret[KEY_CH4_ESTIMATE] = d.Ch4Estimate
+	}
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk4Var13) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE, KEY_GAS_CO, KEY_GAS_NO, KEY_GAS_NO2, KEY_GAS_CH2O, KEY_GAS_H2S, KEY_TGS2611_RS, KEY_TGS2600_RS),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps.FieldSpecs("_t"),
+		d.Sps.FieldSpecs("_b"),
+		d.Sps.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_CH4_ESTIMATE, KEY_TEMP_RH_FUSION)),
+		d.Gateway.FieldSpecs(),
+	)
+}
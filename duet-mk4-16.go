@@ -14,6 +14,7 @@ var DuetTypeMk4Var16 = DuetTypeInfo{
 	ExpectedStringLen:    16,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var16{} },
 	TypeAlias:            "Mk4.16",
+	DeviceType:           DeviceType{4, 16},
 }
 
 type DuetDataMk4Var16 struct {
@@ -24,8 +25,6 @@ type DuetDataMk4Var16 struct {
 	SensorStates   uint8
 	PoeUsbVoltage  uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Pt1       Pms5003Measurement
 	Pt2       Pms5003Measurement
@@ -39,6 +38,14 @@ type DuetDataMk4Var16 struct {
 
 	Fs3000Velocity float32
 
+	TempRhFusion string
+
+	OpcMerge      string
+	OpcMergeRules OpcMergeDiagnostics
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -54,16 +61,79 @@ func (d *DuetDataMk4Var16) Timestamp() uint32 {
 func (d *DuetDataMk4Var16) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk4Var16) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var16) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var16) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var16) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk4Var16) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.PtM, d.TempRh, d.Scd, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
+
+func (d *DuetDataMk4Var16) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_PMS5003:
+		return d.PtM, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var16) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
 func (d *DuetDataMk4Var16) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk4Var16) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var16) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var16) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var16) AirVelocity() float32 {
+	return d.Fs3000Velocity
+}
+func (d *DuetDataMk4Var16) OpcChannels() (opc1, opc2, merged *Pms5003Measurement) {
+	return &d.Pt1, &d.Pt2, &d.PtM
+}
+func (d *DuetDataMk4Var16) SetOpcMerge(strategy string, diag OpcMergeDiagnostics) {
+	d.OpcMerge = strategy
+	d.OpcMergeRules = diag
+}
+func (d *DuetDataMk4Var16) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var16) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var16) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
 }
 func (d *DuetDataMk4Var16) String() string {
 	return fmt.Sprintf("[Duet %d, Type 4.16 | Unix %d | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | FS: %.3fm/s | PT: %s | Radio: %s | Errstate %d | PoE Voltage %d]",
@@ -243,6 +313,7 @@ func (d *DuetDataMk4Var16) ToMap(gatewaySerial string) map[string]any {
 
 		KEY_FS3000_VELOCITY: d.Fs3000Velocity,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Pt1.ToMap("_t"))
 	maps.Copy(ret, d.Pt2.ToMap("_b"))
 	maps.Copy(ret, d.PtM.ToMap("_m"))
@@ -252,9 +323,34 @@ func (d *DuetDataMk4Var16) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
+	}
+	if d.OpcMerge != "" {
+		ret[KEY_OPC_MERGE] = d.OpcMerge
+		d.OpcMergeRules.toMap(ret)
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk4Var16) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE, KEY_FS3000_VELOCITY),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Pt1.FieldSpecs("_t"),
+		d.Pt2.FieldSpecs("_b"),
+		d.PtM.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_TEMP_RH_FUSION)),
+		opcMergeFieldSpecs(opcMergeFields),
+		d.Gateway.FieldSpecs(),
+	)
+}
@@ -14,6 +14,7 @@ var DuetTypeMk4Var21 = DuetTypeInfo{
 	ExpectedStringLen:    21,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var21{} },
 	TypeAlias:            "Mk4.21",
+	DeviceType:           DeviceType{4, 21},
 }
 
 type DuetDataMk4Var21 struct {
@@ -24,8 +25,6 @@ type DuetDataMk4Var21 struct {
 	SensorStates   uint8
 	PoeUsbVoltage  uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Sps       Sps30Measurement
 	Scd       Scd41Measurement
@@ -39,6 +38,14 @@ type DuetDataMk4Var21 struct {
 	TGS2611_Rs1 float32
 	TGS2611_Rs2 float32
 
+	Ch4Estimate    float32
+	ch4EstimateSet bool
+
+	TempRhFusion string
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -54,17 +61,86 @@ func (d *DuetDataMk4Var21) Timestamp() uint32 {
 func (d *DuetDataMk4Var21) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk4Var21) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var21) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var21) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var21) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk4Var21) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Sps, d.TempRh, d.Scd, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 } // TODO: See Tgs and gas
 
 func (d *DuetDataMk4Var21) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
+
+func (d *DuetDataMk4Var21) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.Sps, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_GAS:
+		return GasSensorsMeasurement{
+			SensorBitField: gasSensorBits(KEY_GAS_CO, KEY_GAS_NO, KEY_GAS_NO2, KEY_GAS_CH2O, KEY_GAS_H2S),
+			Co:             d.Co,
+			No:             d.No,
+			No2:            d.No2,
+			Ch2o:           d.Ch2o,
+			H2s:            d.H2s,
+		}, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var21) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
 func (d *DuetDataMk4Var21) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var21) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var21) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var21) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var21) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var21) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
+}
+func (d *DuetDataMk4Var21) Tgs2611Resistances() []float32 {
+	return []float32{d.TGS2611_Rs1, d.TGS2611_Rs2}
+}
+func (d *DuetDataMk4Var21) SetCh4Estimate(ppm float32) {
+	d.Ch4Estimate = ppm
+	d.ch4EstimateSet = true
 }
 func (d *DuetDataMk4Var21) String() string {
 	return fmt.Sprintf("[Duet %d, Type 4.21 | Unix %d | Co %.3f, No: %.3f, No2: %.3f, Ch2o: %.3f, H2s: %.3f | TGS2611 Rs: %.1f, %.1f | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | SPS30: %s | Radio: %s | Errstate %d | PoE Voltage %d]",
@@ -223,7 +299,7 @@ func (d *DuetDataMk4Var21) doPopulateFromSubStrings(splitStr []string) error {
 	}
 	idx += 1
 
-	// TGS2611
+	// Two TGS2611s
 	if tgs_rs1, err := strconv.ParseFloat(splitStr[idx], 32); err != nil {
 		return fmt.Errorf("failed to convert TGS2611 string, %s, to float32", splitStr[idx])
 	} else {
@@ -232,7 +308,7 @@ func (d *DuetDataMk4Var21) doPopulateFromSubStrings(splitStr []string) error {
 	idx += 1
 
 	if tgs_rs2, err := strconv.ParseFloat(splitStr[idx], 32); err != nil {
-		return fmt.Errorf("failed to convert TGS2600 string, %s, to float32", splitStr[idx])
+		return fmt.Errorf("failed to convert second TGS2611 string, %s, to float32", splitStr[idx])
 	} else {
 		d.TGS2611_Rs2 = float32(tgs_rs2)
 	}
@@ -340,6 +416,7 @@ func (d *DuetDataMk4Var21) ToMap(gatewaySerial string) map[string]any {
 		KEY_TGS2611_V2_RS1:      d.TGS2611_Rs1,
 		KEY_TGS2611_V2_RS2:      d.TGS2611_Rs2,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Sps.ToMap("_t"))
 	maps.Copy(ret, d.Sps.ToMap("_b"))
 	maps.Copy(ret, d.Sps.ToMap("_m"))
@@ -349,9 +426,32 @@ func (d *DuetDataMk4Var21) ToMap(gatewaySerial string) map[string]any {
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.ch4EstimateSet {
+		ret[KEY_CH4_ESTIMATE] = d.Ch4Estimate
+	}
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk4Var21) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE, KEY_GAS_CO, KEY_GAS_NO, KEY_GAS_NO2, KEY_GAS_CH2O, KEY_GAS_H2S, KEY_TGS2611_V2_RS1, KEY_TGS2611_V2_RS2),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps.FieldSpecs("_t"),
+		d.Sps.FieldSpecs("_b"),
+		d.Sps.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_CH4_ESTIMATE, KEY_TEMP_RH_FUSION)),
+		d.Gateway.FieldSpecs(),
+	)
+}
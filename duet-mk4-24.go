@@ -14,6 +14,7 @@ var DuetTypeMk4Var24 = DuetTypeInfo{
 	ExpectedStringLen:    19,
 	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var24{} },
 	TypeAlias:            "Mk4.24",
+	DeviceType:           DeviceType{4, 24},
 }
 
 type DuetDataMk4Var24 struct {
@@ -24,8 +25,6 @@ type DuetDataMk4Var24 struct {
 	SensorStates   uint8
 	PoeUsbVoltage  uint8
 	ConnectionType int
-	PiMcuTemp      float32
-	piMcuTempSet   bool
 
 	Opc       AlphasenseOpcN3Measurement
 	Scd       Scd41Measurement
@@ -35,6 +34,11 @@ type DuetDataMk4Var24 struct {
 	Sgp       Sgp40Measurement
 	RadioMeta RadioMetadata
 
+	TempRhFusion string
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
 	timeResolved bool
 }
 
@@ -50,16 +54,69 @@ func (d *DuetDataMk4Var24) Timestamp() uint32 {
 func (d *DuetDataMk4Var24) ResolveTime(t uint32) {
 	d.UnixSec = t
 }
+func (d *DuetDataMk4Var24) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var24) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var24) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var24) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
 
 func (d *DuetDataMk4Var24) SensorMeasurements() []SensorMeasurement {
 	return []SensorMeasurement{d.Opc, d.TempRh, d.Scd, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
 }
+
+func (d *DuetDataMk4Var24) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_OPC_N3:
+		return d.Opc, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var24) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
 func (d *DuetDataMk4Var24) SetRadioData(v RadioMetadata) {
+	v.Present = true
 	d.RadioMeta = v
 }
 func (d *DuetDataMk4Var24) SetPiMcuTemp(val float32) {
 	d.PiMcuTemp = val
-	d.piMcuTempSet = true
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var24) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var24) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var24) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var24) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var24) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
 }
 func (d *DuetDataMk4Var24) String() string {
 	return fmt.Sprintf("[Duet %d, Type 4.24 | Unix %d | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | OPC: %s | Radio: %s | Errstate %d | PoE Voltage %d]",
@@ -225,6 +282,23 @@ func (d *DuetDataMk4Var24) doPopulateFromSubStrings(splitStr []string) error {
 
 	return nil
 }
+
+/*
+	typedef struct __attribute__((packed, aligned(4))) {
+	  uint8_t sensorStates;
+	  uint8_t poeUsbVoltage;
+	  uint16_t id;
+	  uint16_t co2;
+	  uint32_t vocIndex;
+	  uint32_t sample_time;
+	  float htuTemp, scdTemp, htuHum, scdHum, pressure;
+	  float opcTemp, opcRh, pm1, pm2p5, pm10;
+	  float bins[24];
+	  uint8_t _[2]; // padding
+	  float sampleFlowRate;  // newer firmware only
+	  float samplingPeriod;  // newer firmware only
+	} duet_sensor_reading_mk4_24_t;
+*/
 func (d *DuetDataMk4Var24) doPopulateFromBytes(buff []byte) error {
 	d.SensorStates = buff[0]
 	d.PoeUsbVoltage = buff[1]
@@ -233,7 +307,7 @@ func (d *DuetDataMk4Var24) doPopulateFromBytes(buff []byte) error {
 	d.Sgp.VocIndex = binary.LittleEndian.Uint32(buff[6:10])
 	d.SampleTimeMs = binary.LittleEndian.Uint32(buff[10:14])
 
-	reader := bytes.NewReader(buff[14:34])
+	reader := bytes.NewReader(buff[14:150])
 	if err := binary.Read(reader, binary.LittleEndian, &d.Htu.Temp); err != nil {
 		return fmt.Errorf("error converting bytes to float: %w", err)
 	}
@@ -249,20 +323,13 @@ func (d *DuetDataMk4Var24) doPopulateFromBytes(buff []byte) error {
 	if err := binary.Read(reader, binary.LittleEndian, &d.Mprls.Pressure); err != nil {
 		return fmt.Errorf("error converting bytes to float: %w", err)
 	}
-	if err := binary.Read(reader, binary.LittleEndian, &d.Opc.Temp); err != nil {
-		return fmt.Errorf("error converting bytes to float: %w", err)
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &d.Opc.Rh); err != nil {
-		return fmt.Errorf("error converting bytes to float: %w", err)
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &d.Opc.PM1); err != nil {
-		return fmt.Errorf("error converting bytes to float: %w", err)
+	if err := d.Opc.PopulateFromBytesReader(reader); err != nil {
+		return fmt.Errorf("error parsing bytes for opcn3: %w", err)
 	}
-	if err := binary.Read(reader, binary.LittleEndian, &d.Opc.PM2p5); err != nil {
-		return fmt.Errorf("error converting bytes to float: %w", err)
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &d.Opc.PM10); err != nil {
-		return fmt.Errorf("error converting bytes to float: %w", err)
+	if len(buff) >= 160 {
+		if err := d.Opc.PopulateFlowFromBytesReader(bytes.NewReader(buff[152:160])); err != nil {
+			return fmt.Errorf("error parsing bytes for opcn3: %w", err)
+		}
 	}
 
 	CombineTempRhMeasurements(d.Htu, d.Scd, &d.TempRh)
@@ -283,20 +350,45 @@ func (d *DuetDataMk4Var24) ToMap(gatewaySerial string) map[string]any {
 		KEY_GATEWAY_SERIAL:  gatewaySerial,
 		KEY_POE_USB_VOLTAGE: d.PoeUsbVoltage,
 	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
 	maps.Copy(ret, d.Opc.ToMapPm("_t"))
 	maps.Copy(ret, d.Opc.ToMapPm("_b"))
 	maps.Copy(ret, d.Opc.ToMapPm("_m"))
 	maps.Copy(ret, d.Opc.ToMapBins())
 	maps.Copy(ret, d.Opc.ToMapTempRh())
+	maps.Copy(ret, d.Opc.ToMapFlow())
 	maps.Copy(ret, d.Htu.ToMap())
 	maps.Copy(ret, d.Scd.ToMap())
 	maps.Copy(ret, d.TempRh.ToMap())
 	maps.Copy(ret, d.Mprls.ToMap())
 	maps.Copy(ret, d.Sgp.ToMap())
 	maps.Copy(ret, d.RadioMeta.ToMap())
-	if d.piMcuTempSet {
-		ret[KEY_PI_MCU_TEMP] = d.PiMcuTemp
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
 	}
+	maps.Copy(ret, d.Gateway.ToMap())
 
 	return ret
 }
+
+func (d *DuetDataMk4Var24) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Opc.FieldSpecsPm("_t"),
+		d.Opc.FieldSpecsPm("_b"),
+		d.Opc.FieldSpecsPm("_m"),
+		d.Opc.FieldSpecsBins(),
+		d.Opc.FieldSpecsTempRh(),
+		d.Opc.FieldSpecsFlow(),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_TEMP_RH_FUSION)),
+		d.Gateway.FieldSpecs(),
+	)
+}
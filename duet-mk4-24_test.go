@@ -0,0 +1,66 @@
+package telosairduetcommon
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func mk4Var24TestPayload(nBytes int) []byte {
+	b := make([]byte, 2+nBytes)
+	b[0], b[1] = 4, 24
+	putFloat := func(off int, v float32) {
+		binary.LittleEndian.PutUint32(b[2+off:], math.Float32bits(v))
+	}
+	putFloat(14, 21.5)  // htu temp
+	putFloat(30, 101.3) // pressure
+	putFloat(34, 25.5)  // opc temp
+	putFloat(38, 40)    // opc rh
+	putFloat(42, 1.5)   // pm1
+	putFloat(46, 2.5)   // pm2.5
+	putFloat(50, 10.5)  // pm10
+	for i := 0; i < 24; i++ {
+		putFloat(54+4*i, float32(i)+0.25)
+	}
+	if nBytes >= 160 {
+		putFloat(152, 5.5)  // sample flow rate
+		putFloat(156, 1.25) // sampling period
+	}
+	return b
+}
+
+func TestMk4Var24PopulateFromBytes(t *testing.T) {
+	d, err := DuetDataFromRadioBytes(mk4Var24TestPayload(DuetTypeMk4Var24.ExpectedBytes), 1_000_000, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opc := d.(*DuetDataMk4Var24).Opc
+	if opc.Temp != 25.5 || opc.Rh != 40 || opc.PM1 != 1.5 || opc.PM2p5 != 2.5 || opc.PM10 != 10.5 {
+		t.Errorf("unexpected opc values: %s", opc.String())
+	}
+	for i, v := range opc.Bins {
+		if v != float32(i)+0.25 {
+			t.Errorf("bin %d = %f; want %f", i, v, float32(i)+0.25)
+		}
+	}
+	if p := d.(*DuetDataMk4Var24).Mprls.Pressure; p != 101.3 {
+		t.Errorf("pressure = %f; want 101.3", p)
+	}
+
+	m := d.ToMap("gw")
+	if v := m["opc_bin23"]; v != float32(23.25) {
+		t.Errorf("opc_bin23 = %v; want 23.25", v)
+	}
+	if _, ok := m[KEY_OPC_SAMPLE_FLOW_RATE]; ok {
+		t.Errorf("did not expect %s without flow data", KEY_OPC_SAMPLE_FLOW_RATE)
+	}
+
+	d, err = DuetDataFromRadioBytes(mk4Var24TestPayload(160), 1_000_000, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = d.ToMap("gw")
+	if m[KEY_OPC_SAMPLE_FLOW_RATE] != float32(5.5) || m[KEY_OPC_SAMPLING_PERIOD] != float32(1.25) {
+		t.Errorf("unexpected flow values: %v, %v", m[KEY_OPC_SAMPLE_FLOW_RATE], m[KEY_OPC_SAMPLING_PERIOD])
+	}
+}
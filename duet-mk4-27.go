@@ -0,0 +1,310 @@
+package telosairduetcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"strconv"
+)
+
+/* ~~ MK4 Var 27 (Indoor, 1 SPS30, float output) ~~ */
+var DuetTypeMk4Var27 = DuetTypeInfo{
+	ExpectedBytes:        74,
+	ExpectedStringLen:    14,
+	StructInstanceGetter: func() DuetData { return &DuetDataMk4Var27{} },
+	TypeAlias:            "Mk4.27",
+	DeviceType:           DeviceType{4, 27},
+}
+
+type DuetDataMk4Var27 struct {
+	SerialNumber   uint16
+	SampleTimeMs   uint32
+	UnixSec        uint32
+	LastResetUnix  uint32
+	SensorStates   uint8
+	PoeUsbVoltage  uint8
+	ConnectionType int
+
+	Sps       Sps30FloatMeasurement
+	Scd       Scd41Measurement
+	Htu       Htu21Measurement
+	TempRh    CombinedTempRhMeasurements
+	Mprls     MprlsMeasurement
+	Sgp       Sgp40Measurement
+	RadioMeta RadioMetadata
+
+	TempRhFusion string
+
+	// Deprecated: use GetGatewayTelemetry().PiCpuTemp. Kept in sync by SetPiMcuTemp and SetGatewayTelemetry.
+	PiMcuTemp    float32
+	Gateway      GatewayTelemetry
+	timeResolved bool
+}
+
+func (d *DuetDataMk4Var27) TimeResolved() bool {
+	return d.timeResolved
+}
+func (d *DuetDataMk4Var27) MarkTimeResolved(v bool) {
+	d.timeResolved = v
+}
+func (d *DuetDataMk4Var27) Timestamp() uint32 {
+	return d.UnixSec
+}
+func (d *DuetDataMk4Var27) ResolveTime(t uint32) {
+	d.UnixSec = t
+}
+func (d *DuetDataMk4Var27) GetSerialNumber() uint16 {
+	return d.SerialNumber
+}
+func (d *DuetDataMk4Var27) GetSampleTimeMs() uint32 {
+	return d.SampleTimeMs
+}
+func (d *DuetDataMk4Var27) GetLastResetUnix() uint32 {
+	return d.LastResetUnix
+}
+func (d *DuetDataMk4Var27) GetRadioData() RadioMetadata {
+	return d.RadioMeta
+}
+
+func (d *DuetDataMk4Var27) SensorMeasurements() []SensorMeasurement {
+	return []SensorMeasurement{d.Sps, d.TempRh, d.Scd, d.Mprls, d.Sgp, DuetSensorState{d.SensorStates}}
+}
+
+func (d *DuetDataMk4Var27) Measurement(kind SensorKind) (SensorMeasurement, bool) {
+	switch kind {
+	case SENSOR_SPS30:
+		return d.Sps, true
+	case SENSOR_HTU21:
+		return d.Htu, true
+	case SENSOR_SCD41:
+		return d.Scd, true
+	case SENSOR_SGP40:
+		return d.Sgp, true
+	case SENSOR_MPRLS:
+		return d.Mprls, true
+	case SENSOR_TEMP_RH:
+		return d.TempRh, true
+	}
+	return nil, false
+}
+
+func (d *DuetDataMk4Var27) HasSensor(kind SensorKind) bool {
+	_, ok := d.Measurement(kind)
+	return ok
+}
+
+func (d *DuetDataMk4Var27) SetRadioData(v RadioMetadata) {
+	v.Present = true
+	d.RadioMeta = v
+}
+func (d *DuetDataMk4Var27) SetPiMcuTemp(val float32) {
+	d.PiMcuTemp = val
+	d.Gateway.setCpuTemp(val)
+}
+func (d *DuetDataMk4Var27) SetGatewayTelemetry(t GatewayTelemetry) {
+	d.Gateway = t.attachedOver(d.Gateway)
+	d.PiMcuTemp = d.Gateway.PiCpuTemp
+}
+func (d *DuetDataMk4Var27) GetGatewayTelemetry() GatewayTelemetry {
+	return d.Gateway
+}
+func (d *DuetDataMk4Var27) TempRhSources() []TempRhSource {
+	return []TempRhSource{{d.Htu.DirectoryName(), d.Htu}, {d.Scd.DirectoryName(), d.Scd}}
+}
+func (d *DuetDataMk4Var27) SensorStateBits() uint8 {
+	return d.SensorStates
+}
+func (d *DuetDataMk4Var27) SetFusedTempRh(m CombinedTempRhMeasurements, strategy string) {
+	d.TempRh = m
+	d.TempRhFusion = strategy
+}
+func (d *DuetDataMk4Var27) String() string {
+	return fmt.Sprintf("[Duet %d, Type 4.27 | Unix %d | %s | HTU: %s | SCD: %s | MPRLS: %s | SGP: %s | SPS30: %s | Radio: %s | Errstate %d | PoE Voltage %d]",
+		d.SerialNumber, d.UnixSec, d.TempRh.String(), d.Htu.String(), d.Scd.String(), d.Mprls.String(), d.Sgp.String(), d.Sps.String(),
+		d.RadioMeta.String(), d.SensorStates, d.PoeUsbVoltage)
+}
+func (d *DuetDataMk4Var27) GetTypeInfo() DuetTypeInfo {
+	return DuetTypeMk4Var27
+}
+
+func (d *DuetDataMk4Var27) SetConnectionType(ct int) {
+	d.ConnectionType = ct
+}
+func (d *DuetDataMk4Var27) SetTimeRadio(unixSecRecieved uint32) error {
+	if (d.RadioMeta.RadioSentTimeMs < d.SampleTimeMs) || (unixSecRecieved*d.RadioMeta.RadioSentTimeMs*unixSecRecieved == 0) {
+		return fmt.Errorf("incompatible timekeeping parameters: unix: %d, radio sent ms: %d, sample ms: %d", unixSecRecieved, d.RadioMeta.RadioSentTimeMs, d.SampleTimeMs)
+	}
+	d.UnixSec = unixSecRecieved - ((d.RadioMeta.RadioSentTimeMs - d.SampleTimeMs) / 1000)
+	return nil
+}
+
+func (d *DuetDataMk4Var27) SetTimeSerial(unixSecRecieved uint32) {
+	d.UnixSec = unixSecRecieved
+}
+
+func (d *DuetDataMk4Var27) RecalculateLastResetUnix() {
+	d.LastResetUnix = d.UnixSec - (d.SampleTimeMs / 1000)
+}
+
+func (d *DuetDataMk4Var27) doPopulateFromSubStrings(splitStr []string) error {
+	// Serial Number
+	sn, err := strconv.ParseUint(splitStr[0], 10, 16)
+	if err != nil {
+		return fmt.Errorf("failed to convert DuetSerialNumber string, %s, to uint32", splitStr[0])
+	}
+	d.SerialNumber = uint16(sn)
+
+	// Sample Time
+	st, err := strconv.ParseUint(splitStr[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("failed to convert SampleTime string, %s, to uint32", splitStr[1])
+	}
+	d.SampleTimeMs = uint32(st)
+
+	// Sensirion SPS30 (float)
+	if err := d.Sps.FromSerialString(splitStr[2]); err != nil {
+		return fmt.Errorf("failed to convert Sps string, %s, to Sps30FloatMeasurement: %w", splitStr[2], err)
+	}
+
+	// Temperatures (1 & 2)
+	if temp, err := strconv.ParseFloat(splitStr[3], 32); err != nil {
+		return fmt.Errorf("failed to convert htu temp string, %s, to float32", splitStr[3])
+	} else {
+		d.Htu.Temp = float32(temp)
+	}
+
+	if temp, err := strconv.ParseFloat(splitStr[4], 32); err != nil {
+		return fmt.Errorf("failed to convert scd temp string, %s, to float32", splitStr[4])
+	} else {
+		d.Scd.Temp = float32(temp)
+	}
+
+	// Humidities (1 & 2)
+	if hum, err := strconv.ParseFloat(splitStr[5], 32); err != nil {
+		return fmt.Errorf("failed to convert htu hum string, %s, to float32", splitStr[5])
+	} else {
+		d.Htu.Hum = float32(hum)
+	}
+
+	if hum, err := strconv.ParseFloat(splitStr[6], 32); err != nil {
+		return fmt.Errorf("failed to convert scd hum string, %s, to float32", splitStr[6])
+	} else {
+		d.Scd.Hum = float32(hum)
+	}
+
+	// Pressure
+	if press, err := strconv.ParseFloat(splitStr[7], 32); err != nil {
+		return fmt.Errorf("failed to convert pressure string, %s, to float32", splitStr[7])
+	} else {
+		d.Mprls.Pressure = float32(press)
+	}
+
+	// VOC Index
+	if voc, err := strconv.ParseUint(splitStr[8], 10, 32); err != nil {
+		return fmt.Errorf("failed to convert voc index string, %s, to uint32", splitStr[8])
+	} else {
+		d.Sgp.VocIndex = uint32(voc)
+	}
+
+	// CO2
+	if co2, err := strconv.ParseUint(splitStr[9], 10, 16); err != nil {
+		return fmt.Errorf("failed to convert co2 string, %s, to uint32", splitStr[9])
+	} else {
+		d.Scd.Co2 = uint16(co2)
+	}
+
+	// PoE / USB Voltage
+	if voltage, err := strconv.ParseUint(splitStr[10], 10, 8); err != nil {
+		return fmt.Errorf("failed to convert voltage string, %s, to uint8", splitStr[10])
+	} else {
+		d.PoeUsbVoltage = uint8(voltage)
+	}
+
+	// Sensor States
+	if sensorStates, err := strconv.ParseUint(splitStr[11], 10, 8); err != nil {
+		return fmt.Errorf("failed to convert states string, %s, to uint8", splitStr[11])
+	} else {
+		d.SensorStates = uint8(sensorStates)
+	}
+	CombineTempRhMeasurements(d.Htu, d.Scd, &d.TempRh)
+
+	return nil
+}
+func (d *DuetDataMk4Var27) doPopulateFromBytes(buff []byte) error {
+	d.SensorStates = buff[0]
+	d.PoeUsbVoltage = buff[1]
+	d.SerialNumber = binary.LittleEndian.Uint16(buff[2:4])
+	d.Scd.Co2 = binary.LittleEndian.Uint16(buff[4:6])
+	d.Sgp.VocIndex = binary.LittleEndian.Uint32(buff[6:10])
+	d.SampleTimeMs = binary.LittleEndian.Uint32(buff[10:14])
+
+	reader := bytes.NewReader(buff[14:34])
+	if err := binary.Read(reader, binary.LittleEndian, &d.Htu.Temp); err != nil {
+		return fmt.Errorf("error converting bytes to float: %w", err)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &d.Scd.Temp); err != nil {
+		return fmt.Errorf("error converting bytes to float: %w", err)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &d.Htu.Hum); err != nil {
+		return fmt.Errorf("error converting bytes to float: %w", err)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &d.Scd.Hum); err != nil {
+		return fmt.Errorf("error converting bytes to float: %w", err)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &d.Mprls.Pressure); err != nil {
+		return fmt.Errorf("error converting bytes to float: %w", err)
+	}
+	if err := d.Sps.PopulateFromBytes(buff[34:74]); err != nil {
+		return fmt.Errorf("error parsing bytes for SPS30: %w", err)
+	}
+	CombineTempRhMeasurements(d.Htu, d.Scd, &d.TempRh)
+
+	return nil
+}
+func (d *DuetDataMk4Var27) ToMap(gatewaySerial string) map[string]any {
+	ret := map[string]any{
+		KEY_DEVICE_TYPE:     4.27,
+		KEY_SERIAL_NUMBER:   d.SerialNumber,
+		KEY_DEVICE_ID:       d.SerialNumber,
+		KEY_UNIX:            d.UnixSec,
+		KEY_ECO2:            0,
+		KEY_RAWH2:           0,
+		KEY_SENSOR_STATES:   d.SensorStates,
+		KEY_CONNECTION_TYPE: d.ConnectionType,
+		KEY_LAST_RESET_TIME: d.LastResetUnix,
+		KEY_GATEWAY_SERIAL:  gatewaySerial,
+		KEY_POE_USB_VOLTAGE: d.PoeUsbVoltage,
+	}
+	maps.Copy(ret, d.GetTypeInfo().DeviceType.ToMap())
+	maps.Copy(ret, d.Sps.ToMap("_m"))
+	maps.Copy(ret, d.Htu.ToMap())
+	maps.Copy(ret, d.Scd.ToMap())
+	maps.Copy(ret, d.TempRh.ToMap())
+	maps.Copy(ret, d.Mprls.ToMap())
+	maps.Copy(ret, d.Sgp.ToMap())
+	maps.Copy(ret, d.RadioMeta.ToMap())
+	if d.TempRhFusion != "" {
+		ret[KEY_TEMP_RH_FUSION] = d.TempRhFusion
+	}
+	maps.Copy(ret, d.Gateway.ToMap())
+
+	return ret
+}
+
+func (d *DuetDataMk4Var27) FieldSpecs() []FieldSpec {
+	return joinFields(
+		duetHeaderFields(),
+		sampleFields(KEY_POE_USB_VOLTAGE),
+		d.GetTypeInfo().DeviceType.FieldSpecs(),
+		d.Sps.FieldSpecs("_m"),
+		d.Htu.FieldSpecs(),
+		d.Scd.FieldSpecs(),
+		d.TempRh.FieldSpecs(),
+		d.Mprls.FieldSpecs(),
+		d.Sgp.FieldSpecs(),
+		d.RadioMeta.FieldSpecs(),
+		optionalFields(sampleFields(KEY_TEMP_RH_FUSION)),
+		d.Gateway.FieldSpecs(),
+	)
+}
@@ -0,0 +1,75 @@
+package telosairduetcommon
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func mk4Var28TestPayload(sps1, sps2 [SPS30_FLOAT_VALUE_LEN]float32) []byte {
+	b := make([]byte, 2+DuetTypeMk4Var28.ExpectedBytes)
+	b[0], b[1] = 4, 28
+	putFloat := func(off int, v float32) {
+		binary.LittleEndian.PutUint32(b[2+off:], math.Float32bits(v))
+	}
+	putFloat(14, 21.5)  // htu temp
+	putFloat(30, 101.3) // pressure
+	for i := range sps1 {
+		putFloat(34+4*i, sps1[i])
+		putFloat(74+4*i, sps2[i])
+	}
+	return b
+}
+
+func TestMk4Var28PopulateFromBytes(t *testing.T) {
+	sps1 := [SPS30_FLOAT_VALUE_LEN]float32{0.4, 1.2, 1.6, 2.0, 10, 12, 13, 13.5, 14, 0.55}
+	sps2 := [SPS30_FLOAT_VALUE_LEN]float32{0.6, 1.4, 1.8, 2.2, 11, 12, 13, 13.5, 14, 0.45}
+	d, err := DuetDataFromRadioBytes(mk4Var28TestPayload(sps1, sps2), 1_000_000, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dd := d.(*DuetDataMk4Var28)
+	if dd.Sps1.PM2p5 != 1.2 || dd.Sps1.PM4 != 1.6 || dd.Sps2.TypicalSize != 0.45 {
+		t.Errorf("unexpected sps30 values: %s | %s", dd.Sps1.String(), dd.Sps2.String())
+	}
+	if p := dd.Mprls.Pressure; p != 101.3 {
+		t.Errorf("pressure = %f; want 101.3", p)
+	}
+
+	m := d.ToMap("gw")
+	if v := m["pm25_m"].(float32); math.Abs(float64(v)-1.3) > 1e-6 {
+		t.Errorf("pm25_m = %v; want 1.3", v)
+	}
+	if v := m["pm40_t"]; v != float32(1.6) {
+		t.Errorf("pm40_t = %v; want 1.6", v)
+	}
+	if _, ok := m[KEY_PREFIX_TYP_SIZE+"_m"]; !ok {
+		t.Errorf("missing %s_m", KEY_PREFIX_TYP_SIZE)
+	}
+
+	diag, ok := ApplyOpcMerge(d, HealthierOpcMerge{FaultBits1: 1, FaultBits2: 2})
+	if !ok {
+		t.Fatal("ApplyOpcMerge failed for a dual sps30 (float) variant")
+	}
+	if diag["pm25"] != MERGE_RULE_MEAN || dd.OpcMerge != "healthier_sensor" {
+		t.Errorf("unexpected merge: %s, %v", dd.OpcMerge, diag)
+	}
+	if diag, ok := ApplyOpcMerge(d, NewMedianHistoryOpcMerge()); !ok || dd.OpcMerge != "median_history" || len(diag) != len(sps30FloatMergeFields) {
+		t.Errorf("median history merge of float channels: %s, %v, %v", dd.OpcMerge, diag, ok)
+	}
+	if _, ok := ApplyOpcMerge(d, struct{ OpcMergeStrategy }{LegacyOpcMerge{}}); ok {
+		t.Error("expected a uint16-only strategy to be refused for float channels")
+	}
+}
+
+func TestMk4Var27PopulateFromSerialString(t *testing.T) {
+	s := "4 27 512 60000 [0.4,1.2,1.6,2.0,10,12,13,13.5,14,0.55] 21.5 22.0 40.1 41.2 101.3 100 650 50 0"
+	d, err := DuetDataFromSerialString(s, 1_000_000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dd := d.(*DuetDataMk4Var27)
+	if dd.SerialNumber != 512 || dd.Sps.PM4 != 1.6 || dd.Sps.TypicalSize != 0.55 || dd.Scd.Co2 != 650 || dd.PoeUsbVoltage != 50 {
+		t.Errorf("unexpected values: %s", dd.String())
+	}
+}
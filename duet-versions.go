@@ -13,16 +13,27 @@ type DuetData interface {
 	doPopulateFromSubStrings(splitStr []string) error
 	SetConnectionType(n int)
 	ToMap(gatewaySerial string) map[string]any
+	// Every key ToMap can produce for this variant, whether or not the sample sets it
+	FieldSpecs() []FieldSpec
 	RecalculateLastResetUnix()
 	GetTypeInfo() DuetTypeInfo
 	String() string
 	SetPiMcuTemp(val float32)
 	SetRadioData(v RadioMetadata)
+	SetGatewayTelemetry(t GatewayTelemetry)
+	GetGatewayTelemetry() GatewayTelemetry
 	SensorMeasurements() []SensorMeasurement
+	// The reading for kind, false if the variant has no such sensor. Where it carries two (e.g. two OPCs), they are merged.
+	Measurement(kind SensorKind) (SensorMeasurement, bool)
+	HasSensor(kind SensorKind) bool
 	TimeResolved() bool
 	MarkTimeResolved(bool)
 	Timestamp() uint32
 	ResolveTime(uint32)
+	GetSerialNumber() uint16
+	GetSampleTimeMs() uint32
+	GetLastResetUnix() uint32
+	GetRadioData() RadioMetadata
 }
 
 func getVersionFromBuffer(b []byte) (*DuetTypeInfo, error) {
@@ -134,12 +145,19 @@ func getTypeInfo(hwVer, snsVar uint8) (ret *DuetTypeInfo) {
 			ret = &DuetTypeMk4Var25
 		case 26:
 			ret = &DuetTypeMk4Var26
+		case 27:
+			ret = &DuetTypeMk4Var27
+		case 28:
+			ret = &DuetTypeMk4Var28
 		}
 	}
 	return
 }
 
-func DuetDataFromRadioBytes(buff []byte, recievedUnixSec uint32, receivedTimeOk bool, isRadio bool) (DuetData, error) {
+/*
+Match the Duet type from the first two bytes and populate a sample from the rest, without touching time or connection info.
+*/
+func duetDataFromBytes(buff []byte) (DuetData, error) {
 	typeInfo, err := getVersionFromBuffer(buff)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get duet type info: %w", err)
@@ -152,6 +170,14 @@ func DuetDataFromRadioBytes(buff []byte, recievedUnixSec uint32, receivedTimeOk
 	if err := d.doPopulateFromBytes(buff[2:]); err != nil {
 		return nil, fmt.Errorf("failed to populate for type %s: %w", typeInfo.TypeAlias, err)
 	}
+	return d, nil
+}
+
+func DuetDataFromRadioBytes(buff []byte, recievedUnixSec uint32, receivedTimeOk bool, isRadio bool) (DuetData, error) {
+	d, err := duetDataFromBytes(buff)
+	if err != nil {
+		return nil, err
+	}
 
 	if isRadio {
 		d.SetConnectionType(CONNECTION_TYPE_LORA_GATEWAY)
@@ -200,6 +226,7 @@ type DuetTypeInfo struct {
 	ExpectedStringLen    int
 	StructInstanceGetter func() DuetData
 	TypeAlias            string
+	DeviceType           DeviceType
 }
 
 func (typeInfo DuetTypeInfo) checkByteLen(byteLen int) error {
@@ -216,10 +243,23 @@ func (typeInfo DuetTypeInfo) checkSubstringLen(n int) error {
 }
 
 func WriteDuetDataToDir(d DuetData, dir string) error {
+	return writeDuetDataToDir(d, dir, nil)
+}
+
+/*
+Write every measurement, passed through `wrap` if set, and any gateway telemetry.
+*/
+func writeDuetDataToDir(d DuetData, dir string, wrap func(SensorMeasurement) SensorMeasurement) error {
 	for _, m := range d.SensorMeasurements() {
+		if wrap != nil {
+			m = wrap(m)
+		}
 		if err := StoreSensorData(m, dir); err != nil {
 			return err
 		}
 	}
+	if t := d.GetGatewayTelemetry(); t.Present || t.HasCpuTemp {
+		return StoreSensorData(t, dir)
+	}
 	return nil
 }
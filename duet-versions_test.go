@@ -1,6 +1,7 @@
 package telosairduetcommon
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 )
@@ -20,7 +21,7 @@ func TestDuetsImplementDuetData(t *testing.T) {
 		&DuetDataMk4Var13{}, &DuetDataMk4Var14{}, &DuetDataMk4Var15{}, &DuetDataMk4Var16{},
 		&DuetDataMk4Var17{}, &DuetDataMk4Var18{}, &DuetDataMk4Var19{}, &DuetDataMk4Var21{},
 		&DuetDataMk4Var22{}, &DuetDataMk4Var23{}, &DuetDataMk4Var24{}, &DuetDataMk4Var25{},
-		&DuetDataMk4Var26{},
+		&DuetDataMk4Var26{}, &DuetDataMk4Var27{}, &DuetDataMk4Var28{},
 	} {
 	}
 
@@ -43,7 +44,7 @@ func TestGetTypeInfo(t *testing.T) {
 		&DuetTypeMk4Var16, &DuetTypeMk4Var17, &DuetTypeMk4Var18, &DuetTypeMk4Var19,
 		nil, &DuetTypeMk4Var21, &DuetTypeMk4Var22,
 		&DuetTypeMk4Var23, &DuetTypeMk4Var24, &DuetTypeMk4Var25,
-		&DuetTypeMk4Var26,
+		&DuetTypeMk4Var26, &DuetTypeMk4Var27, &DuetTypeMk4Var28,
 	} {
 		if duetTypeInstance == nil {
 			continue
@@ -161,6 +162,8 @@ func TestDuetTypeMethods(t *testing.T) {
 		{&DuetTypeMk4Var24, "Mk4.24", &DuetDataMk4Var24{}},
 		{&DuetTypeMk4Var25, "Mk4.25", &DuetDataMk4Var25{}},
 		{&DuetTypeMk4Var26, "Mk4.26", &DuetDataMk4Var26{}},
+		{&DuetTypeMk4Var27, "Mk4.27", &DuetDataMk4Var27{}},
+		{&DuetTypeMk4Var28, "Mk4.28", &DuetDataMk4Var28{}},
 	} {
 		if err := testDuetType(testData); err != nil {
 			t.Error(err)
@@ -201,6 +204,8 @@ func TestDuetMethodsSimple(t *testing.T) {
 		{&DuetDataMk4Var24{}, 4.24},
 		{&DuetDataMk4Var25{}, 4.25},
 		{&DuetDataMk4Var26{}, 4.26},
+		{&DuetDataMk4Var27{}, 4.27},
+		{&DuetDataMk4Var28{}, 4.28},
 	} {
 		data := testData.duetDataInstance
 
@@ -232,3 +237,66 @@ func TestDuetMethodsSimple(t *testing.T) {
 		}
 	}
 }
+
+/*
+Checks every registered type's DeviceType against its registry position and alias, and that `ToMap()`
+emits the structured fields, telling apart types the legacy float can't (e.g. Mk4.1 and Mk4.10).
+*/
+func TestDeviceType(t *testing.T) {
+	seenAliases := map[string]DeviceType{}
+	for hw := 0; hw < 256; hw++ {
+		for variant := 0; variant < 256; variant++ {
+			typeInfo := getTypeInfo(uint8(hw), uint8(variant))
+			if typeInfo == nil {
+				continue
+			}
+			dt := typeInfo.DeviceType
+			if dt != (DeviceType{uint8(hw), uint8(variant)}) {
+				t.Errorf("type registered as Mk%d.%d has DeviceType %s", hw, variant, dt)
+			}
+			if dt.String() != typeInfo.TypeAlias {
+				t.Errorf("DeviceType string `%s` doesn't match type alias `%s`", dt, typeInfo.TypeAlias)
+			}
+
+			m := typeInfo.StructInstanceGetter().ToMap("")
+			if m[KEY_HW_VERSION] != dt.Hardware || m[KEY_SENSOR_VARIANT] != dt.Variant {
+				t.Errorf("%s: expected %s %d and %s %d in ToMap(), got %v and %v", dt, KEY_HW_VERSION, dt.Hardware,
+					KEY_SENSOR_VARIANT, dt.Variant, m[KEY_HW_VERSION], m[KEY_SENSOR_VARIANT])
+			}
+			alias, _ := m[KEY_DEVICE_TYPE_ALIAS].(string)
+			if other, ok := seenAliases[alias]; ok {
+				t.Errorf("%s and %s both emit `%s`", dt, other, alias)
+			}
+			seenAliases[alias] = dt
+		}
+	}
+
+	for _, td := range []struct {
+		s        string
+		expected DeviceType
+	}{
+		{"Mk4.1", DeviceType{4, 1}},
+		{"Mk4.10", DeviceType{4, 10}},
+		{"4.10", DeviceType{4, 10}},
+		{"mk1.0", DeviceType{1, 0}},
+	} {
+		dt, err := ParseDeviceType(td.s)
+		if err != nil || dt != td.expected {
+			t.Errorf("expected `%s` to parse to %s, got %s (%v)", td.s, td.expected, dt, err)
+		}
+	}
+	for _, s := range []string{"", "Mk4", "4.x", "Mk4.300"} {
+		if _, err := ParseDeviceType(s); err == nil {
+			t.Errorf("expected an error parsing `%s`", s)
+		}
+	}
+
+	b, err := json.Marshal(DeviceType{4, 10})
+	if err != nil || string(b) != `"Mk4.10"` {
+		t.Errorf("expected DeviceType to marshal as \"Mk4.10\", got %s (%v)", b, err)
+	}
+	var dt DeviceType
+	if err := json.Unmarshal(b, &dt); err != nil || dt != (DeviceType{4, 10}) {
+		t.Errorf("expected to unmarshal %s back to Mk4.10, got %s (%v)", b, dt, err)
+	}
+}
@@ -0,0 +1,286 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+/* ~~ Field Catalog ~~ */
+
+const (
+	UNIT_UG_M3      = "µg/m³"
+	UNIT_PER_DL     = "#/0.1L"
+	UNIT_PER_CM3    = "#/cm³"
+	UNIT_UM         = "µm"
+	UNIT_CELSIUS    = "°C"
+	UNIT_PERCENT_RH = "%RH"
+	UNIT_PPM        = "ppm"
+	UNIT_PPB        = "ppb"
+	UNIT_KPA        = "kPa"
+	UNIT_DBM        = "dBm"
+	UNIT_DB         = "dB"
+	UNIT_SECONDS    = "s"
+	UNIT_DEGREES    = "°"
+	UNIT_MPS        = "m/s"
+	UNIT_ML_S       = "mL/s"
+	UNIT_BYTES      = "B"
+)
+
+/*
+One key of a `ToMap()` result. GoType is the dynamic type of the value, as printed by `%T`.
+*/
+type FieldSpec struct {
+	Key         string   `json:"key"`
+	GoType      string   `json:"go_type"`
+	Unit        string   `json:"unit,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Optional    bool     `json:"optional,omitempty"` // only present once set, e.g. by `SetRadioData()`
+	Description string   `json:"description"`
+}
+
+func field(key, goType, unit, description string) FieldSpec {
+	return FieldSpec{Key: key, GoType: goType, Unit: unit, Description: description}
+}
+
+func rangedField(key, goType, unit string, lo, hi float64, description string) FieldSpec {
+	f := field(key, goType, unit, description)
+	f.Min, f.Max = &lo, &hi
+	return f
+}
+
+func optionalFields(fields []FieldSpec) []FieldSpec {
+	ret := make([]FieldSpec, len(fields))
+	for i, f := range fields {
+		f.Optional = true
+		ret[i] = f
+	}
+	return ret
+}
+
+/*
+Concatenate field lists. The first declaration of a key wins.
+*/
+func joinFields(lists ...[]FieldSpec) []FieldSpec {
+	seen := map[string]bool{}
+	var ret []FieldSpec
+	for _, l := range lists {
+		for _, f := range l {
+			if !seen[f.Key] {
+				seen[f.Key] = true
+				ret = append(ret, f)
+			}
+		}
+	}
+	return ret
+}
+
+// Keys set directly by the variants' `ToMap()` rather than by a measurement type
+var sampleFieldSpecs = map[string]FieldSpec{
+	KEY_DEVICE_TYPE:     field(KEY_DEVICE_TYPE, "float64", "", "Legacy device type, hardware.variant as a number"),
+	KEY_SERIAL_NUMBER:   field(KEY_SERIAL_NUMBER, "uint16", "", "Device serial number"),
+	KEY_DEVICE_ID:       field(KEY_DEVICE_ID, "uint16", "", "Device serial number (legacy key)"),
+	KEY_UNIX:            field(KEY_UNIX, "uint32", UNIT_SECONDS, "Sample time, unix seconds"),
+	KEY_ECO2:            rangedField(KEY_ECO2, "int", "", 0, 0, "Legacy, always 0"),
+	KEY_RAWH2:           rangedField(KEY_RAWH2, "int", "", 0, 0, "Legacy, always 0"),
+	KEY_SENSOR_STATES:   field(KEY_SENSOR_STATES, "uint8", "", "Sensor fault bits"),
+	KEY_CONNECTION_TYPE: rangedField(KEY_CONNECTION_TYPE, "int", "", 0, 2, "How the sample arrived, see CONNECTION_TYPE_*"),
+	KEY_LAST_RESET_TIME: field(KEY_LAST_RESET_TIME, "uint32", UNIT_SECONDS, "Device boot time, unix seconds"),
+	KEY_GATEWAY_SERIAL:  field(KEY_GATEWAY_SERIAL, "string", "", "Serial of the gateway that forwarded the sample"),
+	KEY_POE_USB_VOLTAGE: field(KEY_POE_USB_VOLTAGE, "uint8", "", "Raw supply voltage ADC reading, undocumented scaling, see PowerProfile"),
+
+	KEY_GAS_CO:   field(KEY_GAS_CO, "float32", "", "Carbon monoxide, in the gas board's units, see GasNativeUnits"),
+	KEY_GAS_NO:   field(KEY_GAS_NO, "float32", "", "Nitric oxide, in the gas board's units, see GasNativeUnits"),
+	KEY_GAS_NO2:  field(KEY_GAS_NO2, "float32", "", "Nitrogen dioxide, in the gas board's units, see GasNativeUnits"),
+	KEY_GAS_O3:   field(KEY_GAS_O3, "float32", "", "Ozone, in the gas board's units, see GasNativeUnits"),
+	KEY_GAS_SO2:  field(KEY_GAS_SO2, "float32", "", "Sulfur dioxide, in the gas board's units, see GasNativeUnits"),
+	KEY_GAS_CH2O: field(KEY_GAS_CH2O, "float32", "", "Formaldehyde, in the gas board's units, see GasNativeUnits"),
+	KEY_GAS_H2S:  field(KEY_GAS_H2S, "float32", "", "Hydrogen sulfide, in the gas board's units, see GasNativeUnits"),
+	KEY_GAS_CH4:  field(KEY_GAS_CH4, "float32", "", "Methane, in the gas board's units, see GasNativeUnits"),
+
+	KEY_TGS2611_RS:     field(KEY_TGS2611_RS, "float32", "", "TGS2611 (methane) sensing resistance"),
+	KEY_TGS2600_RS:     field(KEY_TGS2600_RS, "float32", "", "TGS2600 (air contaminants) sensing resistance"),
+	KEY_TGS2611_V2_RS1: field(KEY_TGS2611_V2_RS1, "float32", "", "First TGS2611 (methane) sensing resistance"),
+	KEY_TGS2611_V2_RS2: field(KEY_TGS2611_V2_RS2, "float32", "", "Second TGS2611 (methane) sensing resistance"),
+	KEY_CH4_ESTIMATE:   rangedField(KEY_CH4_ESTIMATE, "float32", UNIT_PPM, 0, 50000, "Methane estimated from the TGS2611, see SetCh4Estimate()"),
+
+	KEY_LATITUDE:        rangedField(KEY_LATITUDE, "float32", UNIT_DEGREES, -90, 90, "GPS latitude"),
+	KEY_LONGITUDE:       rangedField(KEY_LONGITUDE, "float32", UNIT_DEGREES, -180, 180, "GPS longitude"),
+	KEY_FS3000_VELOCITY: rangedField(KEY_FS3000_VELOCITY, "float32", UNIT_MPS, 0, 15, "FS3000 air velocity"),
+	"voc_index":         rangedField("voc_index", "uint32", "", 0, 500, "SGP40 VOC index"),
+
+	KEY_TEMP_RH_FUSION: field(KEY_TEMP_RH_FUSION, "string", "", "Strategy that produced temp & hum, see FuseTempRh()"),
+}
+
+/*
+Specs for keys set directly by a variant. An unknown key gets a spec with no type, which the catalog tests catch.
+*/
+func sampleFields(keys ...string) []FieldSpec {
+	ret := make([]FieldSpec, len(keys))
+	for i, k := range keys {
+		f, ok := sampleFieldSpecs[k]
+		if !ok {
+			f = FieldSpec{Key: k}
+		}
+		ret[i] = f
+	}
+	return ret
+}
+
+/*
+Keys every variant sets, except the Mk4-only PoE / USB voltage.
+*/
+func duetHeaderFields() []FieldSpec {
+	return sampleFields(KEY_DEVICE_TYPE, KEY_SERIAL_NUMBER, KEY_DEVICE_ID, KEY_UNIX, KEY_ECO2, KEY_RAWH2,
+		KEY_SENSOR_STATES, KEY_CONNECTION_TYPE, KEY_LAST_RESET_TIME, KEY_GATEWAY_SERIAL)
+}
+
+/*
+Every registered Duet type, by hardware version then variant.
+*/
+func RegisteredDuetTypes() []*DuetTypeInfo {
+	var ret []*DuetTypeInfo
+	for hw := 0; hw <= math.MaxUint8; hw++ {
+		for v := 0; v <= math.MaxUint8; v++ {
+			if ti := getTypeInfo(uint8(hw), uint8(v)); ti != nil {
+				ret = append(ret, ti)
+			}
+		}
+	}
+	return ret
+}
+
+/*
+The keys a sample of this type can have in its `ToMap()` output.
+*/
+func (typeInfo DuetTypeInfo) FieldSpecs() []FieldSpec {
+	return typeInfo.StructInstanceGetter().FieldSpecs()
+}
+
+var jsonSchemaIntBounds = map[string][2]float64{
+	"int":    {math.MinInt32, math.MaxInt32}, // firmware ints are 32 bit
+	"int16":  {math.MinInt16, math.MaxInt16},
+	"int32":  {math.MinInt32, math.MaxInt32},
+	"uint8":  {0, math.MaxUint8},
+	"uint16": {0, math.MaxUint16},
+	"uint32": {0, math.MaxUint32},
+	"uint64": {0, math.MaxUint64},
+}
+
+func (f FieldSpec) jsonSchema() map[string]any {
+	p := map[string]any{"x-go-type": f.GoType}
+	desc := f.Description
+	if f.Unit != "" {
+		p["x-unit"] = f.Unit
+		desc += " (" + f.Unit + ")"
+	}
+	if desc != "" {
+		p["description"] = desc
+	}
+
+	switch {
+	case f.GoType == "string":
+		p["type"] = "string"
+	case f.GoType == "bool":
+		p["type"] = "boolean"
+	case strings.HasPrefix(f.GoType, "float"):
+		p["type"] = "number"
+	default:
+		p["type"] = "integer"
+		if b, ok := jsonSchemaIntBounds[f.GoType]; ok {
+			p["minimum"], p["maximum"] = b[0], b[1]
+		}
+	}
+	if f.Min != nil {
+		p["minimum"] = *f.Min
+	}
+	if f.Max != nil {
+		p["maximum"] = *f.Max
+	}
+	return p
+}
+
+/*
+JSON Schema (draft 2020-12) for this type's `ToMap()` output.
+*/
+func (typeInfo DuetTypeInfo) JSONSchema() map[string]any {
+	props := map[string]any{}
+	required := []string{}
+	for _, f := range typeInfo.FieldSpecs() {
+		props[f.Key] = f.jsonSchema()
+		if !f.Optional {
+			required = append(required, f.Key)
+		}
+	}
+	sort.Strings(required)
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                fmt.Sprintf("Duet %s sample", typeInfo.TypeAlias),
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+/*
+Write a Markdown table of this type's `ToMap()` keys, sorted by key.
+*/
+func (typeInfo DuetTypeInfo) WriteFieldTable(w io.Writer) error {
+	fields := typeInfo.FieldSpecs()
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Duet %s\n\n", typeInfo.TypeAlias)
+	sb.WriteString("| Key | Type | Unit | Range | Optional | Description |\n")
+	sb.WriteString("|---|---|---|---|---|---|\n")
+	for _, f := range fields {
+		rng := ""
+		if f.Min != nil && f.Max != nil {
+			rng = fmt.Sprintf("%g – %g", *f.Min, *f.Max)
+		}
+		opt := ""
+		if f.Optional {
+			opt = "yes"
+		}
+		fmt.Fprintf(&sb, "| `%s` | %s | %s | %s | %s | %s |\n", f.Key, f.GoType, f.Unit, rng, opt, f.Description)
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/*
+Write `<alias>.schema.json` for every registered type, and `FIELDS.md` with all their field tables, into dir.
+*/
+func WriteFieldCatalog(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", dir, err)
+	}
+	var md strings.Builder
+	md.WriteString("# Duet `ToMap()` fields\n\n")
+	for _, ti := range RegisteredDuetTypes() {
+		b, err := json.MarshalIndent(ti.JSONSchema(), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode schema for %s: %w", ti.TypeAlias, err)
+		}
+		filePath := path.Join(dir, ti.TypeAlias+".schema.json")
+		if err := os.WriteFile(filePath, append(b, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write file %q: %w", filePath, err)
+		}
+		if err := ti.WriteFieldTable(&md); err != nil {
+			return err
+		}
+	}
+	filePath := path.Join(dir, "FIELDS.md")
+	if err := os.WriteFile(filePath, []byte(md.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write file %q: %w", filePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package telosairduetcommon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+/*
+A sample with every optional field set.
+*/
+func fullyPopulatedSample(typeInfo *DuetTypeInfo) DuetData {
+	d := typeInfo.StructInstanceGetter()
+	d.SetPiMcuTemp(45)
+	d.SetRadioData(NewRadioMetadata(-90, 7, 1, 1000))
+	d.SetGatewayTelemetry(GatewayTelemetry{FirmwareVersion: "1.2", SoftwareVersion: "3.4", Lat: 52.4, Lon: 13.1, HasLocation: true})
+	if md, ok := d.(MethaneSensorData); ok {
+		md.SetCh4Estimate(2)
+	}
+	if fd, ok := d.(TempRhFusionData); ok {
+		fd.SetFusedTempRh(CombinedTempRhMeasurements{Temp: 20, Hum: 40}, "mean")
+	}
+	ApplyOpcMerge(d, MeanOpcMerge{})
+	if od, ok := d.(*DuetDataMk4Var24); ok {
+		od.Opc.flowSet = true
+	}
+	return d
+}
+
+func checkMapAgainstFields(t *testing.T, name string, m map[string]any, fields []FieldSpec, wantAll bool) {
+	t.Helper()
+	specs := map[string]FieldSpec{}
+	for _, f := range fields {
+		if _, dup := specs[f.Key]; dup {
+			t.Errorf("%s: key `%s` declared twice", name, f.Key)
+		}
+		specs[f.Key] = f
+	}
+	for k, v := range m {
+		f, ok := specs[k]
+		if !ok {
+			t.Errorf("%s: ToMap() key `%s` (%T) has no field spec", name, k, v)
+			continue
+		}
+		if typ := fmt.Sprintf("%T", v); typ != f.GoType {
+			t.Errorf("%s: `%s` is %s, spec says %q", name, k, typ, f.GoType)
+		}
+		if x, ok := mapFloat(m, k); ok && f.Min != nil && (x < *f.Min || x > *f.Max) {
+			t.Errorf("%s: `%s` = %v is outside its range %v – %v", name, k, x, *f.Min, *f.Max)
+		}
+		if f.Description == "" {
+			t.Errorf("%s: `%s` has no description", name, k)
+		}
+	}
+	for _, f := range fields {
+		if _, ok := m[f.Key]; !ok && (wantAll || !f.Optional) {
+			t.Errorf("%s: spec `%s` missing from ToMap()", name, f.Key)
+		}
+	}
+}
+
+/*
+Every registered type's field specs must describe its `ToMap()` exactly: required keys in a bare sample, and every
+declared key once all optional data is attached.
+*/
+func TestFieldSpecsMatchToMap(t *testing.T) {
+	types := RegisteredDuetTypes()
+	if len(types) < 32 {
+		t.Fatalf("expected at least 32 registered types, got %d", len(types))
+	}
+	for _, typeInfo := range types {
+		d := typeInfo.StructInstanceGetter()
+		checkMapAgainstFields(t, typeInfo.TypeAlias+" (bare)", d.ToMap("gw"), typeInfo.FieldSpecs(), false)
+
+		d = fullyPopulatedSample(typeInfo)
+		checkMapAgainstFields(t, typeInfo.TypeAlias+" (populated)", d.ToMap("gw"), d.FieldSpecs(), true)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := DuetTypeMk4Var28.JSONSchema()
+	b, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Type       string                    `json:"type"`
+		Properties map[string]map[string]any `json:"properties"`
+		Required   []string                  `json:"required"`
+		Additional bool                      `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != "object" || decoded.Additional {
+		t.Errorf("unexpected schema header: %s", b)
+	}
+
+	pm := decoded.Properties["pm25_m"]
+	if pm["type"] != "number" || pm["x-unit"] != UNIT_UG_M3 || pm["minimum"] != 0.0 {
+		t.Errorf("unexpected pm25_m schema: %v", pm)
+	}
+	if sn := decoded.Properties[KEY_SERIAL_NUMBER]; sn["type"] != "integer" || sn["maximum"] != 65535.0 {
+		t.Errorf("unexpected %s schema: %v", KEY_SERIAL_NUMBER, sn)
+	}
+	required := strings.Join(decoded.Required, ",")
+	if !strings.Contains(required, KEY_UNIX) || strings.Contains(required, KEY_OPC_MERGE) {
+		t.Errorf("unexpected required keys: %s", required)
+	}
+
+	var table bytes.Buffer
+	if err := DuetTypeMk4Var28.WriteFieldTable(&table); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(table.String(), "| `pm25_m` | float32 | µg/m³ | 0 – 1000 |") {
+		t.Errorf("unexpected field table:\n%s", table.String())
+	}
+}
@@ -0,0 +1,227 @@
+package telosairduetcommon
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/* ~~ Fragmentation ~~ */
+
+/*
+Duet samples larger than the radio MTU are sent as several fragments, each prefixed with:
+
+	typedef struct __attribute__((packed)) {
+	  uint8_t marker;    // FRAGMENT_MARKER, never a valid hardware version
+	  uint16_t sampleId; // same for every fragment of one sample
+	  uint8_t index;     // 0-based
+	  uint8_t total;
+	} fragment_header_t;
+
+Once reassembled, the payload is exactly what `DuetDataFromRadioBytes` expects.
+*/
+const (
+	FRAGMENT_MARKER     = 0xFF
+	FRAGMENT_HEADER_LEN = 5
+	MAX_FRAGMENTS       = 255
+)
+
+var ErrReassemblyMemoryCap = errors.New("fragment exceeds reassembly memory cap")
+
+type FragmentHeader struct {
+	SampleId uint16
+	Index    uint8
+	Total    uint8
+}
+
+func IsFragment(b []byte) bool {
+	return len(b) >= FRAGMENT_HEADER_LEN && b[0] == FRAGMENT_MARKER
+}
+
+func ParseFragment(b []byte) (FragmentHeader, []byte, error) {
+	var h FragmentHeader
+	if !IsFragment(b) {
+		return h, nil, fmt.Errorf("not a fragment (%d bytes)", len(b))
+	}
+	h.SampleId = binary.LittleEndian.Uint16(b[1:3])
+	h.Index = b[3]
+	h.Total = b[4]
+	if h.Total == 0 || h.Index >= h.Total {
+		return h, nil, fmt.Errorf("invalid fragment index %d of %d", h.Index, h.Total)
+	}
+	return h, b[FRAGMENT_HEADER_LEN:], nil
+}
+
+/*
+Split a Duet payload into fragments of at most mtu bytes each, headers included.
+*/
+func Fragment(payload []byte, mtu int, sampleId uint16) ([][]byte, error) {
+	chunkLen := mtu - FRAGMENT_HEADER_LEN
+	if chunkLen <= 0 {
+		return nil, fmt.Errorf("mtu of %d leaves no room after the %d byte fragment header", mtu, FRAGMENT_HEADER_LEN)
+	}
+	if len(payload) == 0 {
+		return nil, errors.New("nothing to fragment")
+	}
+	total := (len(payload) + chunkLen - 1) / chunkLen
+	if total > MAX_FRAGMENTS {
+		return nil, fmt.Errorf("payload of %d bytes needs %d fragments at mtu %d, max is %d", len(payload), total, mtu, MAX_FRAGMENTS)
+	}
+
+	ret := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		chunk := payload[i*chunkLen : min((i+1)*chunkLen, len(payload))]
+		frag := make([]byte, FRAGMENT_HEADER_LEN, FRAGMENT_HEADER_LEN+len(chunk))
+		frag[0] = FRAGMENT_MARKER
+		binary.LittleEndian.PutUint16(frag[1:3], sampleId)
+		frag[3] = uint8(i)
+		frag[4] = uint8(total)
+		ret = append(ret, append(frag, chunk...))
+	}
+	return ret, nil
+}
+
+/* ~~ Reassembly ~~ */
+
+type reassemblyKey struct {
+	source   string
+	sampleId uint16
+}
+
+type reassembly struct {
+	chunks    [][]byte
+	received  int
+	nBytes    int
+	firstSeen time.Time
+}
+
+/*
+Buffers fragments until a sample is complete. Incomplete samples are dropped after Timeout,
+and the oldest incomplete samples are evicted to stay under MaxBytes of buffered fragment data.
+Fragments are grouped by source (e.g. gateway or device address) and sample id. Safe for concurrent use.
+*/
+type Reassembler struct {
+	Timeout  time.Duration
+	MaxBytes int
+
+	mu       sync.Mutex
+	pending  map[reassemblyKey]*reassembly
+	buffered int
+}
+
+func NewReassembler(timeout time.Duration, maxBytes int) *Reassembler {
+	return &Reassembler{Timeout: timeout, MaxBytes: maxBytes}
+}
+
+/*
+Add a received fragment. Returns the full payload, and true, once the last missing fragment of its sample arrives.
+*/
+func (r *Reassembler) Add(source string, frag []byte, now time.Time) ([]byte, bool, error) {
+	h, chunk, err := ParseFragment(frag)
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = map[reassemblyKey]*reassembly{}
+	}
+	r.expire(now)
+
+	if r.MaxBytes > 0 && len(chunk) > r.MaxBytes {
+		return nil, false, ErrReassemblyMemoryCap
+	}
+
+	k := reassemblyKey{source, h.SampleId}
+	ra, ok := r.pending[k]
+	if ok && len(ra.chunks) != int(h.Total) {
+		// Sample id reused (e.g. wrapped or device rebooted) before the old sample completed
+		r.drop(k)
+		ok = false
+	}
+	if !ok {
+		ra = &reassembly{chunks: make([][]byte, h.Total), firstSeen: now}
+		r.pending[k] = ra
+	}
+	if ra.chunks[h.Index] != nil {
+		return nil, false, nil
+	}
+
+	for r.MaxBytes > 0 && r.buffered+len(chunk) > r.MaxBytes {
+		if !r.evictOldest(k) {
+			r.drop(k)
+			return nil, false, ErrReassemblyMemoryCap
+		}
+	}
+	ra.chunks[h.Index] = append([]byte(nil), chunk...)
+	ra.received++
+	ra.nBytes += len(chunk)
+	r.buffered += len(chunk)
+
+	if ra.received < len(ra.chunks) {
+		return nil, false, nil
+	}
+	payload := make([]byte, 0, ra.nBytes)
+	for _, c := range ra.chunks {
+		payload = append(payload, c...)
+	}
+	r.drop(k)
+	return payload, true, nil
+}
+
+/*
+Drop incomplete samples older than Timeout. Returns how many were dropped.
+*/
+func (r *Reassembler) Expire(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.expire(now)
+}
+
+func (r *Reassembler) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+func (r *Reassembler) expire(now time.Time) int {
+	if r.Timeout <= 0 {
+		return 0
+	}
+	n := 0
+	for k, ra := range r.pending {
+		if now.Sub(ra.firstSeen) > r.Timeout {
+			r.drop(k)
+			n++
+		}
+	}
+	return n
+}
+
+/*
+Drop the oldest incomplete sample other than `keep`. Returns false if there is none.
+*/
+func (r *Reassembler) evictOldest(keep reassemblyKey) bool {
+	var oldestKey reassemblyKey
+	var oldest *reassembly
+	for k, ra := range r.pending {
+		if k != keep && (oldest == nil || ra.firstSeen.Before(oldest.firstSeen)) {
+			oldestKey, oldest = k, ra
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	r.drop(oldestKey)
+	return true
+}
+
+func (r *Reassembler) drop(k reassemblyKey) {
+	if ra, ok := r.pending[k]; ok {
+		r.buffered -= ra.nBytes
+		delete(r.pending, k)
+	}
+}
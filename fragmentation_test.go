@@ -0,0 +1,75 @@
+package telosairduetcommon
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFragmentReassembleRoundTrip(t *testing.T) {
+	payload := make([]byte, 2+DuetTypeMk4Var24.ExpectedBytes)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	payload[0], payload[1] = 4, 24
+
+	frags, err := Fragment(payload, 51, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) != 4 {
+		t.Fatalf("expected 4 fragments, got %d", len(frags))
+	}
+	for _, f := range frags {
+		if len(f) > 51 {
+			t.Errorf("fragment of %d bytes exceeds mtu", len(f))
+		}
+	}
+
+	r := NewReassembler(time.Minute, 1024)
+	now := time.Unix(1_000_000, 0)
+	// Out of order, with a duplicate
+	for _, i := range []int{2, 0, 0, 3} {
+		if _, done, err := r.Add("gw", frags[i], now); err != nil || done {
+			t.Fatalf("fragment %d: done %v, err %v", i, done, err)
+		}
+	}
+	got, done, err := r.Add("gw", frags[1], now)
+	if err != nil || !done {
+		t.Fatalf("expected completion, got done %v, err %v", done, err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("reassembled payload differs from original")
+	}
+	if r.Pending() != 0 {
+		t.Errorf("expected nothing pending, got %d", r.Pending())
+	}
+}
+
+func TestReassemblerTimeoutAndCap(t *testing.T) {
+	frags, err := Fragment(make([]byte, 100), 30, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_000_000, 0)
+
+	r := NewReassembler(10*time.Second, 1024)
+	r.Add("gw", frags[0], now)
+	if n := r.Expire(now.Add(11 * time.Second)); n != 1 {
+		t.Errorf("expected 1 expired sample, got %d", n)
+	}
+
+	// Room for two chunks only: a second sample evicts the first
+	r = NewReassembler(time.Minute, 50)
+	r.Add("a", frags[0], now)
+	r.Add("b", frags[0], now.Add(time.Second))
+	if _, _, err := r.Add("b", frags[1], now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if r.Pending() != 1 {
+		t.Errorf("expected oldest sample to be evicted, %d pending", r.Pending())
+	}
+	if _, _, err := r.Add("b", frags[2], now.Add(time.Second)); err != ErrReassemblyMemoryCap {
+		t.Errorf("expected memory cap error, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package telosairduetcommon
+
+import (
+	"sort"
+	"sync"
+)
+
+/* ~~ Electrochemical Gas Calibration ~~ */
+
+// Every gas key any variant may emit in `ToMap()`.
+var GasKeys = append(append([]string{}, GasSensorNames...), KEY_GAS_H2S)
+
+const KEY_SUFFIX_RAW = "_raw"
+
+/*
+One point of a temperature curve: the zero offset added to GasCalibration.Zero and the factor
+multiplied into GasCalibration.Sensitivity at that temperature. Linearly interpolated between points, held flat beyond them.
+*/
+type GasTempPoint struct {
+	TempC             float64 `json:"temp_c"`
+	Zero              float64 `json:"zero"`
+	SensitivityFactor float64 `json:"sensitivity_factor"`
+}
+
+/*
+Per-unit correction for one gas channel:
+
+	calibrated = (raw - zero(T)) / sensitivity(T) - sum(k * calibrated_other)
+*/
+type GasCalibration struct {
+	// Raw units reported per unit of true concentration. 0 is treated as 1.
+	Sensitivity float64 `json:"sensitivity"`
+	// Raw reading in clean air.
+	Zero float64 `json:"zero"`
+	// Optional temperature dependence of the zero and sensitivity.
+	TempCurve []GasTempPoint `json:"temp_curve,omitempty"`
+	// Response to other gases, by gas key, e.g. an O3 (OX) sensor's response to NO2.
+	CrossSensitivity map[string]float64 `json:"cross_sensitivity,omitempty"`
+}
+
+func (c GasCalibration) atTemp(tempC float64, haveTemp bool) (zero, sensitivity float64) {
+	zero = c.Zero
+	sensitivity = c.Sensitivity
+	if sensitivity == 0 {
+		sensitivity = 1
+	}
+	if !haveTemp || len(c.TempCurve) == 0 {
+		return
+	}
+
+	pts := c.TempCurve
+	var z, f float64
+	switch {
+	case tempC <= pts[0].TempC:
+		z, f = pts[0].Zero, pts[0].SensitivityFactor
+	case tempC >= pts[len(pts)-1].TempC:
+		z, f = pts[len(pts)-1].Zero, pts[len(pts)-1].SensitivityFactor
+	default:
+		for i := 1; i < len(pts); i++ {
+			if tempC <= pts[i].TempC {
+				frac := (tempC - pts[i-1].TempC) / (pts[i].TempC - pts[i-1].TempC)
+				z = pts[i-1].Zero + frac*(pts[i].Zero-pts[i-1].Zero)
+				f = pts[i-1].SensitivityFactor + frac*(pts[i].SensitivityFactor-pts[i-1].SensitivityFactor)
+				break
+			}
+		}
+	}
+	if f == 0 {
+		f = 1
+	}
+	return zero + z, sensitivity * f
+}
+
+type CalibratedGasValue struct {
+	Gas        string
+	Raw        float64
+	Calibrated float64
+}
+
+type gasCalibrationKey struct {
+	serialNumber uint16
+	gas          string
+}
+
+/*
+Gas calibrations keyed by (device serial, gas key). Safe for concurrent use.
+*/
+type GasCalibrationRegistry struct {
+	mu   sync.RWMutex
+	cals map[gasCalibrationKey]GasCalibration
+}
+
+func NewGasCalibrationRegistry() *GasCalibrationRegistry {
+	return &GasCalibrationRegistry{cals: map[gasCalibrationKey]GasCalibration{}}
+}
+
+func (r *GasCalibrationRegistry) Set(serialNumber uint16, gas string, c GasCalibration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cals == nil {
+		r.cals = map[gasCalibrationKey]GasCalibration{}
+	}
+	if len(c.TempCurve) > 1 {
+		c.TempCurve = append([]GasTempPoint(nil), c.TempCurve...)
+		sort.Slice(c.TempCurve, func(i, j int) bool { return c.TempCurve[i].TempC < c.TempCurve[j].TempC })
+	}
+	r.cals[gasCalibrationKey{serialNumber, gas}] = c
+}
+
+func (r *GasCalibrationRegistry) Get(serialNumber uint16, gas string) (GasCalibration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.cals[gasCalibrationKey{serialNumber, gas}]
+	return c, ok
+}
+
+/*
+Calibrate every gas the sample reports that has a calibration for its device, using the sample's combined temperature.
+Cross-sensitivities are corrected using the other gases' calibrated (or, if uncalibrated, raw) values.
+*/
+func (r *GasCalibrationRegistry) Apply(d DuetData) []CalibratedGasValue {
+	m := d.ToMap("")
+	tempC, haveTemp := mapFloat(m, KEY_TEMP)
+	sn := d.GetSerialNumber()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// First pass without cross terms, so every gas has a value to correct the others with
+	uncorrected := map[string]float64{}
+	cals := map[string]GasCalibration{}
+	var ret []CalibratedGasValue
+	for _, gas := range GasKeys {
+		raw, ok := mapFloat(m, gas)
+		if !ok {
+			continue
+		}
+		uncorrected[gas] = raw
+		c, ok := r.cals[gasCalibrationKey{sn, gas}]
+		if !ok {
+			continue
+		}
+		zero, sensitivity := c.atTemp(tempC, haveTemp)
+		uncorrected[gas] = (raw - zero) / sensitivity
+		cals[gas] = c
+		ret = append(ret, CalibratedGasValue{Gas: gas, Raw: raw})
+	}
+
+	for i, v := range ret {
+		cal := uncorrected[v.Gas]
+		for other, k := range cals[v.Gas].CrossSensitivity {
+			cal -= k * uncorrected[other]
+		}
+		ret[i].Calibrated = cal
+	}
+	return ret
+}
+
+/*
+Replace each calibrated gas in a `ToMap()` result with its calibrated value, keeping the original under `<gas>_raw`.
+*/
+func (r *GasCalibrationRegistry) ApplyToMap(d DuetData, m map[string]any) {
+	for _, v := range r.Apply(d) {
+		m[v.Gas] = v.Calibrated
+		m[v.Gas+KEY_SUFFIX_RAW] = v.Raw
+	}
+}
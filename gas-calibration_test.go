@@ -0,0 +1,90 @@
+package telosairduetcommon
+
+import (
+	"math"
+	"testing"
+)
+
+func gasTestSample(temp, co, no2, ch4 float32) *DuetDataMk4Var3 {
+	return &DuetDataMk4Var3{SerialNumber: 5, TempRh: CombinedTempRhMeasurements{Temp: temp, Hum: 50}, Co: co, No2: no2, Ch4: ch4}
+}
+
+func TestGasCalibrationTempCurve(t *testing.T) {
+	r := NewGasCalibrationRegistry()
+	// Out of order, Set sorts it
+	r.Set(5, KEY_GAS_NO2, GasCalibration{Sensitivity: 4, Zero: 10, TempCurve: []GasTempPoint{
+		{TempC: 30, Zero: 3, SensitivityFactor: 1.5},
+		{TempC: 10, Zero: 1, SensitivityFactor: 0.5},
+	}})
+	for _, td := range []struct {
+		temp float32
+		want float64
+	}{
+		// Interpolated: zero 12, sensitivity 4
+		{20, 10},
+		// Held flat beyond the curve: zero 11, sensitivity 2 below; zero 13, sensitivity 6 above
+		{10, 20.5},
+		{0, 20.5},
+		{40, 6.5},
+	} {
+		vals := r.Apply(gasTestSample(td.temp, 0, 52, 0))
+		if len(vals) != 1 || vals[0].Gas != KEY_GAS_NO2 || vals[0].Raw != 52 || math.Abs(vals[0].Calibrated-td.want) > 1e-9 {
+			t.Errorf("at %.0f°C: got %+v; want %f", td.temp, vals, td.want)
+		}
+	}
+}
+
+func TestGasCalibrationApply(t *testing.T) {
+	r := NewGasCalibrationRegistry()
+	r.Set(5, KEY_GAS_CO, GasCalibration{Sensitivity: 2, Zero: 0.5})
+	// Corrected for the calibrated CO and the uncalibrated, so raw, CH4
+	r.Set(5, KEY_GAS_NO2, GasCalibration{Sensitivity: 4, Zero: 12, CrossSensitivity: map[string]float64{KEY_GAS_CO: 0.5, KEY_GAS_CH4: 0.1}})
+
+	got := map[string]CalibratedGasValue{}
+	for _, v := range r.Apply(gasTestSample(20, 4.5, 52, 20)) {
+		got[v.Gas] = v
+	}
+	want := map[string]CalibratedGasValue{
+		KEY_GAS_CO:  {Gas: KEY_GAS_CO, Raw: 4.5, Calibrated: 2},
+		KEY_GAS_NO2: {Gas: KEY_GAS_NO2, Raw: 52, Calibrated: 10 - 0.5*2 - 0.1*20},
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+	for gas, w := range want {
+		if g := got[gas]; g.Raw != w.Raw || math.Abs(g.Calibrated-w.Calibrated) > 1e-9 {
+			t.Errorf("%s = %+v; want %+v", gas, g, w)
+		}
+	}
+
+	// A sensitivity of 0 is treated as 1
+	r.Set(6, KEY_GAS_CO, GasCalibration{Zero: 1})
+	d := gasTestSample(20, 4.5, 52, 20)
+	d.SerialNumber = 6
+	if vals := r.Apply(d); len(vals) != 1 || vals[0].Calibrated != 3.5 {
+		t.Errorf("unexpected values for device 6: %+v", vals)
+	}
+	d.SerialNumber = 7
+	if vals := r.Apply(d); len(vals) != 0 {
+		t.Errorf("expected nothing for an uncalibrated device, got %+v", vals)
+	}
+}
+
+func TestGasCalibrationApplyToMap(t *testing.T) {
+	r := NewGasCalibrationRegistry()
+	r.Set(5, KEY_GAS_CO, GasCalibration{Sensitivity: 2, Zero: 0.5})
+	d := gasTestSample(20, 4.5, 52, 20)
+	m := d.ToMap("")
+	r.ApplyToMap(d, m)
+
+	if m[KEY_GAS_CO] != float64(2) || m[KEY_GAS_CO+KEY_SUFFIX_RAW] != float64(4.5) {
+		t.Errorf("co = %v, co_raw = %v", m[KEY_GAS_CO], m[KEY_GAS_CO+KEY_SUFFIX_RAW])
+	}
+	// Uncalibrated gases are left as they were, without a raw copy
+	if m[KEY_GAS_NO2] != float32(52) {
+		t.Errorf("no2 = %v", m[KEY_GAS_NO2])
+	}
+	if _, ok := m[KEY_GAS_NO2+KEY_SUFFIX_RAW]; ok {
+		t.Error("unexpected no2_raw")
+	}
+}
@@ -25,9 +25,13 @@ const (
 	KEY_GAS_H2S  = "h2s"
 )
 
+// Not part of the gas board's readings: set for variants that carry H2S as a loose field
+const GAS_BIT_H2S uint16 = 1 << NUM_GAS_SENSORS
+
 type GasSensorsMeasurement struct {
 	SensorBitField                            uint16
 	Co, O3, Nh3, No, No2, So2, Ch2o, Voc, Ch4 float32
+	H2s                                       float32
 }
 
 func checkBitSet(bitfield uint16, bitmask uint16) bool {
@@ -108,6 +112,9 @@ func (m GasSensorsMeasurement) ToMap() map[string]any {
 	if checkBitSet(m.SensorBitField, 256) {
 		retMap[KEY_GAS_CH4] = m.Ch4
 	}
+	if checkBitSet(m.SensorBitField, GAS_BIT_H2S) {
+		retMap[KEY_GAS_H2S] = m.H2s
+	}
 	return retMap
 }
 
@@ -140,6 +147,9 @@ func (m GasSensorsMeasurement) FloatMap() map[string]float32 {
 	if checkBitSet(m.SensorBitField, 256) {
 		retMap[KEY_GAS_CH4] = m.Ch4
 	}
+	if checkBitSet(m.SensorBitField, GAS_BIT_H2S) {
+		retMap[KEY_GAS_H2S] = m.H2s
+	}
 	return retMap
 }
 
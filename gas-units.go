@@ -0,0 +1,192 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* ~~ Gas Unit Conversion ~~ */
+
+type GasUnit int
+
+const (
+	GasUnitNative GasUnit = iota // as reported by the device, see GasNativeUnits
+	GasUnitPpm
+	GasUnitPpb
+	GasUnitMass // µg/m³ for gases, mg/m³ for CO2
+)
+
+func (u GasUnit) String() string {
+	switch u {
+	case GasUnitPpm:
+		return "ppm"
+	case GasUnitPpb:
+		return "ppb"
+	case GasUnitMass:
+		return "mass"
+	default:
+		return "native"
+	}
+}
+
+const (
+	KEY_GAS_UNITS = "gas_units"
+	// Comma-separated gas keys left in the device's units, for lack of a known native unit
+	KEY_GAS_UNITS_NATIVE = "gas_units_native"
+
+	STANDARD_TEMP_C       = 25.0
+	STANDARD_PRESSURE_KPA = 101.325
+
+	gasConstant = 8.314462618 // J/(mol·K)
+)
+
+// Molar masses in g/mol. VOC is referenced to isobutylene.
+var GasMolarMasses = map[string]float64{
+	KEY_GAS_CO:   28.010,
+	KEY_GAS_O3:   47.998,
+	KEY_GAS_NH3:  17.031,
+	KEY_GAS_NO:   30.006,
+	KEY_GAS_NO2:  46.006,
+	KEY_GAS_SO2:  64.066,
+	KEY_GAS_CH2O: 30.026,
+	KEY_GAS_VOC:  56.106,
+	KEY_GAS_CH4:  16.043,
+	KEY_GAS_H2S:  34.081,
+	KEY_SCD_CO2:  44.009,
+}
+
+/*
+Mixing-ratio unit each gas key is reported in. CO2 is ppm from both the SCD41 (Sensirion SCD4x datasheet) and the
+Plantower CO2 sensor, as their `String()` methods print it. The gas board's unit per channel isn't documented in this
+package, so its keys are left out and never converted; add them once known for the firmware in use, e.g.
+`GasNativeUnits[KEY_GAS_NO2] = GasUnitPpb`.
+*/
+var GasNativeUnits = map[string]GasUnit{
+	KEY_SCD_CO2: GasUnitPpm,
+}
+
+/*
+Volume of one mole of ideal gas, in litres, at the given temperature & pressure.
+*/
+func MolarVolume(tempC, pressureKPa float64) float64 {
+	return gasConstant * (tempC + 273.15) / pressureKPa
+}
+
+/*
+Convert a gas value between units. Mass units are µg/m³ except for CO2, which is mg/m³.
+*/
+func ConvertGas(gas string, value float64, from, to GasUnit, tempC, pressureKPa float64) (float64, error) {
+	if from == GasUnitNative {
+		from = GasNativeUnits[gas]
+	}
+	if to == GasUnitNative {
+		to = GasNativeUnits[gas]
+	}
+	if from == to {
+		return value, nil
+	}
+
+	// Everything goes through ppb
+	var ppb float64
+	switch from {
+	case GasUnitPpm:
+		ppb = value * 1000
+	case GasUnitPpb:
+		ppb = value
+	case GasUnitMass:
+		mm, err := gasMassFactor(gas, tempC, pressureKPa)
+		if err != nil {
+			return 0, err
+		}
+		ppb = value / mm
+	default:
+		return 0, fmt.Errorf("no native unit known for gas %q", gas)
+	}
+
+	switch to {
+	case GasUnitPpm:
+		return ppb / 1000, nil
+	case GasUnitPpb:
+		return ppb, nil
+	case GasUnitMass:
+		mm, err := gasMassFactor(gas, tempC, pressureKPa)
+		if err != nil {
+			return 0, err
+		}
+		return ppb * mm, nil
+	default:
+		return 0, fmt.Errorf("no native unit known for gas %q", gas)
+	}
+}
+
+/*
+Mass concentration per ppb: µg/m³ per ppb, or mg/m³ per ppb for CO2.
+*/
+func gasMassFactor(gas string, tempC, pressureKPa float64) (float64, error) {
+	m, ok := GasMolarMasses[gas]
+	if !ok {
+		return 0, fmt.Errorf("no molar mass known for gas %q", gas)
+	}
+	if pressureKPa <= 0 {
+		return 0, fmt.Errorf("invalid pressure: %f kPa", pressureKPa)
+	}
+	f := m / MolarVolume(tempC, pressureKPa)
+	if gas == KEY_SCD_CO2 {
+		f /= 1000
+	}
+	return f, nil
+}
+
+/*
+Temperature and pressure to convert a sample's gases at: its own readings unless told to use standard conditions
+or the sample lacks them. Pressure readings that look like hPa are scaled to kPa.
+*/
+func gasConversionConditions(m map[string]any, standard bool) (tempC, pressureKPa float64) {
+	tempC, pressureKPa = STANDARD_TEMP_C, STANDARD_PRESSURE_KPA
+	if standard {
+		return
+	}
+	if t, ok := mapFloat(m, KEY_TEMP); ok {
+		tempC = t
+	}
+	if p, ok := mapFloat(m, KEY_MPRLS_PRESSURE); ok && p > 0 {
+		pressureKPa = MprlsMeasurement{Pressure: float32(p)}.PressureKPa()
+	}
+	return
+}
+
+/*
+Convert every gas (and CO2) in a `ToMap()` result in place, along with its `<key>_raw` copy from a calibration. The
+legacy CO2 key is left in ppm. Gases without a known native unit are left as reported and listed under
+KEY_GAS_UNITS_NATIVE.
+*/
+func convertMapGasUnits(m map[string]any, unit GasUnit, standardConditions bool) {
+	if unit == GasUnitNative {
+		return
+	}
+	tempC, pressureKPa := gasConversionConditions(m, standardConditions)
+	gases := append(append([]string{}, GasKeys...), KEY_SCD_CO2)
+	var native []string
+	for _, gas := range gases {
+		if _, ok := mapFloat(m, gas); !ok {
+			continue
+		}
+		if _, ok := GasNativeUnits[gas]; !ok {
+			native = append(native, gas)
+			continue
+		}
+		for _, k := range []string{gas, gas + KEY_SUFFIX_RAW} {
+			v, ok := mapFloat(m, k)
+			if !ok {
+				continue
+			}
+			if conv, err := ConvertGas(gas, v, GasUnitNative, unit, tempC, pressureKPa); err == nil {
+				m[k] = conv
+			}
+		}
+	}
+	m[KEY_GAS_UNITS] = unit.String()
+	if len(native) > 0 {
+		m[KEY_GAS_UNITS_NATIVE] = strings.Join(native, ",")
+	}
+}
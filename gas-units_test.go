@@ -0,0 +1,178 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"testing"
+)
+
+/*
+Register a native unit for the duration of a test, as a caller who knows their gas board firmware would.
+*/
+func setGasNativeUnitForTest(t *testing.T, gas string, unit GasUnit) {
+	GasNativeUnits[gas] = unit
+	t.Cleanup(func() { delete(GasNativeUnits, gas) })
+}
+
+func TestGasNativeUnits(t *testing.T) {
+	if GasNativeUnits[KEY_SCD_CO2] != GasUnitPpm {
+		t.Errorf("co2 native unit %s; want ppm", GasNativeUnits[KEY_SCD_CO2])
+	}
+	// The gas board's units aren't known, so its channels must not be rescaled on a guess
+	for _, gas := range GasKeys {
+		if u, ok := GasNativeUnits[gas]; ok {
+			t.Errorf("%s has a native unit, %s", gas, u)
+		}
+		if _, err := ConvertGas(gas, 1, GasUnitNative, GasUnitPpb, STANDARD_TEMP_C, STANDARD_PRESSURE_KPA); err == nil {
+			t.Errorf("%s: expected converting from the native unit to fail", gas)
+		}
+		if _, ok := GasMolarMasses[gas]; !ok {
+			t.Errorf("no molar mass for %s", gas)
+		}
+	}
+}
+
+func TestConvertGas(t *testing.T) {
+	if v := MolarVolume(STANDARD_TEMP_C, STANDARD_PRESSURE_KPA); math.Abs(v-24.465) > 1e-3 {
+		t.Errorf("molar volume at 25°C = %f L", v)
+	}
+	if v := MolarVolume(0, STANDARD_PRESSURE_KPA); math.Abs(v-22.414) > 1e-3 {
+		t.Errorf("molar volume at 0°C = %f L", v)
+	}
+	setGasNativeUnitForTest(t, KEY_GAS_NO2, GasUnitPpb)
+
+	for _, td := range []struct {
+		name          string
+		gas           string
+		value         float64
+		from, to      GasUnit
+		tempC, kPa    float64
+		want, epsilon float64
+	}{
+		{"native is a no-op", KEY_GAS_CO, 40, GasUnitNative, GasUnitNative, 0, 0, 40, 0},
+		{"native ppm to ppb", KEY_SCD_CO2, 1.5, GasUnitNative, GasUnitPpb, 0, 0, 1500, 0},
+		{"registered native ppb to ppm", KEY_GAS_NO2, 40, GasUnitNative, GasUnitPpm, 0, 0, 0.04, 1e-12},
+		{"ppb to native ppm", KEY_SCD_CO2, 2000, GasUnitPpb, GasUnitNative, 0, 0, 2, 0},
+		{"ppm to ppb", KEY_GAS_CH4, 2, GasUnitPpm, GasUnitPpb, 0, 0, 2000, 0},
+		{"no2 at standard conditions", KEY_GAS_NO2, 1, GasUnitPpb, GasUnitMass, STANDARD_TEMP_C, STANDARD_PRESSURE_KPA, 1.8804, 1e-4},
+		{"no2 at 0°C", KEY_GAS_NO2, 1, GasUnitPpb, GasUnitMass, 0, STANDARD_PRESSURE_KPA, 2.0526, 1e-4},
+		// Half the pressure, half the mass per volume
+		{"no2 at altitude", KEY_GAS_NO2, 1, GasUnitPpb, GasUnitMass, STANDARD_TEMP_C, STANDARD_PRESSURE_KPA / 2, 0.9402, 1e-4},
+		{"co2 in mg/m³", KEY_SCD_CO2, 620, GasUnitNative, GasUnitMass, STANDARD_TEMP_C, STANDARD_PRESSURE_KPA, 1115.27, 1e-2},
+		{"co in µg/m³", KEY_GAS_CO, 1, GasUnitPpm, GasUnitMass, STANDARD_TEMP_C, STANDARD_PRESSURE_KPA, 1144.9, 1e-1},
+		{"mass back to native", KEY_GAS_NO2, 1.8804, GasUnitMass, GasUnitNative, STANDARD_TEMP_C, STANDARD_PRESSURE_KPA, 1, 1e-4},
+	} {
+		got, err := ConvertGas(td.gas, td.value, td.from, td.to, td.tempC, td.kPa)
+		if err != nil || math.Abs(got-td.want) > td.epsilon {
+			t.Errorf("%s: got %f, %v; want %f", td.name, got, err, td.want)
+		}
+	}
+
+	for name, convert := range map[string]func() (float64, error){
+		"unknown gas":      func() (float64, error) { return ConvertGas("xyz", 1, GasUnitNative, GasUnitPpm, 25, 101.325) },
+		"no native unit":   func() (float64, error) { return ConvertGas(KEY_GAS_CO, 1, GasUnitPpm, GasUnitNative, 25, 101.325) },
+		"no molar mass":    func() (float64, error) { return ConvertGas("xyz", 1, GasUnitPpb, GasUnitMass, 25, 101.325) },
+		"no pressure":      func() (float64, error) { return ConvertGas(KEY_GAS_NO2, 1, GasUnitPpb, GasUnitMass, 25, 0) },
+		"mass, no density": func() (float64, error) { return ConvertGas(KEY_GAS_NO2, 1, GasUnitMass, GasUnitPpb, 25, -1) },
+	} {
+		if _, err := convert(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func gasUnitsTestMap() map[string]any {
+	d := &DuetDataMk4Var3{
+		TempRh: CombinedTempRhMeasurements{Temp: 0, Hum: 50},
+		// hPa, scaled to kPa
+		Mprls: MprlsMeasurement{Pressure: 506.625},
+		Scd:   Scd41Measurement{Co2: 620},
+		Co:    1, No2: 1,
+	}
+	return d.ToMap("")
+}
+
+func TestConvertMapGasUnits(t *testing.T) {
+	ambient := MolarVolume(0, STANDARD_PRESSURE_KPA/2)
+	standard := MolarVolume(STANDARD_TEMP_C, STANDARD_PRESSURE_KPA)
+	for _, td := range []struct {
+		name     string
+		standard bool
+		volume   float64
+	}{
+		{"ambient", false, ambient},
+		{"standard", true, standard},
+	} {
+		m := gasUnitsTestMap()
+		m[KEY_SCD_CO2+KEY_SUFFIX_RAW] = uint16(600)
+		convertMapGasUnits(m, GasUnitMass, td.standard)
+		for k, want := range map[string]float64{
+			KEY_SCD_CO2:                  620 * GasMolarMasses[KEY_SCD_CO2] / td.volume,
+			KEY_SCD_CO2 + KEY_SUFFIX_RAW: 600 * GasMolarMasses[KEY_SCD_CO2] / td.volume,
+		} {
+			if v, ok := mapFloat(m, k); !ok || math.Abs(v-want) > 1e-9*want {
+				t.Errorf("%s: %s = %v; want %f", td.name, k, m[k], want)
+			}
+		}
+		// The legacy CO2 key stays in ppm, the gas board's channels as reported
+		if m[KEY_SCD_CO2_LEGACY] != uint16(620) || m[KEY_GAS_CO] != float32(1) || m[KEY_GAS_NO2] != float32(1) {
+			t.Errorf("%s: legacy co2 %v, co %v, no2 %v", td.name, m[KEY_SCD_CO2_LEGACY], m[KEY_GAS_CO], m[KEY_GAS_NO2])
+		}
+		if m[KEY_GAS_UNITS] != "mass" {
+			t.Errorf("%s: %s = %v", td.name, KEY_GAS_UNITS, m[KEY_GAS_UNITS])
+		}
+		if native := m[KEY_GAS_UNITS_NATIVE]; native != "co,no2,ch4" {
+			t.Errorf("%s: %s = %v", td.name, KEY_GAS_UNITS_NATIVE, native)
+		}
+	}
+
+	// Once registered, a channel converts like CO2
+	setGasNativeUnitForTest(t, KEY_GAS_NO2, GasUnitPpb)
+	setGasNativeUnitForTest(t, KEY_GAS_CO, GasUnitPpm)
+	m := gasUnitsTestMap()
+	convertMapGasUnits(m, GasUnitPpb, false)
+	if m[KEY_GAS_CO] != float64(1000) || m[KEY_GAS_NO2] != float64(1) || m[KEY_SCD_CO2] != float64(620_000) {
+		t.Errorf("ppb: co %v, no2 %v, co2 %v", m[KEY_GAS_CO], m[KEY_GAS_NO2], m[KEY_SCD_CO2])
+	}
+	if native := m[KEY_GAS_UNITS_NATIVE]; native != "ch4" {
+		t.Errorf("ppb: %s = %v", KEY_GAS_UNITS_NATIVE, native)
+	}
+
+	m = gasUnitsTestMap()
+	convertMapGasUnits(m, GasUnitNative, false)
+	if _, ok := m[KEY_GAS_UNITS]; ok || m[KEY_SCD_CO2] != uint16(620) {
+		t.Errorf("native: expected the map untouched, co2 %v", m[KEY_SCD_CO2])
+	}
+}
+
+/*
+A calibrated value and its `_raw` copy must end up in the same unit, in the map and the directory files alike.
+*/
+func TestToMapWithOptionsCalibratedGasUnits(t *testing.T) {
+	d := calibrationTestSample()
+	opts := ToMapOptions{Calibrations: calibrationTestStore(t), GasUnits: GasUnitMass, GasStandardConditions: true}
+	m := ToMapWithOptions(d, "", opts)
+	perPpm := GasMolarMasses[KEY_SCD_CO2] / MolarVolume(STANDARD_TEMP_C, STANDARD_PRESSURE_KPA)
+	for k, want := range map[string]float64{
+		KEY_SCD_CO2:                  620 * perPpm,
+		KEY_SCD_CO2 + KEY_SUFFIX_RAW: 600 * perPpm,
+	} {
+		if v, ok := mapFloat(m, k); !ok || math.Abs(v-want) > 1e-9*want {
+			t.Errorf("%s = %v; want %f", k, m[k], want)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := WriteDuetDataToDirWithOptions(d, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path.Join(dir, "scd41/co2"+KEY_SUFFIX_RAW))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), fmt.Sprintf("%v\n", float32(600*perPpm)); got != want {
+		t.Errorf("scd41/co2_raw = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package telosairduetcommon
+
+import "strings"
+
+/* ~~ Gateway Telemetry ~~ */
+
+const (
+	KEY_GW_THROTTLED = "gw_throttled"
+	KEY_GW_UPTIME    = "gw_uptime_s"
+	KEY_GW_DISK_FREE = "gw_disk_free"
+	KEY_GW_FIRMWARE  = "gw_firmware"
+	KEY_GW_SOFTWARE  = "gw_software"
+	KEY_GW_LAT       = "gw_lat"
+	KEY_GW_LON       = "gw_lon"
+)
+
+/*
+Bits of the Raspberry Pi's `vcgencmd get_throttled`. The low bits are current, the high bits latch once it has
+happened since boot.
+*/
+type ThrottleFlags uint32
+
+const (
+	THROTTLE_UNDERVOLTAGE     ThrottleFlags = 1 << 0
+	THROTTLE_FREQ_CAPPED      ThrottleFlags = 1 << 1
+	THROTTLE_THROTTLED        ThrottleFlags = 1 << 2
+	THROTTLE_SOFT_TEMP_LIMIT  ThrottleFlags = 1 << 3
+	THROTTLE_UNDERVOLTAGE_HAS ThrottleFlags = 1 << 16
+	THROTTLE_FREQ_CAPPED_HAS  ThrottleFlags = 1 << 17
+	THROTTLE_THROTTLED_HAS    ThrottleFlags = 1 << 18
+	THROTTLE_SOFT_TEMP_HAS    ThrottleFlags = 1 << 19
+)
+
+var throttleFlagNames = []struct {
+	flag ThrottleFlags
+	name string
+}{
+	{THROTTLE_UNDERVOLTAGE, "undervoltage"},
+	{THROTTLE_FREQ_CAPPED, "freq_capped"},
+	{THROTTLE_THROTTLED, "throttled"},
+	{THROTTLE_SOFT_TEMP_LIMIT, "soft_temp_limit"},
+	{THROTTLE_UNDERVOLTAGE_HAS, "undervoltage_occurred"},
+	{THROTTLE_FREQ_CAPPED_HAS, "freq_capped_occurred"},
+	{THROTTLE_THROTTLED_HAS, "throttled_occurred"},
+	{THROTTLE_SOFT_TEMP_HAS, "soft_temp_limit_occurred"},
+}
+
+func (f ThrottleFlags) Has(flag ThrottleFlags) bool {
+	return f&flag == flag
+}
+
+func (f ThrottleFlags) String() string {
+	var names []string
+	for _, n := range throttleFlagNames {
+		if f.Has(n.flag) {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+/*
+State of the gateway host that forwarded a sample. Attach with `DuetData.SetGatewayTelemetry()`;
+`DuetData.SetPiMcuTemp()` sets just the CPU temperature.
+*/
+type GatewayTelemetry struct {
+	PiCpuTemp  float32 // C
+	HasCpuTemp bool
+
+	Throttled     ThrottleFlags
+	UptimeSec     uint64
+	DiskFreeBytes uint64
+
+	// Empty if unknown
+	FirmwareVersion string
+	SoftwareVersion string
+
+	Lat, Lon    float64
+	HasLocation bool
+
+	// Whether the fields other than the CPU temperature were attached
+	Present bool
+}
+
+func (t *GatewayTelemetry) setCpuTemp(val float32) {
+	t.PiCpuTemp, t.HasCpuTemp = val, true
+}
+
+/*
+t attached to a sample that already had prev. A CPU temperature in prev is kept unless t has its own.
+*/
+func (t GatewayTelemetry) attachedOver(prev GatewayTelemetry) GatewayTelemetry {
+	if !t.HasCpuTemp {
+		t.PiCpuTemp, t.HasCpuTemp = prev.PiCpuTemp, prev.HasCpuTemp
+	}
+	t.Present = true
+	return t
+}
+
+func (t GatewayTelemetry) ToMap() map[string]any {
+	ret := map[string]any{}
+	if t.HasCpuTemp {
+		ret[KEY_PI_MCU_TEMP] = t.PiCpuTemp
+	}
+	if !t.Present {
+		return ret
+	}
+	ret[KEY_GW_THROTTLED] = uint32(t.Throttled)
+	ret[KEY_GW_UPTIME] = t.UptimeSec
+	ret[KEY_GW_DISK_FREE] = t.DiskFreeBytes
+	if t.FirmwareVersion != "" {
+		ret[KEY_GW_FIRMWARE] = t.FirmwareVersion
+	}
+	if t.SoftwareVersion != "" {
+		ret[KEY_GW_SOFTWARE] = t.SoftwareVersion
+	}
+	if t.HasLocation {
+		ret[KEY_GW_LAT] = t.Lat
+		ret[KEY_GW_LON] = t.Lon
+	}
+	return ret
+}
+
+/*
+Optional, only present once attached or, for the CPU temperature, set.
+*/
+func (t GatewayTelemetry) FieldSpecs() []FieldSpec {
+	return optionalFields([]FieldSpec{
+		field(KEY_PI_MCU_TEMP, "float32", UNIT_CELSIUS, "Gateway CPU temperature"),
+		field(KEY_GW_THROTTLED, "uint32", "", "Gateway throttle bits, see ThrottleFlags"),
+		field(KEY_GW_UPTIME, "uint64", UNIT_SECONDS, "Gateway uptime"),
+		field(KEY_GW_DISK_FREE, "uint64", UNIT_BYTES, "Gateway free disk space"),
+		field(KEY_GW_FIRMWARE, "string", "", "Gateway radio firmware version"),
+		field(KEY_GW_SOFTWARE, "string", "", "Gateway software version"),
+		rangedField(KEY_GW_LAT, "float64", UNIT_DEGREES, -90, 90, "Gateway latitude"),
+		rangedField(KEY_GW_LON, "float64", UNIT_DEGREES, -180, 180, "Gateway longitude"),
+	})
+}
+
+func (t GatewayTelemetry) DirectoryName() string {
+	return "gateway"
+}
+
+/*
+Numeric fields only; disk free is in MB.
+*/
+func (t GatewayTelemetry) DirectoryData() map[string]float32 {
+	ret := map[string]float32{}
+	if t.HasCpuTemp {
+		ret["pi_cpu_temp"] = t.PiCpuTemp
+	}
+	if !t.Present {
+		return ret
+	}
+	ret["throttled"] = float32(t.Throttled)
+	ret["uptime_s"] = float32(t.UptimeSec)
+	ret["disk_free_mb"] = float32(t.DiskFreeBytes / (1 << 20))
+	if t.HasLocation {
+		ret["lat"] = float32(t.Lat)
+		ret["lon"] = float32(t.Lon)
+	}
+	return ret
+}
@@ -0,0 +1,92 @@
+package telosairduetcommon
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestThrottleFlags(t *testing.T) {
+	for _, td := range []struct {
+		flags    ThrottleFlags
+		expected string
+	}{
+		{0, "none"},
+		{0x50005, "undervoltage,throttled,undervoltage_occurred,throttled_occurred"},
+		{THROTTLE_SOFT_TEMP_HAS, "soft_temp_limit_occurred"},
+	} {
+		if s := td.flags.String(); s != td.expected {
+			t.Errorf("%#x: expected `%s`, got `%s`", uint32(td.flags), td.expected, s)
+		}
+	}
+	if f := ThrottleFlags(0x50005); !f.Has(THROTTLE_UNDERVOLTAGE|THROTTLE_THROTTLED) || f.Has(THROTTLE_FREQ_CAPPED) {
+		t.Errorf("unexpected Has() for %s", f)
+	}
+}
+
+func TestGatewayTelemetryCpuTemp(t *testing.T) {
+	d := &DuetDataMk4Var7{}
+	if m := d.ToMap(""); m[KEY_PI_MCU_TEMP] != nil || m[KEY_GW_UPTIME] != nil {
+		t.Errorf("expected no gateway keys before anything is attached: %v", m)
+	}
+
+	// Telemetry without a CPU temperature keeps the one already set
+	d.SetPiMcuTemp(48.5)
+	d.SetGatewayTelemetry(GatewayTelemetry{Throttled: THROTTLE_UNDERVOLTAGE, UptimeSec: 3600})
+	m := d.ToMap("")
+	if m[KEY_PI_MCU_TEMP] != float32(48.5) || m[KEY_GW_UPTIME] != uint64(3600) || m[KEY_GW_THROTTLED] != uint32(1) {
+		t.Errorf("unexpected gateway keys: %v", m)
+	}
+	if _, ok := m[KEY_GW_LAT]; ok {
+		t.Error("expected no gateway location")
+	}
+
+	if d.PiMcuTemp != 48.5 {
+		t.Errorf("deprecated PiMcuTemp = %v; want 48.5", d.PiMcuTemp)
+	}
+
+	// One with its own replaces it
+	d.SetGatewayTelemetry(GatewayTelemetry{PiCpuTemp: 52, HasCpuTemp: true})
+	if v := d.ToMap("")[KEY_PI_MCU_TEMP]; v != float32(52) {
+		t.Errorf("%s = %v; want 52", KEY_PI_MCU_TEMP, v)
+	}
+	if d.PiMcuTemp != 52 {
+		t.Errorf("deprecated PiMcuTemp = %v; want 52", d.PiMcuTemp)
+	}
+
+	// A CPU temperature alone emits nothing else
+	d = &DuetDataMk4Var7{}
+	d.SetPiMcuTemp(40)
+	if m := d.ToMap(""); m[KEY_PI_MCU_TEMP] != float32(40) || m[KEY_GW_DISK_FREE] != nil {
+		t.Errorf("unexpected gateway keys: %v", m)
+	}
+}
+
+func TestGatewayTelemetryDirectory(t *testing.T) {
+	dir := t.TempDir()
+	d := &DuetDataMk4Var7{}
+	d.SetGatewayTelemetry(GatewayTelemetry{PiCpuTemp: 50, HasCpuTemp: true, DiskFreeBytes: 3 << 30, Lat: 52.5, Lon: 13.4, HasLocation: true})
+	if err := WriteDuetDataToDir(d, dir); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{"pi_cpu_temp": "50", "disk_free_mb": "3072", "lat": "52.5", "throttled": "0"} {
+		b, err := os.ReadFile(path.Join(dir, "gateway", file))
+		if err != nil {
+			t.Error(err)
+		} else if strings.TrimSpace(string(b)) != expected {
+			t.Errorf("gateway/%s = %q; want %s", file, b, expected)
+		}
+	}
+
+	// No CPU temperature, no file
+	dir = t.TempDir()
+	d = &DuetDataMk4Var7{}
+	d.SetGatewayTelemetry(GatewayTelemetry{UptimeSec: 10})
+	if err := WriteDuetDataToDir(d, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dir, "gateway", "pi_cpu_temp")); !os.IsNotExist(err) {
+		t.Errorf("expected no pi_cpu_temp file, got %v", err)
+	}
+}
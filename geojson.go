@@ -0,0 +1,58 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"io"
+)
+
+/* ~~ GeoJSON (RFC 7946) ~~ */
+
+type GeoJSONGeometry struct {
+	Type string `json:"type"`
+	// [lon, lat] for a Point, [[lon, lat], ...] for a LineString
+	Coordinates any `json:"coordinates"`
+}
+
+type GeoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   GeoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+func NewGeoJSONPoint(lat, lon float64) GeoJSONGeometry {
+	return GeoJSONGeometry{Type: "Point", Coordinates: [2]float64{lon, lat}}
+}
+
+/*
+A LineString through the given [lat, lon] points. RFC 7946 requires two or more.
+*/
+func NewGeoJSONLineString(latLons [][2]float64) GeoJSONGeometry {
+	coords := make([][2]float64, len(latLons))
+	for i, p := range latLons {
+		coords[i] = [2]float64{p[1], p[0]}
+	}
+	return GeoJSONGeometry{Type: "LineString", Coordinates: coords}
+}
+
+func NewGeoJSONFeature(g GeoJSONGeometry, properties map[string]any) GeoJSONFeature {
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	return GeoJSONFeature{Type: "Feature", Geometry: g, Properties: properties}
+}
+
+func NewGeoJSONFeatureCollection(features ...GeoJSONFeature) GeoJSONFeatureCollection {
+	if features == nil {
+		features = []GeoJSONFeature{}
+	}
+	return GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+func (fc GeoJSONFeatureCollection) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(fc)
+}
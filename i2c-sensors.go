@@ -28,6 +28,12 @@ func (m CombinedTempRhMeasurements) ToMap() map[string]any {
 		KEY_HUM:  m.Hum,
 	}
 }
+func (m CombinedTempRhMeasurements) FieldSpecs() []FieldSpec {
+	return []FieldSpec{
+		rangedField(KEY_TEMP, "float32", UNIT_CELSIUS, -40, 125, "Temperature, mean of the device's sensors"),
+		rangedField(KEY_HUM, "float32", UNIT_PERCENT_RH, 0, 100, "Relative humidity, mean of the device's sensors"),
+	}
+}
 
 func (m CombinedTempRhMeasurements) DirectoryName() string {
 	return "combined_temp_rh"
@@ -39,6 +45,9 @@ func (m CombinedTempRhMeasurements) DirectoryData() map[string]float32 {
 	}
 }
 
+/*
+The plain mean used at decode time. See FuseTempRh to re-fuse a sample with another strategy.
+*/
 func CombineTempRhMeasurements(m1 TempRhMeasurement, m2 TempRhMeasurement, m3 *CombinedTempRhMeasurements) {
 	m3.Temp = (m1.Temperature() + m2.Temperature()) / 2
 	m3.Hum = (m1.Humidity() + m2.Humidity()) / 2
@@ -71,6 +80,12 @@ func (m Si7021Measurement) ToMap() map[string]any {
 		KEY_SI_HUM:  m.Hum,
 	}
 }
+func (m Si7021Measurement) FieldSpecs() []FieldSpec {
+	return []FieldSpec{
+		rangedField(KEY_SI_TEMP, "float32", UNIT_CELSIUS, -40, 125, "Si7021 temperature"),
+		rangedField(KEY_SI_HUM, "float32", UNIT_PERCENT_RH, 0, 100, "Si7021 relative humidity"),
+	}
+}
 
 func (m Si7021Measurement) DirectoryName() string {
 	return "si7021"
@@ -101,6 +116,12 @@ func (m Htu21Measurement) ToMap() map[string]any {
 		KEY_HTU_HUM:  m.Hum,
 	}
 }
+func (m Htu21Measurement) FieldSpecs() []FieldSpec {
+	return []FieldSpec{
+		rangedField(KEY_HTU_TEMP, "float32", UNIT_CELSIUS, -40, 125, "HTU21D temperature"),
+		rangedField(KEY_HTU_HUM, "float32", UNIT_PERCENT_RH, 0, 100, "HTU21D relative humidity"),
+	}
+}
 func (m Htu21Measurement) Temperature() float32 {
 	return m.Temp
 }
@@ -138,6 +159,14 @@ func (m Scd41Measurement) ToMap() map[string]any {
 		KEY_SCD_CO2_LEGACY: m.Co2,
 	}
 }
+func (m Scd41Measurement) FieldSpecs() []FieldSpec {
+	return []FieldSpec{
+		rangedField(KEY_SCD_TEMP, "float32", UNIT_CELSIUS, -10, 60, "SCD41 temperature"),
+		rangedField(KEY_SCD_HUM, "float32", UNIT_PERCENT_RH, 0, 100, "SCD41 relative humidity"),
+		rangedField(KEY_SCD_CO2, "uint16", UNIT_PPM, 0, 40000, "SCD41 CO2"),
+		rangedField(KEY_SCD_CO2_LEGACY, "uint16", UNIT_PPM, 0, 40000, "SCD41 CO2 (legacy key)"),
+	}
+}
 func (m Scd41Measurement) Temperature() float32 {
 	return m.Temp
 }
@@ -171,6 +200,12 @@ func (m PlantowerCo2Measurement) ToMap() map[string]any {
 		KEY_SCD_CO2_LEGACY: m.Co2,
 	}
 }
+func (m PlantowerCo2Measurement) FieldSpecs() []FieldSpec {
+	return []FieldSpec{
+		rangedField(KEY_SCD_CO2, "uint16", UNIT_PPM, 0, 5000, "Plantower CO2"),
+		rangedField(KEY_SCD_CO2_LEGACY, "uint16", UNIT_PPM, 0, 5000, "Plantower CO2 (legacy key)"),
+	}
+}
 func (m PlantowerCo2Measurement) DirectoryName() string {
 	return "plantower_co2"
 }
@@ -194,6 +229,9 @@ func (m *Sgp30Measurement) ToMap() map[string]any {
 		KEY_TVOC: m.Tvoc,
 	}
 }
+func (m *Sgp30Measurement) FieldSpecs() []FieldSpec {
+	return []FieldSpec{rangedField(KEY_TVOC, "int32", UNIT_PPB, 0, 60000, "SGP30 TVOC")}
+}
 func (m Sgp30Measurement) DirectoryName() string {
 	return "sgp30"
 }
@@ -218,6 +256,9 @@ func (m *Sgp40Measurement) ToMap() map[string]any {
 		KEY_VOC_INDEX: m.VocIndex,
 	}
 }
+func (m *Sgp40Measurement) FieldSpecs() []FieldSpec {
+	return []FieldSpec{rangedField(KEY_VOC_INDEX, "uint32", "", 0, 500, "SGP40 VOC index")}
+}
 
 func (m Sgp40Measurement) DirectoryName() string {
 	return "sgp40"
@@ -243,6 +284,13 @@ func (m *MprlsMeasurement) ToMap() map[string]any {
 	}
 }
 
+/*
+Range covers firmware that reports hPa rather than kPa.
+*/
+func (m *MprlsMeasurement) FieldSpecs() []FieldSpec {
+	return []FieldSpec{rangedField(KEY_MPRLS_PRESSURE, "float32", UNIT_KPA, 0, 1200, "MPRLS absolute pressure")}
+}
+
 func (m MprlsMeasurement) DirectoryName() string {
 	return "mprls"
 }
@@ -0,0 +1,409 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+/* ~~ Link Statistics ~~ */
+
+const (
+	// Key used for the per-device aggregate across every gateway that heard it.
+	LinkStatsAllGateways = "*"
+
+	defaultLinkStatsHistoryLen = 256
+	linkStatsCadenceLen        = 32
+	linkStatsRecentSamplesLen  = 64
+	// An inferred cadence is settled once this many intervals agree with it; until then earlier intervals are re-checked.
+	linkStatsSettleLen = 5
+
+	// A gap of more than this many expected cadences counts as lost samples.
+	linkStatsGapFactor = 1.5
+)
+
+/*
+Tracks radio link health per (device serial, gateway serial) and per device across all gateways.
+Missing samples are counted against the nominal sample cadence, set per device, per variant or as DefaultCadenceMs.
+Without one the cadence is inferred as the median of the device's own SampleTimeMs intervals. Until that median has
+settled, intervals that turn out to be gaps by it are moved to the missing count, so a lossy start is counted once a
+few regular intervals have arrived. A device whose cadence changes while it settles has the longer intervals counted
+as missing too; set a nominal cadence where that matters.
+Safe for concurrent use.
+*/
+type LinkStatsTracker struct {
+	// Number of RSSI/SNR/hop observations kept per link for histograms & percentiles.
+	HistoryLen int
+	// Nominal sample cadence for devices without a per-device or per-variant one; 0 to infer it.
+	DefaultCadenceMs uint32
+
+	mu              sync.Mutex
+	links           map[linkStatsKey]*linkStats
+	cadenceByDevice map[uint16]uint32
+	cadenceByType   map[string]uint32
+}
+
+type linkStatsKey struct {
+	serialNumber  uint16
+	gatewaySerial string
+}
+
+type linkStats struct {
+	firstUnix, lastUnix uint32
+	lastSampleTimeMs    uint32
+	lastResetUnix       uint32
+	seen                bool
+	nominalCadenceMs    uint32
+
+	intervals    []uint32 // recent positive sample intervals, ms
+	recent       []uint32 // recent sample times, for duplicate detection
+	recentCursor int
+
+	received, missing, duplicates, resets uint64
+
+	rssi, snr, hops []float64
+	radioCursor     int
+}
+
+type HistogramBin struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+type LinkMetricSummary struct {
+	Count     int            `json:"count"`
+	Min       float64        `json:"min"`
+	Max       float64        `json:"max"`
+	Mean      float64        `json:"mean"`
+	P10       float64        `json:"p10"`
+	P50       float64        `json:"p50"`
+	P90       float64        `json:"p90"`
+	Histogram []HistogramBin `json:"histogram"`
+}
+
+type LinkStatsSnapshot struct {
+	SerialNumber      uint16            `json:"serial_number"`
+	GatewaySerial     string            `json:"gateway_serial"`
+	FirstUnix         uint32            `json:"first_unix"`
+	LastUnix          uint32            `json:"last_unix"`
+	ExpectedCadenceMs uint32            `json:"expected_cadence_ms"`
+	CadenceNominal    bool              `json:"cadence_nominal"`
+	Received          uint64            `json:"received"`
+	Expected          uint64            `json:"expected"`
+	Missing           uint64            `json:"missing"`
+	Duplicates        uint64            `json:"duplicates"`
+	Resets            uint64            `json:"resets"`
+	PacketLoss        float64           `json:"packet_loss"`
+	Rssi              LinkMetricSummary `json:"rssi"`
+	Snr               LinkMetricSummary `json:"snr"`
+	Hops              LinkMetricSummary `json:"hops"`
+}
+
+func NewLinkStatsTracker() *LinkStatsTracker {
+	return &LinkStatsTracker{HistoryLen: defaultLinkStatsHistoryLen}
+}
+
+/*
+Set the nominal sample cadence for every device of a variant, by its type alias.
+*/
+func (t *LinkStatsTracker) SetCadenceForVariant(typeAlias string, cadenceMs uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cadenceByType == nil {
+		t.cadenceByType = map[string]uint32{}
+	}
+	t.cadenceByType[typeAlias] = cadenceMs
+}
+
+/*
+Set the nominal sample cadence for one device, overriding its variant's.
+*/
+func (t *LinkStatsTracker) SetCadenceForDevice(serialNumber uint16, cadenceMs uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cadenceByDevice == nil {
+		t.cadenceByDevice = map[uint16]uint32{}
+	}
+	t.cadenceByDevice[serialNumber] = cadenceMs
+}
+
+func (t *LinkStatsTracker) nominalCadenceMs(d DuetData) uint32 {
+	if c, ok := t.cadenceByDevice[d.GetSerialNumber()]; ok {
+		return c
+	}
+	if c, ok := t.cadenceByType[d.GetTypeInfo().TypeAlias]; ok {
+		return c
+	}
+	return t.DefaultCadenceMs
+}
+
+/*
+Record a received sample as heard by the given gateway.
+The sample is counted both against that gateway's link and the device's all-gateway aggregate.
+*/
+func (t *LinkStatsTracker) Record(d DuetData, gatewaySerial string) {
+	if gatewaySerial == LinkStatsAllGateways {
+		gatewaySerial = ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.links == nil {
+		t.links = map[linkStatsKey]*linkStats{}
+	}
+	historyLen := t.HistoryLen
+	if historyLen <= 0 {
+		historyLen = defaultLinkStatsHistoryLen
+	}
+
+	sn := d.GetSerialNumber()
+	nominal := t.nominalCadenceMs(d)
+	for _, gw := range []string{gatewaySerial, LinkStatsAllGateways} {
+		k := linkStatsKey{sn, gw}
+		ls, ok := t.links[k]
+		if !ok {
+			ls = &linkStats{}
+			t.links[k] = ls
+		}
+		ls.nominalCadenceMs = nominal
+		ls.record(d, historyLen)
+	}
+}
+
+func (ls *linkStats) record(d DuetData, historyLen int) {
+	sampleMs := d.GetSampleTimeMs()
+	resetUnix := d.GetLastResetUnix()
+	unix := d.Timestamp()
+
+	if !ls.seen {
+		ls.seen = true
+		ls.firstUnix = unix
+		ls.received++
+		ls.lastSampleTimeMs = sampleMs
+		ls.lastResetUnix = resetUnix
+		ls.lastUnix = unix
+		ls.rememberSample(sampleMs)
+		ls.recordRadio(d.GetRadioData(), historyLen)
+		return
+	}
+
+	// Reboots restart SampleTimeMs, so neither the gap nor the sample-time history carries over.
+	if resetMovedForward(ls.lastResetUnix, resetUnix) {
+		ls.resets++
+		ls.recent = ls.recent[:0]
+		ls.recentCursor = 0
+		ls.lastSampleTimeMs = sampleMs
+		ls.lastResetUnix = resetUnix
+	}
+
+	if ls.isRecentSample(sampleMs) {
+		ls.duplicates++
+		return
+	}
+	ls.received++
+	ls.rememberSample(sampleMs)
+	ls.recordRadio(d.GetRadioData(), historyLen)
+	if unix > ls.lastUnix {
+		ls.lastUnix = unix
+	}
+
+	switch {
+	case sampleMs > ls.lastSampleTimeMs:
+		gap := sampleMs - ls.lastSampleTimeMs
+		if cadence := ls.cadenceMs(); cadence > 0 && float64(gap) > linkStatsGapFactor*float64(cadence) {
+			if n := uint64(math.Round(float64(gap)/float64(cadence))) - 1; n > 0 {
+				ls.missing += n
+			}
+		} else {
+			ls.pushInterval(gap, linkStatsCadenceLen)
+			if ls.nominalCadenceMs == 0 && len(ls.intervals) <= linkStatsSettleLen {
+				ls.recountUnsettledGaps()
+			}
+		}
+		ls.lastSampleTimeMs = sampleMs
+	case sampleMs < ls.lastSampleTimeMs:
+		// Late arrival of a sample we already counted as missing
+		if ls.missing > 0 {
+			ls.missing--
+		}
+	}
+}
+
+func (ls *linkStats) isRecentSample(sampleMs uint32) bool {
+	for _, v := range ls.recent {
+		if v == sampleMs {
+			return true
+		}
+	}
+	return false
+}
+
+func (ls *linkStats) rememberSample(sampleMs uint32) {
+	if len(ls.recent) < linkStatsRecentSamplesLen {
+		ls.recent = append(ls.recent, sampleMs)
+		return
+	}
+	ls.recent[ls.recentCursor] = sampleMs
+	ls.recentCursor = (ls.recentCursor + 1) % linkStatsRecentSamplesLen
+}
+
+func (ls *linkStats) pushInterval(gap uint32, maxLen int) {
+	if len(ls.intervals) >= maxLen {
+		ls.intervals = ls.intervals[1:]
+	}
+	ls.intervals = append(ls.intervals, gap)
+}
+
+/*
+While an inferred cadence settles, a gap taken for an interval can hold the median up. Move intervals that are gaps by
+the current median to the missing count, until none are left.
+*/
+func (ls *linkStats) recountUnsettledGaps() {
+	for {
+		cadence := float64(ls.cadenceMs())
+		kept := ls.intervals[:0]
+		for _, v := range ls.intervals {
+			if float64(v) > linkStatsGapFactor*cadence {
+				ls.missing += uint64(math.Round(float64(v)/cadence)) - 1
+				continue
+			}
+			kept = append(kept, v)
+		}
+		if len(kept) == len(ls.intervals) {
+			return
+		}
+		ls.intervals = kept
+	}
+}
+
+/*
+The expected cadence is the nominal one if set, else the median of recently observed intervals that were not themselves counted as gaps.
+*/
+func (ls *linkStats) cadenceMs() uint32 {
+	if ls.nominalCadenceMs > 0 {
+		return ls.nominalCadenceMs
+	}
+	if len(ls.intervals) == 0 {
+		return 0
+	}
+	vals := make([]float64, len(ls.intervals))
+	for i, v := range ls.intervals {
+		vals[i] = float64(v)
+	}
+	return uint32(median(vals))
+}
+
+func (ls *linkStats) recordRadio(m RadioMetadata, historyLen int) {
+	if !m.Present {
+		return
+	}
+	if len(ls.rssi) < historyLen {
+		ls.rssi = append(ls.rssi, float64(m.LastRssi))
+		ls.snr = append(ls.snr, float64(m.LastSnr))
+		ls.hops = append(ls.hops, float64(m.Hops))
+		return
+	}
+	ls.rssi[ls.radioCursor] = float64(m.LastRssi)
+	ls.snr[ls.radioCursor] = float64(m.LastSnr)
+	ls.hops[ls.radioCursor] = float64(m.Hops)
+	ls.radioCursor = (ls.radioCursor + 1) % historyLen
+}
+
+func (ls *linkStats) snapshot(k linkStatsKey) LinkStatsSnapshot {
+	s := LinkStatsSnapshot{
+		SerialNumber:      k.serialNumber,
+		GatewaySerial:     k.gatewaySerial,
+		FirstUnix:         ls.firstUnix,
+		LastUnix:          ls.lastUnix,
+		ExpectedCadenceMs: ls.cadenceMs(),
+		CadenceNominal:    ls.nominalCadenceMs > 0,
+		Received:          ls.received,
+		Expected:          ls.received + ls.missing,
+		Missing:           ls.missing,
+		Duplicates:        ls.duplicates,
+		Resets:            ls.resets,
+		Rssi:              summarizeLinkMetric(ls.rssi, 10),
+		Snr:               summarizeLinkMetric(ls.snr, 2),
+		Hops:              summarizeLinkMetric(ls.hops, 1),
+	}
+	if s.Expected > 0 {
+		s.PacketLoss = float64(s.Missing) / float64(s.Expected)
+	}
+	return s
+}
+
+func summarizeLinkMetric(vals []float64, binWidth float64) LinkMetricSummary {
+	ret := LinkMetricSummary{Count: len(vals)}
+	if len(vals) == 0 {
+		return ret
+	}
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	ret.Min = sorted[0]
+	ret.Max = sorted[len(sorted)-1]
+	ret.Mean = sum / float64(len(sorted))
+	ret.P10 = percentileSorted(sorted, 10)
+	ret.P50 = percentileSorted(sorted, 50)
+	ret.P90 = percentileSorted(sorted, 90)
+
+	for _, v := range sorted {
+		lower := math.Floor(v/binWidth) * binWidth
+		if n := len(ret.Histogram); n > 0 && ret.Histogram[n-1].Lower == lower {
+			ret.Histogram[n-1].Count++
+			continue
+		}
+		ret.Histogram = append(ret.Histogram, HistogramBin{Lower: lower, Upper: lower + binWidth, Count: 1})
+	}
+	return ret
+}
+
+/*
+Link statistics for one device as heard by one gateway, or by every gateway if given LinkStatsAllGateways.
+*/
+func (t *LinkStatsTracker) Snapshot(serialNumber uint16, gatewaySerial string) (LinkStatsSnapshot, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := linkStatsKey{serialNumber, gatewaySerial}
+	ls, ok := t.links[k]
+	if !ok {
+		return LinkStatsSnapshot{}, false
+	}
+	return ls.snapshot(k), true
+}
+
+/*
+Link statistics for every tracked link, ordered by serial number then gateway serial.
+*/
+func (t *LinkStatsTracker) Snapshots() []LinkStatsSnapshot {
+	t.mu.Lock()
+	ret := make([]LinkStatsSnapshot, 0, len(t.links))
+	for k, ls := range t.links {
+		ret = append(ret, ls.snapshot(k))
+	}
+	t.mu.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].SerialNumber != ret[j].SerialNumber {
+			return ret[i].SerialNumber < ret[j].SerialNumber
+		}
+		return ret[i].GatewaySerial < ret[j].GatewaySerial
+	})
+	return ret
+}
+
+func (t *LinkStatsTracker) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(t.Snapshots()); err != nil {
+		return fmt.Errorf("failed to encode link stats: %w", err)
+	}
+	return nil
+}
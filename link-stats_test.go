@@ -0,0 +1,87 @@
+package telosairduetcommon
+
+import (
+	"testing"
+)
+
+func linkStatsTestSample(serialNumber uint16, sampleMs uint32) *DuetDataMk4Var7 {
+	return &DuetDataMk4Var7{SerialNumber: serialNumber, SampleTimeMs: sampleMs, UnixSec: 1000 + sampleMs/1000, LastResetUnix: 500}
+}
+
+// A minute cadence that loses the two samples after the first
+var linkStatsLossyStart = []uint32{0, 180_000, 240_000, 300_000, 360_000}
+
+func TestLinkStatsNominalCadence(t *testing.T) {
+	inferred := NewLinkStatsTracker()
+	nominal := NewLinkStatsTracker()
+	nominal.SetCadenceForVariant(DuetTypeMk4Var7.TypeAlias, 60_000)
+	for _, ms := range linkStatsLossyStart {
+		inferred.Record(linkStatsTestSample(7, ms), "gw")
+		nominal.Record(linkStatsTestSample(7, ms), "gw")
+	}
+
+	// The early gap is the first interval, and counted once the regular ones outvote it
+	s, _ := inferred.Snapshot(7, "gw")
+	if s.ExpectedCadenceMs != 60_000 || s.CadenceNominal || s.Missing != 2 || s.Expected != 7 {
+		t.Errorf("unexpected inferred snapshot: %+v", s)
+	}
+	// Once settled, later gaps are counted as they arrive
+	inferred.Record(linkStatsTestSample(7, 540_000), "gw")
+	if s, _ := inferred.Snapshot(7, "gw"); s.Missing != 4 {
+		t.Errorf("inferred: missing %d after a later gap; want 4", s.Missing)
+	}
+
+	s, ok := nominal.Snapshot(7, "gw")
+	if !ok {
+		t.Fatal("no snapshot for the link")
+	}
+	if s.ExpectedCadenceMs != 60_000 || !s.CadenceNominal || s.Received != 5 || s.Missing != 2 || s.Expected != 7 {
+		t.Errorf("unexpected snapshot: %+v", s)
+	}
+	if all, _ := nominal.Snapshot(7, LinkStatsAllGateways); all.Missing != 2 {
+		t.Errorf("all-gateway aggregate missing %d; want 2", all.Missing)
+	}
+}
+
+func TestLinkStatsCadencePrecedence(t *testing.T) {
+	tr := NewLinkStatsTracker()
+	tr.DefaultCadenceMs = 10_000
+	tr.SetCadenceForVariant(DuetTypeMk4Var7.TypeAlias, 30_000)
+	tr.SetCadenceForDevice(8, 60_000)
+	for _, sn := range []uint16{7, 8} {
+		tr.Record(linkStatsTestSample(sn, 0), "gw")
+	}
+	tr.Record(&DuetDataMk4Var16{SerialNumber: 9}, "gw")
+
+	for sn, want := range map[uint16]uint32{7: 30_000, 8: 60_000, 9: 10_000} {
+		if s, _ := tr.Snapshot(sn, "gw"); s.ExpectedCadenceMs != want {
+			t.Errorf("device %d cadence %d; want %d", sn, s.ExpectedCadenceMs, want)
+		}
+	}
+}
+
+func TestLinkStatsDuplicatesAndResets(t *testing.T) {
+	tr := NewLinkStatsTracker()
+	tr.DefaultCadenceMs = 60_000
+	for _, ms := range []uint32{0, 60_000, 60_000, 180_000, 120_000} {
+		tr.Record(linkStatsTestSample(7, ms), "gw")
+	}
+	s, _ := tr.Snapshot(7, "gw")
+	// The late 120 s sample cancels the loss counted at 180 s
+	if s.Received != 4 || s.Duplicates != 1 || s.Missing != 0 {
+		t.Errorf("unexpected snapshot: %+v", s)
+	}
+
+	// After a reboot SampleTimeMs restarts, so the old times are neither duplicates nor a gap
+	d := linkStatsTestSample(7, 60_000)
+	d.LastResetUnix = 2000
+	tr.Record(d, "gw")
+	s, _ = tr.Snapshot(7, "gw")
+	if s.Resets != 1 || s.Duplicates != 1 || s.Received != 5 || s.Missing != 0 {
+		t.Errorf("unexpected snapshot after a reset: %+v", s)
+	}
+
+	if _, ok := tr.Snapshot(7, "other"); ok {
+		t.Error("unexpected snapshot for an unknown gateway")
+	}
+}
@@ -0,0 +1,204 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+/* ~~ LoRaWAN Network Server Uplinks ~~ */
+
+/*
+A Duet uplink as delivered by a LoRaWAN network server, independent of which one.
+*/
+type LoRaWANUplink struct {
+	DevEUI     string
+	DeviceName string
+	FPort      uint8
+	FCnt       uint32
+	Payload    []byte
+	ReceivedAt time.Time // network server time
+	RxInfo     []LoRaWANRxInfo
+}
+
+type LoRaWANRxInfo struct {
+	GatewayId string
+	Rssi      int
+	Snr       float64
+	Time      time.Time
+}
+
+/*
+The gateway that heard the uplink best (highest RSSI, then SNR).
+*/
+func (u LoRaWANUplink) BestRx() (LoRaWANRxInfo, bool) {
+	if len(u.RxInfo) == 0 {
+		return LoRaWANRxInfo{}, false
+	}
+	best := u.RxInfo[0]
+	for _, rx := range u.RxInfo[1:] {
+		if rx.Rssi > best.Rssi || (rx.Rssi == best.Rssi && rx.Snr > best.Snr) {
+			best = rx
+		}
+	}
+	return best, true
+}
+
+/*
+Radio metadata from the best receiving gateway. LoRaWAN has no mesh, so hops is always 0,
+and there is no device-side send time since the network server timestamps the uplink itself.
+*/
+func (u LoRaWANUplink) RadioMetadata() RadioMetadata {
+	rx, ok := u.BestRx()
+	if !ok {
+		return RadioMetadata{}
+	}
+	return NewRadioMetadata(int16(rx.Rssi), int32(math.Round(rx.Snr)), 0, 0)
+}
+
+/* ~~ ChirpStack (v4 integration event) ~~ */
+type chirpStackUplink struct {
+	Time       time.Time `json:"time"`
+	DeviceInfo struct {
+		DevEui     string `json:"devEui"`
+		DeviceName string `json:"deviceName"`
+	} `json:"deviceInfo"`
+	FCnt   uint32 `json:"fCnt"`
+	FPort  uint8  `json:"fPort"`
+	Data   []byte `json:"data"`
+	RxInfo []struct {
+		GatewayId string    `json:"gatewayId"`
+		Rssi      int       `json:"rssi"`
+		Snr       float64   `json:"snr"`
+		GwTime    time.Time `json:"gwTime"`
+		NsTime    time.Time `json:"nsTime"`
+	} `json:"rxInfo"`
+}
+
+func ParseChirpStackUplink(b []byte) (LoRaWANUplink, error) {
+	var raw chirpStackUplink
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return LoRaWANUplink{}, fmt.Errorf("failed to decode chirpstack uplink: %w", err)
+	}
+	u := LoRaWANUplink{
+		DevEUI:     raw.DeviceInfo.DevEui,
+		DeviceName: raw.DeviceInfo.DeviceName,
+		FPort:      raw.FPort,
+		FCnt:       raw.FCnt,
+		Payload:    raw.Data,
+		ReceivedAt: raw.Time,
+	}
+	for _, rx := range raw.RxInfo {
+		u.RxInfo = append(u.RxInfo, LoRaWANRxInfo{
+			GatewayId: rx.GatewayId,
+			Rssi:      rx.Rssi,
+			Snr:       rx.Snr,
+			Time:      rx.GwTime,
+		})
+		if u.ReceivedAt.IsZero() {
+			u.ReceivedAt = rx.NsTime
+		}
+	}
+	return u, nil
+}
+
+/* ~~ The Things Stack (v3 uplink message) ~~ */
+type ttnUplink struct {
+	EndDeviceIds struct {
+		DeviceId string `json:"device_id"`
+		DevEui   string `json:"dev_eui"`
+	} `json:"end_device_ids"`
+	ReceivedAt    time.Time `json:"received_at"`
+	UplinkMessage struct {
+		FPort      uint8     `json:"f_port"`
+		FCnt       uint32    `json:"f_cnt"`
+		FrmPayload []byte    `json:"frm_payload"`
+		ReceivedAt time.Time `json:"received_at"`
+		RxMetadata []struct {
+			GatewayIds struct {
+				GatewayId string `json:"gateway_id"`
+			} `json:"gateway_ids"`
+			Rssi int       `json:"rssi"`
+			Snr  float64   `json:"snr"`
+			Time time.Time `json:"time"`
+		} `json:"rx_metadata"`
+	} `json:"uplink_message"`
+}
+
+func ParseTTNUplink(b []byte) (LoRaWANUplink, error) {
+	var raw ttnUplink
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return LoRaWANUplink{}, fmt.Errorf("failed to decode ttn uplink: %w", err)
+	}
+	msg := raw.UplinkMessage
+	u := LoRaWANUplink{
+		DevEUI:     raw.EndDeviceIds.DevEui,
+		DeviceName: raw.EndDeviceIds.DeviceId,
+		FPort:      msg.FPort,
+		FCnt:       msg.FCnt,
+		Payload:    msg.FrmPayload,
+		ReceivedAt: msg.ReceivedAt,
+	}
+	if u.ReceivedAt.IsZero() {
+		u.ReceivedAt = raw.ReceivedAt
+	}
+	for _, rx := range msg.RxMetadata {
+		u.RxInfo = append(u.RxInfo, LoRaWANRxInfo{
+			GatewayId: rx.GatewayIds.GatewayId,
+			Rssi:      rx.Rssi,
+			Snr:       rx.Snr,
+			Time:      rx.Time,
+		})
+	}
+	return u, nil
+}
+
+/*
+Decode the Duet sample carried in a LoRaWAN uplink. The sample is timestamped by the network server,
+since LoRaWAN uplinks are sent as soon as they are sampled. Without a network server time the sample is left
+unresolved, with neither its time nor its last reset time set.
+*/
+func DuetDataFromLoRaWANUplink(u LoRaWANUplink) (DuetData, error) {
+	if u.FPort == 0 {
+		return nil, fmt.Errorf("uplink from %s is on fPort 0 (MAC commands only)", u.DevEUI)
+	}
+	if len(u.Payload) == 0 {
+		return nil, fmt.Errorf("uplink from %s has no payload", u.DevEUI)
+	}
+	d, err := duetDataFromBytes(u.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode uplink from %s: %w", u.DevEUI, err)
+	}
+
+	d.SetConnectionType(CONNECTION_TYPE_LORAWAN)
+	if rm := u.RadioMetadata(); rm.Present {
+		d.SetRadioData(rm)
+	}
+	timeOk := !u.ReceivedAt.IsZero()
+	if timeOk {
+		d.SetTimeSerial(uint32(u.ReceivedAt.Unix()))
+		d.RecalculateLastResetUnix()
+	}
+	d.MarkTimeResolved(timeOk)
+
+	return d, nil
+}
+
+func DuetDataFromChirpStackUplink(b []byte) (DuetData, LoRaWANUplink, error) {
+	u, err := ParseChirpStackUplink(b)
+	if err != nil {
+		return nil, u, err
+	}
+	d, err := DuetDataFromLoRaWANUplink(u)
+	return d, u, err
+}
+
+func DuetDataFromTTNUplink(b []byte) (DuetData, LoRaWANUplink, error) {
+	u, err := ParseTTNUplink(b)
+	if err != nil {
+		return nil, u, err
+	}
+	d, err := DuetDataFromLoRaWANUplink(u)
+	return d, u, err
+}
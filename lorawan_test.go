@@ -0,0 +1,188 @@
+package telosairduetcommon
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Mk4.7, serial 1234, 3600 s since boot, 612 ppm CO2, HTU 21.5C / 40%, 101.3 kPa
+const loraWANTestPayload = "BAcAMtIEZAJlAAAAgO42AAAArEEAALBBAAAgQgAAKEKamcpCAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+
+// Shaped like a ChirpStack v4 "up" integration event
+const chirpStackTestUplink = `{
+	"deduplicationId": "3ac7e3c4-4401-4b8d-9386-a5c902f9202d",
+	"time": "2024-03-05T10:15:30.541271+00:00",
+	"deviceInfo": {
+		"tenantId": "52f14cd4-c6f1-4fbd-8f87-4025e1d49242",
+		"tenantName": "ChirpStack",
+		"applicationId": "17c82e96-be03-4f38-aef3-f83d48582d97",
+		"applicationName": "duet",
+		"deviceProfileId": "14855bf7-d10d-4aee-b618-ebfcb64dc7ad",
+		"deviceProfileName": "Duet Mk4",
+		"deviceName": "duet-1234",
+		"devEui": "0101010101010101",
+		"deviceClassEnabled": "CLASS_A",
+		"tags": {}
+	},
+	"devAddr": "00a4b1c2",
+	"adr": true,
+	"dr": 5,
+	"fCnt": 42,
+	"fPort": 1,
+	"confirmed": false,
+	"data": "` + loraWANTestPayload + `",
+	"rxInfo": [
+		{
+			"gatewayId": "0016c001f153a14c",
+			"uplinkId": 61238,
+			"gwTime": "2024-03-05T10:15:30.512+00:00",
+			"nsTime": "2024-03-05T10:15:30.530843+00:00",
+			"rssi": -97,
+			"snr": 3.2,
+			"channel": 1,
+			"location": {},
+			"context": "EFwMtA==",
+			"metadata": {"region_config_id": "eu868", "region_common_name": "EU868"},
+			"crcStatus": "CRC_OK"
+		},
+		{
+			"gatewayId": "0016c001f153a14d",
+			"uplinkId": 3912,
+			"nsTime": "2024-03-05T10:15:30.531002+00:00",
+			"rssi": -61,
+			"snr": 9.6,
+			"channel": 1,
+			"location": {},
+			"context": "AAAAAA==",
+			"crcStatus": "CRC_OK"
+		}
+	],
+	"txInfo": {
+		"frequency": 868300000,
+		"modulation": {"lora": {"bandwidth": 125000, "spreadingFactor": 7, "codeRate": "CR_4_5"}}
+	}
+}`
+
+// Shaped like a The Things Stack v3 uplink message
+const ttnTestUplink = `{
+	"end_device_ids": {
+		"device_id": "duet-1234",
+		"application_ids": {"application_id": "duet"},
+		"dev_eui": "70B3D57ED0051234",
+		"dev_addr": "260B1234"
+	},
+	"correlation_ids": ["as:up:01HR5ZJ0G5Y0K8G8Z5WQ0N3B9P", "rpc:/ttn.lorawan.v3.AppAs/SimulateUplink:0b2d"],
+	"received_at": "2024-03-05T10:15:30.612345678Z",
+	"uplink_message": {
+		"session_key_id": "AYXB2rYhUTkkAAAAAAAAAA==",
+		"f_port": 1,
+		"f_cnt": 42,
+		"frm_payload": "` + loraWANTestPayload + `",
+		"rx_metadata": [
+			{
+				"gateway_ids": {"gateway_id": "eui-b827ebfffe8b1234", "eui": "B827EBFFFE8B1234"},
+				"time": "2024-03-05T10:15:30.384Z",
+				"timestamp": 2040934975,
+				"rssi": -51,
+				"channel_rssi": -51,
+				"snr": 9.75,
+				"uplink_token": "CiIKIAoUZXVpLWI4MjdlYmZmZmU4YjEyMzQSCLgn6//+ixI0EL/QmM0HGgwIm5WmrwYQ+ZeJiAEgmMOyjLxb",
+				"received_at": "2024-03-05T10:15:30.401Z"
+			}
+		],
+		"settings": {
+			"data_rate": {"lora": {"bandwidth": 125000, "spreading_factor": 7, "coding_rate": "4/5"}},
+			"frequency": "868300000",
+			"timestamp": 2040934975
+		},
+		"received_at": "2024-03-05T10:15:30.404Z",
+		"consumed_airtime": "0.133376s",
+		"network_ids": {"net_id": "000013", "tenant_id": "ttn", "cluster_id": "eu1", "cluster_address": "eu1.cloud.thethings.network"}
+	}
+}`
+
+func checkLoRaWANTestSample(t *testing.T, d DuetData, unix uint32) {
+	t.Helper()
+	dd, ok := d.(*DuetDataMk4Var7)
+	if !ok {
+		t.Fatalf("expected a Mk4.7, got %T", d)
+	}
+	if dd.SerialNumber != 1234 || dd.Scd.Co2 != 612 || dd.Htu.Temp != 21.5 || dd.Mprls.Pressure != 101.3 {
+		t.Errorf("unexpected sample: %s", dd.String())
+	}
+	if dd.ConnectionType != CONNECTION_TYPE_LORAWAN || d.Timestamp() != unix || d.GetLastResetUnix() != unix-3600 || !d.TimeResolved() {
+		t.Errorf("unexpected time: unix %d, last reset %d, resolved %v", d.Timestamp(), d.GetLastResetUnix(), d.TimeResolved())
+	}
+}
+
+func TestChirpStackUplink(t *testing.T) {
+	d, u, err := DuetDataFromChirpStackUplink([]byte(chirpStackTestUplink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DevEUI != "0101010101010101" || u.DeviceName != "duet-1234" || u.FCnt != 42 || u.FPort != 1 || len(u.RxInfo) != 2 {
+		t.Errorf("unexpected uplink: %+v", u)
+	}
+	checkLoRaWANTestSample(t, d, uint32(time.Date(2024, 3, 5, 10, 15, 30, 0, time.UTC).Unix()))
+
+	// The stronger of the two gateways, SNR rounded
+	rm := d.GetRadioData()
+	if !rm.Present || rm.LastRssi != -61 || rm.LastSnr != 10 || rm.Hops != 0 {
+		t.Errorf("unexpected radio metadata: %s", rm.String())
+	}
+}
+
+func TestTTNUplink(t *testing.T) {
+	d, u, err := DuetDataFromTTNUplink([]byte(ttnTestUplink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DevEUI != "70B3D57ED0051234" || u.FCnt != 42 || len(u.RxInfo) != 1 || u.RxInfo[0].GatewayId != "eui-b827ebfffe8b1234" {
+		t.Errorf("unexpected uplink: %+v", u)
+	}
+	// The uplink's own received_at rather than the message's
+	if u.ReceivedAt.Nanosecond() != 404_000_000 {
+		t.Errorf("unexpected received at: %s", u.ReceivedAt)
+	}
+	checkLoRaWANTestSample(t, d, uint32(time.Date(2024, 3, 5, 10, 15, 30, 0, time.UTC).Unix()))
+	if rm := d.GetRadioData(); rm.LastRssi != -51 || rm.LastSnr != 10 {
+		t.Errorf("unexpected radio metadata: %s", rm.String())
+	}
+}
+
+func TestLoRaWANUplinkWithoutRxInfoOrTime(t *testing.T) {
+	// ChirpStack falls back to the gateways' network server time
+	noTime := strings.Replace(chirpStackTestUplink, `"time": "2024-03-05T10:15:30.541271+00:00",`, "", 1)
+	_, u, err := DuetDataFromChirpStackUplink([]byte(noTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ReceivedAt.Second() != 30 {
+		t.Errorf("expected the nsTime fallback, got %s", u.ReceivedAt)
+	}
+
+	bare := `{"deviceInfo": {"devEui": "0101010101010101"}, "fCnt": 7, "fPort": 1, "data": "` + loraWANTestPayload + `"}`
+	d, u, err := DuetDataFromChirpStackUplink([]byte(bare))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rm := d.GetRadioData(); len(u.RxInfo) != 0 || rm.Present {
+		t.Errorf("expected no radio metadata, got %s", rm.String())
+	}
+	// No time: left unresolved rather than a last reset wrapped around past 2100
+	if d.TimeResolved() || d.Timestamp() != 0 || d.GetLastResetUnix() != 0 {
+		t.Errorf("unexpected time: unix %d, last reset %d, resolved %v", d.Timestamp(), d.GetLastResetUnix(), d.TimeResolved())
+	}
+
+	for name, b := range map[string]string{
+		"fPort 0":    `{"fPort": 0, "data": "` + loraWANTestPayload + `"}`,
+		"no payload": `{"fPort": 1}`,
+		"bad base64": `{"fPort": 1, "data": "not base64!"}`,
+		"short":      `{"fPort": 1, "data": "BAcAMg=="}`,
+	} {
+		if _, _, err := DuetDataFromChirpStackUplink([]byte(b)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
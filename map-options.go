@@ -0,0 +1,136 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+)
+
+/* ~~ ToMap Output Options ~~ */
+
+type ToMapOptions struct {
+	// Per-device corrections, applied before anything else. Nil for none.
+	Calibrations *CalibrationStore
+
+	// Units for gas and CO2 values, see convertMapGasUnits. The zero value keeps the device's own units.
+	GasUnits GasUnit
+	// Convert using 25°C & 101.325kPa rather than the sample's own temperature & pressure.
+	GasStandardConditions bool
+
+	// Add dew point, heat index etc., see DeriveMeteorology.
+	DerivedMeteorology bool
+	// Site elevation in m, for sea-level pressure. Only used if HasElevation.
+	ElevationM   float64
+	HasElevation bool
+
+	// Duct flow & ventilation indicators for airflow variants. Nil for none; a config without a duct or room volume adds nothing.
+	Hvac *HvacConfig
+}
+
+/*
+`d.ToMap()` with optional post-processing. With zero-value options the result is identical to `d.ToMap()`.
+*/
+func ToMapWithOptions(d DuetData, gatewaySerial string, opts ToMapOptions) map[string]any {
+	m := d.ToMap(gatewaySerial)
+	if opts.Calibrations != nil {
+		opts.Calibrations.ApplyToMap(d, m)
+	}
+	if opts.DerivedMeteorology {
+		// From the corrected temperature & humidity
+		if met, ok := deriveMeteorologyFromMap(m, opts.ElevationM, opts.HasElevation); ok {
+			for k, v := range met.ToMap() {
+				m[k] = v
+			}
+		}
+	}
+	if opts.Hvac != nil {
+		if s, ok := opts.Hvac.Analyze(d); ok {
+			maps.Copy(m, s.ToMap())
+		}
+	}
+	convertMapGasUnits(m, opts.GasUnits, opts.GasStandardConditions)
+	return m
+}
+
+// `ToMap()` key each directory file mirrors, by sensor directory. Only these files take the map's post-processing.
+var directoryMapKeys = map[string]map[string]string{
+	"combined_temp_rh": {"temperature": KEY_TEMP, "humidity": KEY_HUM},
+	"scd41":            {"co2": KEY_SCD_CO2},
+	"plantower_co2":    {"co2": KEY_SCD_CO2},
+	"pms5003": {
+		"pm1": "pm10_m", "pm2p5": "pm25_m", "pm10": "pm100_m",
+		"pn0p3": "pn03_m", "pn0p5": "pn05_m", "pn1": "pn10_m", "pn2p5": "pn25_m", "pn5": "pn50_m", "pn10": "pn100_m",
+	},
+	"sps30": {
+		"pm1": "pm10_m", "pm2p5": "pm25_m", "pm4": "pm40_m", "pm10": "pm100_m",
+		"pn0p5": "pn05_m", "pn1": "pn10_m", "pn2p5": "pn25_m", "pn4": "pn40_m", "pn10": "pn100_m",
+		"typical_size": KEY_PREFIX_TYP_SIZE + "_m",
+	},
+	"alphasense-opc-n3": {"PM1": "pm10_m", "PM2.5": "pm25_m", "PM10": "pm100_m"},
+	"gas":               gasDirectoryMapKeys(),
+}
+
+func gasDirectoryMapKeys() map[string]string {
+	ret := map[string]string{}
+	for _, k := range GasKeys {
+		ret[k] = k
+	}
+	return ret
+}
+
+/*
+A measurement whose directory files take their values from a post-processed `ToMap()` result.
+*/
+type processedMeasurement struct {
+	SensorMeasurement
+	m map[string]any
+}
+
+func (p processedMeasurement) DirectoryData() map[string]float32 {
+	data := p.SensorMeasurement.DirectoryData()
+	for file, key := range directoryMapKeys[p.DirectoryName()] {
+		if _, ok := data[file]; !ok {
+			continue
+		}
+		if v, ok := mapFloat(p.m, key); ok {
+			data[file] = float32(v)
+		}
+		if raw, ok := mapFloat(p.m, key+KEY_SUFFIX_RAW); ok {
+			data[file+KEY_SUFFIX_RAW] = float32(raw)
+		}
+	}
+	return data
+}
+
+/*
+`WriteDuetDataToDir()` with the same post-processing as ToMapWithOptions, so the two agree. Files mirroring a
+`ToMap()` key hold the corrected, unit-converted value, and `<file>_raw` the original wherever a calibration changed
+it. The calibration version and gas units are written as text files in `dir`, and derived blocks as their own sensor
+directories.
+*/
+func WriteDuetDataToDirWithOptions(d DuetData, dir string, opts ToMapOptions) error {
+	m := ToMapWithOptions(d, "", opts)
+	if err := writeDuetDataToDir(d, dir, func(sm SensorMeasurement) SensorMeasurement {
+		return processedMeasurement{sm, m}
+	}); err != nil {
+		return err
+	}
+	for _, k := range []string{KEY_CALIBRATION_VERSION, KEY_GAS_UNITS, KEY_GAS_UNITS_NATIVE} {
+		if v, ok := m[k].(string); ok {
+			filePath := path.Join(dir, k)
+			if err := os.WriteFile(filePath, []byte(v+"\n"), 0644); err != nil {
+				return fmt.Errorf("failed to write file %q: %w", filePath, err)
+			}
+		}
+	}
+	if opts.DerivedMeteorology {
+		// From the corrected temperature & humidity, as in the map
+		if met, ok := deriveMeteorologyFromMap(m, opts.ElevationM, opts.HasElevation); ok {
+			if err := StoreSensorData(met, dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"math"
+)
+
+/* ~~ Derived Meteorological Quantities ~~ */
+
+const (
+	KEY_DEW_POINT          = "dew_point"
+	KEY_ABS_HUMIDITY       = "abs_hum"
+	KEY_HUMIDITY_RATIO     = "hum_ratio"
+	KEY_HEAT_INDEX         = "heat_index"
+	KEY_WET_BULB           = "wet_bulb"
+	KEY_PRESSURE_ALTITUDE  = "pressure_alt"
+	KEY_SEA_LEVEL_PRESSURE = "pressure_msl"
+
+	// Magnus coefficients over water (Sonntag 1990)
+	magnusA = 17.62
+	magnusB = 243.12 // °C
+
+	// International Standard Atmosphere lapse rate, K/m
+	isaLapseRate = 0.0065
+)
+
+/*
+Saturation vapour pressure over water in kPa, Magnus approximation.
+*/
+func saturationVapourPressure(tempC float64) float64 {
+	return 0.6112 * math.Exp(magnusA*tempC/(magnusB+tempC))
+}
+
+func (m CombinedTempRhMeasurements) vapourPressure() float64 {
+	return float64(m.Hum) / 100 * saturationVapourPressure(float64(m.Temp))
+}
+
+/*
+Dew point in °C (Magnus formula). NaN for a humidity of 0 or less.
+*/
+func (m CombinedTempRhMeasurements) DewPoint() float32 {
+	if m.Hum <= 0 {
+		return float32(math.NaN())
+	}
+	g := math.Log(float64(m.Hum)/100) + magnusA*float64(m.Temp)/(magnusB+float64(m.Temp))
+	return float32(magnusB * g / (magnusA - g))
+}
+
+/*
+Water vapour density in g/m³.
+*/
+func (m CombinedTempRhMeasurements) AbsoluteHumidity() float32 {
+	// e [Pa] / (Rv [J/(kg·K)] * T [K]), in g/m³
+	return float32(m.vapourPressure() * 1e3 / (461.5 * (float64(m.Temp) + 273.15)) * 1e3)
+}
+
+/*
+Mass of water vapour per mass of dry air in g/kg, at the given pressure in kPa.
+*/
+func (m CombinedTempRhMeasurements) HumidityRatio(pressureKPa float64) float32 {
+	e := m.vapourPressure()
+	if pressureKPa <= e {
+		return float32(math.NaN())
+	}
+	return float32(621.97 * e / (pressureKPa - e))
+}
+
+/*
+Apparent temperature in °C, per the US National Weather Service (Rothfusz regression with its adjustments).
+*/
+func (m CombinedTempRhMeasurements) HeatIndex() float32 {
+	t := float64(m.Temp)*9/5 + 32
+	rh := float64(m.Hum)
+
+	hi := 0.5 * (t + 61.0 + (t-68.0)*1.2 + rh*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+			6.83783e-3*t*t - 5.481717e-2*rh*rh + 1.22874e-3*t*t*rh +
+			8.5282e-4*t*rh*rh - 1.99e-6*t*t*rh*rh
+		switch {
+		case rh < 13 && t >= 80 && t <= 112:
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		case rh > 85 && t >= 80 && t <= 87:
+			hi += (rh - 85) / 10 * (87 - t) / 5
+		}
+	}
+	return float32((hi - 32) * 5 / 9)
+}
+
+/*
+Wet-bulb temperature in °C at sea-level pressure (Stull 2011). Valid for 5-99%RH and -20-50°C; saturated air is
+at its dry-bulb temperature, and below 5%RH the result is NaN.
+*/
+func (m CombinedTempRhMeasurements) WetBulb() float32 {
+	t := float64(m.Temp)
+	rh := float64(m.Hum)
+	switch {
+	case rh >= 100:
+		return m.Temp
+	case rh < 5:
+		return float32(math.NaN())
+	}
+	return float32(t*math.Atan(0.151977*math.Sqrt(rh+8.313659)) +
+		math.Atan(t+rh) - math.Atan(rh-1.676331) +
+		0.00391838*math.Pow(rh, 1.5)*math.Atan(0.023101*rh) - 4.686035)
+}
+
+/*
+Pressure in kPa. Some firmware reports the MPRLS in hPa; readings too large to be kPa are scaled.
+*/
+func (m MprlsMeasurement) PressureKPa() float64 {
+	p := float64(m.Pressure)
+	if p > 200 {
+		p /= 10
+	}
+	return p
+}
+
+/*
+Altitude in m at which the International Standard Atmosphere has this pressure.
+*/
+func (m MprlsMeasurement) PressureAltitude() float32 {
+	p := m.PressureKPa()
+	if p <= 0 {
+		return float32(math.NaN())
+	}
+	return float32(44330.8 * (1 - math.Pow(p/STANDARD_PRESSURE_KPA, 0.190263)))
+}
+
+/*
+Pressure in kPa reduced to sea level from a station at the given elevation (m) and temperature (°C).
+*/
+func (m MprlsMeasurement) SeaLevelPressure(elevationM, tempC float64) float32 {
+	tK := tempC + 273.15
+	return float32(m.PressureKPa() * math.Pow(1-isaLapseRate*elevationM/(tK+isaLapseRate*elevationM), -5.257))
+}
+
+/*
+Quantities derived from a sample's combined temperature & humidity and, where present, its pressure.
+*/
+type DerivedMeteorology struct {
+	DewPoint         float32 // °C
+	AbsoluteHumidity float32 // g/m³
+	HumidityRatio    float32 // g/kg
+	HeatIndex        float32 // °C
+	WetBulb          float32 // °C
+
+	PressureAltitude float32 // m
+	SeaLevelPressure float32 // kPa
+
+	pressureSet, seaLevelSet bool
+}
+
+/*
+Derive meteorological quantities for a sample. Without a pressure reading the humidity ratio is at standard pressure;
+the sea-level pressure needs both a pressure reading and `haveElevation`. Returns false if the sample has no temperature,
+or no humidity in (0, 100] (a failed humidity sensor reads 0).
+*/
+func DeriveMeteorology(d DuetData, elevationM float64, haveElevation bool) (DerivedMeteorology, bool) {
+	return deriveMeteorologyFromMap(d.ToMap(""), elevationM, haveElevation)
+}
+
+func deriveMeteorologyFromMap(m map[string]any, elevationM float64, haveElevation bool) (DerivedMeteorology, bool) {
+	var ret DerivedMeteorology
+	t, okT := mapFloat(m, KEY_TEMP)
+	h, okH := mapFloat(m, KEY_HUM)
+	if !okT || !okH || math.IsNaN(t) || math.IsInf(t, 0) || !(h > 0 && h <= 100) {
+		return ret, false
+	}
+	th := CombinedTempRhMeasurements{Temp: float32(t), Hum: float32(h)}
+
+	pressureKPa := STANDARD_PRESSURE_KPA
+	if p, ok := mapFloat(m, KEY_MPRLS_PRESSURE); ok && p > 0 {
+		mprls := MprlsMeasurement{Pressure: float32(p)}
+		pressureKPa = mprls.PressureKPa()
+		ret.PressureAltitude = mprls.PressureAltitude()
+		ret.pressureSet = true
+		if haveElevation {
+			ret.SeaLevelPressure = mprls.SeaLevelPressure(elevationM, t)
+			ret.seaLevelSet = true
+		}
+	}
+
+	ret.DewPoint = th.DewPoint()
+	ret.AbsoluteHumidity = th.AbsoluteHumidity()
+	ret.HumidityRatio = th.HumidityRatio(pressureKPa)
+	ret.HeatIndex = th.HeatIndex()
+	ret.WetBulb = th.WetBulb()
+	return ret, true
+}
+
+func (m DerivedMeteorology) String() string {
+	return fmt.Sprintf("Dew point %.1fC, heat index %.1fC, wet bulb %.1fC, %.1fg/m3", m.DewPoint, m.HeatIndex, m.WetBulb, m.AbsoluteHumidity)
+}
+
+/*
+Non-finite values (e.g. a wet bulb out of range) are left out, they can't be encoded as JSON.
+*/
+func (m DerivedMeteorology) ToMap() map[string]any {
+	ret := map[string]any{}
+	for k, v := range m.DirectoryData() {
+		ret[derivedMeteorologyKeys[k]] = v
+	}
+	return ret
+}
+
+func (m DerivedMeteorology) DirectoryName() string {
+	return "derived_meteorology"
+}
+
+// DirectoryData() file names to ToMap() keys
+var derivedMeteorologyKeys = map[string]string{
+	"dew_point":          KEY_DEW_POINT,
+	"absolute_humidity":  KEY_ABS_HUMIDITY,
+	"humidity_ratio":     KEY_HUMIDITY_RATIO,
+	"heat_index":         KEY_HEAT_INDEX,
+	"wet_bulb":           KEY_WET_BULB,
+	"pressure_altitude":  KEY_PRESSURE_ALTITUDE,
+	"sea_level_pressure": KEY_SEA_LEVEL_PRESSURE,
+}
+
+/*
+Non-finite values are left out, as in `ToMap()`.
+*/
+func (m DerivedMeteorology) DirectoryData() map[string]float32 {
+	ret := map[string]float32{
+		"dew_point":         m.DewPoint,
+		"absolute_humidity": m.AbsoluteHumidity,
+		"humidity_ratio":    m.HumidityRatio,
+		"heat_index":        m.HeatIndex,
+		"wet_bulb":          m.WetBulb,
+	}
+	if m.pressureSet {
+		ret["pressure_altitude"] = m.PressureAltitude
+	}
+	if m.seaLevelSet {
+		ret["sea_level_pressure"] = m.SeaLevelPressure
+	}
+	for k, v := range ret {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			delete(ret, k)
+		}
+	}
+	return ret
+}
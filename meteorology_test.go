@@ -0,0 +1,88 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func fToC(f float64) float32 {
+	return float32((f - 32) * 5 / 9)
+}
+
+/*
+Reference values: dew points from the NOAA calculator, heat indices from the NWS heat index chart, the wet bulb from
+Stull (2011) and humidity ratios from the ASHRAE psychrometric tables.
+*/
+func TestMeteorologyReferenceValues(t *testing.T) {
+	nan := math.NaN()
+	for _, td := range []struct {
+		temp, hum                            float32
+		dewPoint, heatIndex, wetBulb, humRat float64
+	}{
+		{20, 50, 9.3, float64(fToC(66.85)), 13.7, 7.26},
+		{fToC(90), 70, 26.0, float64(fToC(106)), 27.5, 21.4},
+		{fToC(96), 40, 19.9, float64(fToC(101)), 25.0, 14.6},
+		{fToC(80), 40, 12.0, float64(fToC(80)), 17.7, 8.7},
+		{fToC(86), 100, float64(fToC(86)), float64(fToC(112)), float64(fToC(86)), 27.33},
+		{20, 100, 20, float64(fToC(69.2)), 20, 14.75},
+		{20, 0, nan, float64(fToC(64.5)), nan, 0},
+	} {
+		m := CombinedTempRhMeasurements{Temp: td.temp, Hum: td.hum}
+		for _, v := range []struct {
+			name      string
+			got, want float64
+			tol       float64
+		}{
+			{"DewPoint", float64(m.DewPoint()), td.dewPoint, 0.2},
+			{"HeatIndex", float64(m.HeatIndex()), td.heatIndex, 0.6},
+			{"WetBulb", float64(m.WetBulb()), td.wetBulb, 0.3},
+			{"HumidityRatio", float64(m.HumidityRatio(STANDARD_PRESSURE_KPA)), td.humRat, 0.25}, // Magnus runs slightly low against Hyland-Wexler
+		} {
+			if math.IsNaN(v.want) {
+				if !math.IsNaN(v.got) {
+					t.Errorf("%s(%.1fC, %.0f%%) = %.2f; want NaN", v.name, td.temp, td.hum, v.got)
+				}
+			} else if math.Abs(v.got-v.want) > v.tol {
+				t.Errorf("%s(%.1fC, %.0f%%) = %.2f; want %.2f", v.name, td.temp, td.hum, v.got, v.want)
+			}
+		}
+	}
+}
+
+func TestDeriveMeteorologyRejectsBadHumidity(t *testing.T) {
+	for _, m := range []map[string]any{
+		{KEY_TEMP: float32(20), KEY_HUM: float32(0)},
+		{KEY_TEMP: float32(20), KEY_HUM: float32(-3)},
+		{KEY_TEMP: float32(20), KEY_HUM: float32(101)},
+		{KEY_HUM: float32(50)},
+		{KEY_TEMP: float32(math.NaN()), KEY_HUM: float32(50)},
+	} {
+		if _, ok := deriveMeteorologyFromMap(m, 0, false); ok {
+			t.Errorf("expected %v to be rejected", m)
+		}
+	}
+
+	// A zeroed humidity sensor must not break JSON encoding of the whole sample
+	d := &DuetDataMk4Var7{TempRh: CombinedTempRhMeasurements{Temp: 20, Hum: 0}}
+	out := ToMapWithOptions(d, "", ToMapOptions{DerivedMeteorology: true})
+	if _, err := json.Marshal(out); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out[KEY_DEW_POINT]; ok {
+		t.Errorf("expected no dew point for 0%%RH, got %v", out[KEY_DEW_POINT])
+	}
+
+	// Out-of-range values are dropped from the block, the rest stay
+	met, ok := deriveMeteorologyFromMap(map[string]any{KEY_TEMP: float32(20), KEY_HUM: float32(3)}, 0, false)
+	if !ok {
+		t.Fatal("expected 3%RH to be accepted")
+	}
+	m := met.ToMap()
+	if _, ok := m[KEY_WET_BULB]; ok {
+		t.Error("expected the out-of-range wet bulb to be left out")
+	}
+	if _, ok := m[KEY_DEW_POINT]; !ok {
+		t.Error("expected a dew point at 3%RH")
+	}
+}
@@ -0,0 +1,378 @@
+package telosairduetcommon
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+/* ~~ Mobile Monitoring ~~ */
+
+/*
+Implemented by variants carrying a GPS receiver.
+*/
+type GpsLocated interface {
+	DuetData
+	Location() (lat, lon float32)
+}
+
+var (
+	ErrGpsNoFix      = errors.New("no gps fix")
+	ErrGpsOutOfRange = errors.New("gps position out of range")
+	ErrGpsJump       = errors.New("gps position jumped implausibly far")
+)
+
+const earthRadiusM = 6371008.8
+
+/*
+Great-circle distance in m.
+*/
+func HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	φ1, φ2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dφ := φ2 - φ1
+	dλ := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dφ/2)*math.Sin(dφ/2) + math.Cos(φ1)*math.Cos(φ2)*math.Sin(dλ/2)*math.Sin(dλ/2)
+	return 2 * earthRadiusM * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+/*
+Initial bearing from the first point to the second, in degrees clockwise from north, [0, 360).
+*/
+func InitialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	φ1, φ2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dλ := (lon2 - lon1) * math.Pi / 180
+	y := math.Sin(dλ) * math.Cos(φ2)
+	x := math.Cos(φ1)*math.Sin(φ2) - math.Sin(φ1)*math.Cos(φ2)*math.Cos(dλ)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+/*
+Check a position is a plausible fix: not NaN, in range, and not the (0, 0) the receiver reports without a fix.
+*/
+func ValidateGpsFix(lat, lon float64) error {
+	if math.IsNaN(lat) || math.IsNaN(lon) || (lat == 0 && lon == 0) {
+		return ErrGpsNoFix
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return fmt.Errorf("%w: %f, %f", ErrGpsOutOfRange, lat, lon)
+	}
+	return nil
+}
+
+/* ~~ Geohash ~~ */
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+/*
+Geohash of a position. Precision 7 cells are about 150m across, 8 about 40m.
+*/
+func Geohash(lat, lon float64, precision int) string {
+	latLo, latHi := -90.0, 90.0
+	lonLo, lonHi := -180.0, 180.0
+	var sb strings.Builder
+	bit, ch, even := 0, 0, true
+	for sb.Len() < precision {
+		if even {
+			mid := (lonLo + lonHi) / 2
+			if lon >= mid {
+				ch = ch<<1 | 1
+				lonLo = mid
+			} else {
+				ch <<= 1
+				lonHi = mid
+			}
+		} else {
+			mid := (latLo + latHi) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				latLo = mid
+			} else {
+				ch <<= 1
+				latHi = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			sb.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+/*
+Centre of a geohash cell.
+*/
+func GeohashCenter(hash string) (lat, lon float64, err error) {
+	latLo, latHi := -90.0, 90.0
+	lonLo, lonHi := -180.0, 180.0
+	even := true
+	for _, c := range hash {
+		idx := strings.IndexRune(geohashAlphabet, c)
+		if idx < 0 {
+			return 0, 0, fmt.Errorf("invalid geohash character %q in %q", c, hash)
+		}
+		for b := 4; b >= 0; b-- {
+			set := idx>>b&1 == 1
+			if even {
+				if mid := (lonLo + lonHi) / 2; set {
+					lonLo = mid
+				} else {
+					lonHi = mid
+				}
+			} else {
+				if mid := (latLo + latHi) / 2; set {
+					latLo = mid
+				} else {
+					latHi = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return (latLo + latHi) / 2, (lonLo + lonHi) / 2, nil
+}
+
+/* ~~ Tracks & Trips ~~ */
+
+// `ToMap()` values carried along a track
+var mobileValueKeys = []string{"pm10_m", "pm25_m", "pm100_m", KEY_SCD_CO2, KEY_TEMP, KEY_HUM}
+
+type TrackPoint struct {
+	UnixSec    uint32
+	Lat, Lon   float64
+	SpeedMps   float64 // from the previous point of the trip, 0 for the first
+	HeadingDeg float64
+	Geohash    string
+	Values     map[string]float64
+}
+
+type Trip struct {
+	SerialNumber uint16
+	Points       []TrackPoint
+}
+
+func (t Trip) Start() uint32 {
+	if len(t.Points) == 0 {
+		return 0
+	}
+	return t.Points[0].UnixSec
+}
+func (t Trip) End() uint32 {
+	if len(t.Points) == 0 {
+		return 0
+	}
+	return t.Points[len(t.Points)-1].UnixSec
+}
+
+/*
+Distance travelled in m.
+*/
+func (t Trip) Distance() float64 {
+	d := 0.0
+	for i := 1; i < len(t.Points); i++ {
+		a, b := t.Points[i-1], t.Points[i]
+		d += HaversineDistance(a.Lat, a.Lon, b.Lat, b.Lon)
+	}
+	return d
+}
+
+/*
+The route as a LineString feature, followed by one Point feature per sample carrying its PM & CO2 values.
+A LineString needs two positions, so a one-point trip's route is a Point and an empty trip has none.
+*/
+func (t Trip) GeoJSON() GeoJSONFeatureCollection {
+	features := make([]GeoJSONFeature, 0, len(t.Points)+1)
+	if len(t.Points) > 0 {
+		route := NewGeoJSONPoint(t.Points[0].Lat, t.Points[0].Lon)
+		if len(t.Points) > 1 {
+			latLons := make([][2]float64, len(t.Points))
+			for i, p := range t.Points {
+				latLons[i] = [2]float64{p.Lat, p.Lon}
+			}
+			route = NewGeoJSONLineString(latLons)
+		}
+		features = append(features, NewGeoJSONFeature(route, map[string]any{
+			KEY_SERIAL_NUMBER: t.SerialNumber,
+			"start":           t.Start(),
+			"end":             t.End(),
+			"distance_m":      t.Distance(),
+		}))
+	}
+	for _, p := range t.Points {
+		props := map[string]any{
+			KEY_UNIX:    p.UnixSec,
+			"speed_mps": p.SpeedMps,
+			"heading":   p.HeadingDeg,
+			"geohash":   p.Geohash,
+		}
+		for k, v := range p.Values {
+			props[k] = v
+		}
+		features = append(features, NewGeoJSONFeature(NewGeoJSONPoint(p.Lat, p.Lon), props))
+	}
+	return NewGeoJSONFeatureCollection(features...)
+}
+
+/*
+Mean values of the track points falling in one geohash cell.
+*/
+type SpatialBin struct {
+	Geohash         string
+	CenterLat       float64
+	CenterLon       float64
+	Count           int
+	Mean            map[string]float64
+	FirstSeen, Last uint32
+}
+
+/*
+Bin track points into geohash cells of the given precision, in order of first visit.
+*/
+func SpatialBins(points []TrackPoint, precision int) []SpatialBin {
+	idx := map[string]int{}
+	var bins []SpatialBin
+	sums := []map[string]float64{}
+	counts := []map[string]int{}
+	for _, p := range points {
+		h := Geohash(p.Lat, p.Lon, precision)
+		i, ok := idx[h]
+		if !ok {
+			lat, lon, _ := GeohashCenter(h)
+			i = len(bins)
+			idx[h] = i
+			bins = append(bins, SpatialBin{Geohash: h, CenterLat: lat, CenterLon: lon, FirstSeen: p.UnixSec})
+			sums = append(sums, map[string]float64{})
+			counts = append(counts, map[string]int{})
+		}
+		bins[i].Count++
+		bins[i].Last = p.UnixSec
+		for k, v := range p.Values {
+			sums[i][k] += v
+			counts[i][k]++
+		}
+	}
+	for i := range bins {
+		bins[i].Mean = map[string]float64{}
+		for k, s := range sums[i] {
+			bins[i].Mean[k] = s / float64(counts[i][k])
+		}
+	}
+	return bins
+}
+
+/*
+Builds validated tracks from GPS variants' samples and splits them into trips. Safe for concurrent use.
+*/
+type MobileTracker struct {
+	// Fixes implying a faster speed than this from the last accepted fix are rejected.
+	MaxSpeedMps float64
+	// After this many jumps in a row the last accepted fix is taken to be the bad one, and the track restarts from the
+	// next fix. 0 never restarts.
+	MaxJumpRejections int
+	// A gap in samples longer than this, in seconds, ends a trip. The device is usually parked and powered off.
+	TripGap uint32
+	// Geohash precision for TrackPoint.Geohash
+	GeohashPrecision int
+
+	mu    sync.Mutex
+	trips map[uint16][]Trip
+	jumps map[uint16]int // consecutive jump rejections per device
+}
+
+func NewMobileTracker() *MobileTracker {
+	return &MobileTracker{
+		MaxSpeedMps:       70,
+		MaxJumpRejections: 3,
+		TripGap:           300,
+		GeohashPrecision:  8,
+		trips:             map[uint16][]Trip{},
+		jumps:             map[uint16]int{},
+	}
+}
+
+/*
+Add a sample from a GPS variant. Samples with a bad fix or an implausible jump are rejected with an error and don't
+affect the track, until `MaxJumpRejections` jumps in a row re-anchor it. Samples must arrive in time order per device.
+*/
+func (mt *MobileTracker) Add(d DuetData) (TrackPoint, error) {
+	gd, ok := d.(GpsLocated)
+	if !ok {
+		return TrackPoint{}, fmt.Errorf("type %s has no gps", d.GetTypeInfo().TypeAlias)
+	}
+	lat32, lon32 := gd.Location()
+	lat, lon := float64(lat32), float64(lon32)
+	if err := ValidateGpsFix(lat, lon); err != nil {
+		return TrackPoint{}, err
+	}
+
+	p := TrackPoint{UnixSec: d.Timestamp(), Lat: lat, Lon: lon, Geohash: Geohash(lat, lon, mt.GeohashPrecision), Values: map[string]float64{}}
+	m := d.ToMap("")
+	for _, k := range mobileValueKeys {
+		if v, ok := mapFloat(m, k); ok {
+			p.Values[k] = v
+		}
+	}
+
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	if mt.trips == nil {
+		mt.trips = map[uint16][]Trip{}
+	}
+	if mt.jumps == nil {
+		mt.jumps = map[uint16]int{}
+	}
+	sn := d.GetSerialNumber()
+	trips := mt.trips[sn]
+
+	newTrip := len(trips) == 0
+	if !newTrip {
+		trip := &trips[len(trips)-1]
+		prev := trip.Points[len(trip.Points)-1]
+		if p.UnixSec <= prev.UnixSec {
+			return TrackPoint{}, fmt.Errorf("sample at %d is not after the last at %d", p.UnixSec, prev.UnixSec)
+		}
+		dt := float64(p.UnixSec - prev.UnixSec)
+		dist := HaversineDistance(prev.Lat, prev.Lon, lat, lon)
+		jump := mt.MaxSpeedMps > 0 && dist/dt > mt.MaxSpeedMps
+		if jump && (mt.MaxJumpRejections <= 0 || mt.jumps[sn] < mt.MaxJumpRejections) {
+			mt.jumps[sn]++
+			return TrackPoint{}, fmt.Errorf("%w: %.0fm in %.0fs", ErrGpsJump, dist, dt)
+		}
+		if jump {
+			// Re-anchor. A trip that is only the bad fix is dropped rather than kept as a stray point.
+			if len(trip.Points) == 1 {
+				trips = trips[:len(trips)-1]
+			}
+			newTrip = true
+		} else if mt.TripGap > 0 && p.UnixSec-prev.UnixSec > mt.TripGap {
+			newTrip = true
+		} else {
+			p.SpeedMps = dist / dt
+			p.HeadingDeg = InitialBearing(prev.Lat, prev.Lon, lat, lon)
+		}
+	}
+
+	mt.jumps[sn] = 0
+	if newTrip {
+		trips = append(trips, Trip{SerialNumber: sn})
+	}
+	trips[len(trips)-1].Points = append(trips[len(trips)-1].Points, p)
+	mt.trips[sn] = trips
+	return p, nil
+}
+
+/*
+The device's trips so far, oldest first. The last may still be in progress.
+*/
+func (mt *MobileTracker) Trips(serialNumber uint16) []Trip {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	ret := make([]Trip, len(mt.trips[serialNumber]))
+	for i, t := range mt.trips[serialNumber] {
+		ret[i] = Trip{SerialNumber: t.SerialNumber, Points: append([]TrackPoint(nil), t.Points...)}
+	}
+	return ret
+}
@@ -0,0 +1,160 @@
+package telosairduetcommon
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestHaversineDistanceAndBearing(t *testing.T) {
+	quarterMeridian := math.Pi * earthRadiusM / 2
+	for _, td := range []struct {
+		lat1, lon1, lat2, lon2 float64
+		dist, distTol, bearing float64
+	}{
+		{0, 0, 0, 1, 111195.08, 0.01, 90},
+		{0, 1, 0, 0, 111195.08, 0.01, 270},
+		{0, 0, 1, 0, 111195.08, 0.01, 0},
+		{1, 0, 0, 0, 111195.08, 0.01, 180},
+		{0, 0, 90, 0, quarterMeridian, 0.01, 0},
+		// Paris to London, 343.56 km on the mean-radius sphere
+		{48.8566, 2.3522, 51.5074, -0.1278, 343_560, 10, 330.1},
+	} {
+		if d := HaversineDistance(td.lat1, td.lon1, td.lat2, td.lon2); math.Abs(d-td.dist) > td.distTol {
+			t.Errorf("HaversineDistance(%v, %v, %v, %v) = %.2f; want %.2f", td.lat1, td.lon1, td.lat2, td.lon2, d, td.dist)
+		}
+		if b := InitialBearing(td.lat1, td.lon1, td.lat2, td.lon2); math.Abs(b-td.bearing) > 0.1 {
+			t.Errorf("InitialBearing(%v, %v, %v, %v) = %.2f; want %.2f", td.lat1, td.lon1, td.lat2, td.lon2, b, td.bearing)
+		}
+	}
+}
+
+func TestGeohash(t *testing.T) {
+	if h := Geohash(57.64911, 10.40744, 11); h != "u4pruydqqvj" {
+		t.Errorf("Geohash = %s; want u4pruydqqvj", h)
+	}
+	lat, lon, err := GeohashCenter("u4pruydqqvj")
+	if err != nil || math.Abs(lat-57.64911) > 1e-5 || math.Abs(lon-10.40744) > 1e-5 {
+		t.Errorf("GeohashCenter = %f, %f, %v", lat, lon, err)
+	}
+	if _, _, err := GeohashCenter("u4a"); err == nil {
+		t.Error("expected an error for an invalid character")
+	}
+}
+
+func gpsTestSample(unix uint32, lat, lon float32) *DuetDataMk4Var12 {
+	return &DuetDataMk4Var12{SerialNumber: 5, UnixSec: unix, Latitude: lat, Longitude: lon, Scd: Scd41Measurement{Co2: 500}}
+}
+
+// About 8 m/s north per 60 s sample
+const gpsTestStepDeg = 0.0045
+
+func TestMobileTrackerTrips(t *testing.T) {
+	mt := NewMobileTracker()
+	for i := 0; i < 3; i++ {
+		if _, err := mt.Add(gpsTestSample(1000+uint32(i)*60, 52.4+float32(i)*gpsTestStepDeg, 13.1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Parked, then a second trip
+	if _, err := mt.Add(gpsTestSample(5000, 52.5, 13.1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mt.Add(gpsTestSample(4000, 52.5, 13.1)); err == nil {
+		t.Error("expected an out-of-order sample to be rejected")
+	}
+	if _, err := mt.Add(gpsTestSample(5060, 0, 0)); !errors.Is(err, ErrGpsNoFix) {
+		t.Errorf("expected ErrGpsNoFix, got %v", err)
+	}
+
+	trips := mt.Trips(5)
+	if len(trips) != 2 || len(trips[0].Points) != 3 || len(trips[1].Points) != 1 {
+		t.Fatalf("unexpected trips: %+v", trips)
+	}
+	p := trips[0].Points[2]
+	if math.Abs(p.SpeedMps-8.34) > 0.05 || math.Abs(p.HeadingDeg) > 0.1 || p.Values[KEY_SCD_CO2] != 500 {
+		t.Errorf("unexpected track point: %+v", p)
+	}
+	if trips[1].Points[0].SpeedMps != 0 {
+		t.Error("expected no speed across a trip gap")
+	}
+	if d := trips[0].Distance(); math.Abs(d-1000.6) > 2 {
+		t.Errorf("trip distance %f", d)
+	}
+}
+
+func TestMobileTrackerJumps(t *testing.T) {
+	mt := NewMobileTracker()
+	mt.Add(gpsTestSample(1000, 52.4, 13.1))
+	mt.Add(gpsTestSample(1060, 52.4+gpsTestStepDeg, 13.1))
+	// A single glitch is rejected and the track carries on
+	if _, err := mt.Add(gpsTestSample(1120, 48.8, 2.3)); !errors.Is(err, ErrGpsJump) {
+		t.Errorf("expected ErrGpsJump, got %v", err)
+	}
+	if _, err := mt.Add(gpsTestSample(1180, 52.4+2*gpsTestStepDeg, 13.1)); err != nil {
+		t.Fatal(err)
+	}
+	if trips := mt.Trips(5); len(trips) != 1 || len(trips[0].Points) != 3 {
+		t.Errorf("unexpected trips after a glitch: %+v", trips)
+	}
+
+	// A bad first fix must not lock out every later one
+	mt = NewMobileTracker()
+	mt.Add(gpsTestSample(1000, 48.8, 2.3))
+	for i := 0; i < mt.MaxJumpRejections; i++ {
+		if _, err := mt.Add(gpsTestSample(1060+uint32(i)*60, 52.4+float32(i)*gpsTestStepDeg, 13.1)); !errors.Is(err, ErrGpsJump) {
+			t.Fatalf("expected ErrGpsJump, got %v", err)
+		}
+	}
+	if _, err := mt.Add(gpsTestSample(1240, 52.4+3*gpsTestStepDeg, 13.1)); err != nil {
+		t.Fatalf("expected the track to re-anchor, got %v", err)
+	}
+	mt.Add(gpsTestSample(1300, 52.4+4*gpsTestStepDeg, 13.1))
+	trips := mt.Trips(5)
+	if len(trips) != 1 || len(trips[0].Points) != 2 || trips[0].Points[0].Lat < 52 {
+		t.Errorf("expected the bad fix to be dropped: %+v", trips)
+	}
+}
+
+func TestTripGeoJSON(t *testing.T) {
+	decode := func(trip Trip) GeoJSONFeatureCollection {
+		b, err := json.Marshal(trip.GeoJSON())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fc struct {
+			GeoJSONFeatureCollection
+			Features []struct {
+				Geometry struct {
+					Type        string          `json:"type"`
+					Coordinates json.RawMessage `json:"coordinates"`
+				} `json:"geometry"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal(b, &fc); err != nil {
+			t.Fatal(err)
+		}
+		ret := GeoJSONFeatureCollection{Type: fc.Type}
+		for _, f := range fc.Features {
+			ret.Features = append(ret.Features, GeoJSONFeature{Geometry: GeoJSONGeometry{f.Geometry.Type, string(f.Geometry.Coordinates)}})
+		}
+		return ret
+	}
+
+	one := Trip{SerialNumber: 5, Points: []TrackPoint{{UnixSec: 1000, Lat: 52.4, Lon: 13.1}}}
+	fc := decode(one)
+	if len(fc.Features) != 2 || fc.Features[0].Geometry.Type != "Point" || fc.Features[0].Geometry.Coordinates != "[13.1,52.4]" {
+		t.Errorf("expected a Point route for a one-point trip: %+v", fc)
+	}
+
+	two := Trip{SerialNumber: 5, Points: append(one.Points, TrackPoint{UnixSec: 1060, Lat: 52.5, Lon: 13.2})}
+	fc = decode(two)
+	if len(fc.Features) != 3 || fc.Features[0].Geometry.Type != "LineString" || fc.Features[0].Geometry.Coordinates != "[[13.1,52.4],[13.2,52.5]]" {
+		t.Errorf("unexpected route: %+v", fc)
+	}
+
+	if fc = decode(Trip{}); fc.Type != "FeatureCollection" || len(fc.Features) != 0 {
+		t.Errorf("expected an empty collection: %+v", fc)
+	}
+}
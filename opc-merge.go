@@ -0,0 +1,442 @@
+package telosairduetcommon
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+/* ~~ Dual OPC Merge Strategies ~~ */
+
+const (
+	KEY_OPC_MERGE         = "opc_merge"
+	KEY_PREFIX_MERGE_RULE = "merge_rule_"
+
+	// Rules reported in OpcMergeDiagnostics
+	MERGE_RULE_ZERO         = "zero"
+	MERGE_RULE_MIN          = "min"
+	MERGE_RULE_MEAN         = "mean"
+	MERGE_RULE_SENSOR1      = "sensor1"
+	MERGE_RULE_SENSOR2      = "sensor2"
+	MERGE_RULE_HISTORY1     = "history_sensor1"
+	MERGE_RULE_HISTORY2     = "history_sensor2"
+	MERGE_RULE_BIAS_CORRECT = "bias_corrected"
+)
+
+// Field names, as in `Pms5003Measurement.ToMap()` without a suffix
+var opcMergeFields = []string{"pm10", "pm25", "pm100", "pn03", "pn05", "pn10", "pn25", "pn50", "pn100"}
+
+func opcMergeFieldPointers(m *Pms5003Measurement) []*uint16 {
+	return []*uint16{&m.PM1, &m.PM2p5, &m.PM10, &m.PN0p3, &m.PN0p5, &m.PN1, &m.PN2p5, &m.PN5, &m.PN10}
+}
+
+type OpcMergeContext struct {
+	SerialNumber uint16
+	SensorStates uint8
+	Field        string
+}
+
+type OpcMergeStrategy interface {
+	Name() string
+	// The merged value and the rule that produced it.
+	Merge(ctx OpcMergeContext, v1, v2 uint16) (uint16, string)
+}
+
+// Which rule fired, per field.
+type OpcMergeDiagnostics map[string]string
+
+// Returned by strategies that depend on sensor state bits when the caller hasn't configured them.
+var ErrFaultBitsUnset = errors.New("fault bits not configured")
+
+/*
+Strategies that need configuring implement Validate; MergePTWith and MergeSps30FloatWith refuse them until it passes.
+*/
+func validateOpcMergeStrategy(strategy OpcMergeStrategy) error {
+	if v, ok := strategy.(interface{ Validate() error }); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+/*
+Implemented by variants with two OPCs merged into one reported measurement.
+*/
+type DualOpcData interface {
+	DuetData
+	OpcChannels() (opc1, opc2, merged *Pms5003Measurement)
+	SensorStateBits() uint8
+	SetOpcMerge(strategy string, diag OpcMergeDiagnostics)
+}
+
+/*
+`MergePT()` with a chosen strategy, reporting which rule fired for each field.
+*/
+func MergePTWith(pt1, pt2, ptResult *Pms5003Measurement, ctx OpcMergeContext, strategy OpcMergeStrategy) (OpcMergeDiagnostics, error) {
+	if (pt1 == nil) || (pt2 == nil) || (ptResult == nil) || (strategy == nil) {
+		return nil, errors.New("an arg was nil")
+	}
+	if err := validateOpcMergeStrategy(strategy); err != nil {
+		return nil, err
+	}
+	p1, p2, pr := opcMergeFieldPointers(pt1), opcMergeFieldPointers(pt2), opcMergeFieldPointers(ptResult)
+	diag := OpcMergeDiagnostics{}
+	for i, field := range opcMergeFields {
+		ctx.Field = field
+		v, rule := strategy.Merge(ctx, *p1[i], *p2[i])
+		*pr[i] = v
+		diag[field] = rule
+	}
+	return diag, nil
+}
+
+/*
+Re-merge a sample's two OPCs with the given strategy, recording the strategy and per-field rules on the sample.
+Returns false for variants without two OPCs, with float OPCs and a strategy that can't merge floats, or for a strategy
+that fails its Validate().
+*/
+func ApplyOpcMerge(d DuetData, strategy OpcMergeStrategy) (OpcMergeDiagnostics, bool) {
+	if fd, ok := d.(DualSps30FloatData); ok {
+		fs, ok := strategy.(OpcFloatMergeStrategy)
+		if !ok {
+			return nil, false
+		}
+		s1, s2, merged := fd.Sps30FloatChannels()
+		ctx := OpcMergeContext{SerialNumber: d.GetSerialNumber(), SensorStates: fd.SensorStateBits()}
+		diag, err := MergeSps30FloatWith(s1, s2, merged, ctx, fs)
+		if err != nil {
+			return nil, false
+		}
+		fd.SetOpcMerge(strategy.Name(), diag)
+		return diag, true
+	}
+	dd, ok := d.(DualOpcData)
+	if !ok {
+		return nil, false
+	}
+	opc1, opc2, merged := dd.OpcChannels()
+	ctx := OpcMergeContext{SerialNumber: d.GetSerialNumber(), SensorStates: dd.SensorStateBits()}
+	diag, err := MergePTWith(opc1, opc2, merged, ctx, strategy)
+	if err != nil {
+		return nil, false
+	}
+	dd.SetOpcMerge(strategy.Name(), diag)
+	return diag, true
+}
+
+/* ~~ SPS30 (float) ~~ */
+
+// Field names, as in `Sps30FloatMeasurement.ToMap()` without a suffix
+var sps30FloatMergeFields = []string{"pm10", "pm25", "pm40", "pm100", "pn05", "pn10", "pn25", "pn40", "pn100", KEY_PREFIX_TYP_SIZE}
+
+func sps30FloatMergeFieldPointers(m *Sps30FloatMeasurement) []*float32 {
+	return []*float32{&m.PM1, &m.PM2p5, &m.PM4, &m.PM10, &m.PN0p5, &m.PN1, &m.PN2p5, &m.PN4, &m.PN10, &m.TypicalSize}
+}
+
+/*
+Strategies that can also merge float channels.
+*/
+type OpcFloatMergeStrategy interface {
+	OpcMergeStrategy
+	MergeFloat(ctx OpcMergeContext, v1, v2 float32) (float32, string)
+}
+
+/*
+Implemented by variants with two SPS30s in float mode merged into one reported measurement.
+*/
+type DualSps30FloatData interface {
+	DuetData
+	Sps30FloatChannels() (sps1, sps2, merged *Sps30FloatMeasurement)
+	SensorStateBits() uint8
+	SetOpcMerge(strategy string, diag OpcMergeDiagnostics)
+}
+
+/*
+`MergeSps30Float()` with a chosen strategy, reporting which rule fired for each field.
+*/
+func MergeSps30FloatWith(s1, s2, sResult *Sps30FloatMeasurement, ctx OpcMergeContext, strategy OpcFloatMergeStrategy) (OpcMergeDiagnostics, error) {
+	if (s1 == nil) || (s2 == nil) || (sResult == nil) || (strategy == nil) {
+		return nil, errors.New("an arg was nil")
+	}
+	if err := validateOpcMergeStrategy(strategy); err != nil {
+		return nil, err
+	}
+	p1, p2, pr := sps30FloatMergeFieldPointers(s1), sps30FloatMergeFieldPointers(s2), sps30FloatMergeFieldPointers(sResult)
+	diag := OpcMergeDiagnostics{}
+	for i, field := range sps30FloatMergeFields {
+		ctx.Field = field
+		v, rule := strategy.MergeFloat(ctx, *p1[i], *p2[i])
+		*pr[i] = v
+		diag[field] = rule
+	}
+	return diag, nil
+}
+
+func (diag OpcMergeDiagnostics) toMap(ret map[string]any) {
+	for field, rule := range diag {
+		ret[KEY_PREFIX_MERGE_RULE+field] = rule
+	}
+}
+
+/*
+The optional keys a variant sets once `SetOpcMerge()` has run over these fields.
+*/
+func opcMergeFieldSpecs(fields []string) []FieldSpec {
+	ret := []FieldSpec{field(KEY_OPC_MERGE, "string", "", "Strategy that produced the merged OPC values, see ApplyOpcMerge()")}
+	for _, f := range fields {
+		ret = append(ret, field(KEY_PREFIX_MERGE_RULE+f, "string", "", "Merge rule that fired for "+f))
+	}
+	return optionalFields(ret)
+}
+
+func meanUint16(v1, v2 uint16) uint16 {
+	return uint16((uint32(v1) + uint32(v2)) / 2)
+}
+
+func clampUint16(v float64) uint16 {
+	switch {
+	case v <= 0 || math.IsNaN(v):
+		return 0
+	case v >= math.MaxUint16:
+		return math.MaxUint16
+	}
+	return uint16(math.Round(v))
+}
+
+/*
+The decode-time behaviour: zero if either channel is zero, the lower value if they differ by more than 2:1, else the mean.
+*/
+type LegacyOpcMerge struct{}
+
+func (LegacyOpcMerge) Name() string { return "legacy" }
+
+func (LegacyOpcMerge) Merge(_ OpcMergeContext, v1, v2 uint16) (uint16, string) {
+	if v1 == 0 || v2 == 0 {
+		return 0, MERGE_RULE_ZERO
+	}
+	if ratio := float32(v1) / float32(v2); (ratio < .5) || (ratio > 2) {
+		return min(v1, v2), MERGE_RULE_MIN
+	}
+	return meanUint16(v1, v2), MERGE_RULE_MEAN
+}
+
+func (LegacyOpcMerge) MergeFloat(_ OpcMergeContext, v1, v2 float32) (float32, string) {
+	if v1 == 0 || v2 == 0 {
+		return 0, MERGE_RULE_ZERO
+	}
+	if ratio := v1 / v2; (ratio < .5) || (ratio > 2) {
+		return min(v1, v2), MERGE_RULE_MIN
+	}
+	return (v1 + v2) / 2, MERGE_RULE_MEAN
+}
+
+/*
+Plain mean of both channels, zeros included.
+*/
+type MeanOpcMerge struct{}
+
+func (MeanOpcMerge) Name() string { return "mean" }
+
+func (MeanOpcMerge) Merge(_ OpcMergeContext, v1, v2 uint16) (uint16, string) {
+	return meanUint16(v1, v2), MERGE_RULE_MEAN
+}
+
+func (MeanOpcMerge) MergeFloat(_ OpcMergeContext, v1, v2 float32) (float32, string) {
+	return (v1 + v2) / 2, MERGE_RULE_MEAN
+}
+
+/*
+Mean while the channels agree within MaxRatio (2 if unset). When they don't, the channel closer to the median of the
+device's last History merged values (10 if unset) is used, or the lower one until there is history. Merges float
+channels the same way. Safe for concurrent use.
+*/
+type MedianHistoryOpcMerge struct {
+	MaxRatio float64
+	History  int
+
+	mu      sync.Mutex
+	history map[opcHistoryKey][]float64
+}
+
+type opcHistoryKey struct {
+	serialNumber uint16
+	field        string
+}
+
+func NewMedianHistoryOpcMerge() *MedianHistoryOpcMerge {
+	return &MedianHistoryOpcMerge{MaxRatio: 2, History: 10}
+}
+
+func (*MedianHistoryOpcMerge) Name() string { return "median_history" }
+
+func (s *MedianHistoryOpcMerge) Merge(ctx OpcMergeContext, v1, v2 uint16) (uint16, string) {
+	v, rule := s.merge(ctx, float64(v1), float64(v2), float64(meanUint16(v1, v2)))
+	return uint16(v), rule
+}
+
+func (s *MedianHistoryOpcMerge) MergeFloat(ctx OpcMergeContext, v1, v2 float32) (float32, string) {
+	v, rule := s.merge(ctx, float64(v1), float64(v2), float64((v1+v2)/2))
+	return float32(v), rule
+}
+
+/*
+Pick between the channels, or their mean as computed for the channel type, and remember the result.
+*/
+func (s *MedianHistoryOpcMerge) merge(ctx OpcMergeContext, v1, v2, mean float64) (float64, string) {
+	maxRatio := s.MaxRatio
+	if maxRatio <= 1 {
+		maxRatio = 2
+	}
+	n := s.History
+	if n <= 0 {
+		n = 10
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.history == nil {
+		s.history = map[opcHistoryKey][]float64{}
+	}
+	k := opcHistoryKey{ctx.SerialNumber, ctx.Field}
+	hist := s.history[k]
+
+	var v float64
+	var rule string
+	lo, hi := min(v1, v2), max(v1, v2)
+	switch {
+	case hi == 0 || (lo > 0 && hi/lo <= maxRatio):
+		v, rule = mean, MERGE_RULE_MEAN
+	case len(hist) == 0:
+		v, rule = lo, MERGE_RULE_MIN
+	default:
+		med := median(hist)
+		if math.Abs(v1-med) <= math.Abs(v2-med) {
+			v, rule = v1, MERGE_RULE_HISTORY1
+		} else {
+			v, rule = v2, MERGE_RULE_HISTORY2
+		}
+	}
+
+	hist = append(hist, v)
+	if len(hist) > n {
+		hist = hist[len(hist)-n:]
+	}
+	s.history[k] = hist
+	return v, rule
+}
+
+/*
+Use only the channel whose fault bits are clear in the sample's sensor states, falling back to Fallback (legacy if nil)
+when both or neither are faulted. Which bit is which OPC depends on the firmware, so both must be set; MergePTWith
+refuses the strategy otherwise.
+*/
+type HealthierOpcMerge struct {
+	FaultBits1, FaultBits2 uint8
+	Fallback               OpcMergeStrategy
+}
+
+func (HealthierOpcMerge) Name() string { return "healthier_sensor" }
+
+func (s HealthierOpcMerge) Validate() error {
+	if s.FaultBits1 == 0 || s.FaultBits2 == 0 {
+		return fmt.Errorf("%s: %w for both channels", s.Name(), ErrFaultBitsUnset)
+	}
+	return nil
+}
+
+func (s HealthierOpcMerge) Merge(ctx OpcMergeContext, v1, v2 uint16) (uint16, string) {
+	fault1 := ctx.SensorStates&s.FaultBits1 != 0
+	fault2 := ctx.SensorStates&s.FaultBits2 != 0
+	switch {
+	case fault1 && !fault2:
+		return v2, MERGE_RULE_SENSOR2
+	case fault2 && !fault1:
+		return v1, MERGE_RULE_SENSOR1
+	}
+	if s.Fallback != nil {
+		return s.Fallback.Merge(ctx, v1, v2)
+	}
+	return LegacyOpcMerge{}.Merge(ctx, v1, v2)
+}
+
+/*
+As Merge(). A Fallback that can't merge floats is replaced by the legacy rules.
+*/
+func (s HealthierOpcMerge) MergeFloat(ctx OpcMergeContext, v1, v2 float32) (float32, string) {
+	fault1 := ctx.SensorStates&s.FaultBits1 != 0
+	fault2 := ctx.SensorStates&s.FaultBits2 != 0
+	switch {
+	case fault1 && !fault2:
+		return v2, MERGE_RULE_SENSOR2
+	case fault2 && !fault1:
+		return v1, MERGE_RULE_SENSOR1
+	}
+	if fs, ok := s.Fallback.(OpcFloatMergeStrategy); ok {
+		return fs.MergeFloat(ctx, v1, v2)
+	}
+	return LegacyOpcMerge{}.MergeFloat(ctx, v1, v2)
+}
+
+/*
+Linear correction for each channel of one device, e.g. from a colocation: corrected = raw*Scale + Offset. A zero Scale is treated as 1.
+*/
+type OpcChannelBias struct {
+	Scale1  float64 `json:"scale1"`
+	Offset1 float64 `json:"offset1"`
+	Scale2  float64 `json:"scale2"`
+	Offset2 float64 `json:"offset2"`
+}
+
+func (b OpcChannelBias) correctedMean(v1, v2 float64) float64 {
+	s1, s2 := b.Scale1, b.Scale2
+	if s1 == 0 {
+		s1 = 1
+	}
+	if s2 == 0 {
+		s2 = 1
+	}
+	return (v1*s1 + b.Offset1 + v2*s2 + b.Offset2) / 2
+}
+
+/*
+Mean of both channels after a per-device correction. Devices without a correction get the plain mean. Safe for concurrent use.
+*/
+type BiasCorrectedOpcMerge struct {
+	mu     sync.RWMutex
+	biases map[uint16]OpcChannelBias
+}
+
+func NewBiasCorrectedOpcMerge() *BiasCorrectedOpcMerge {
+	return &BiasCorrectedOpcMerge{biases: map[uint16]OpcChannelBias{}}
+}
+
+func (s *BiasCorrectedOpcMerge) SetBias(serialNumber uint16, b OpcChannelBias) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.biases == nil {
+		s.biases = map[uint16]OpcChannelBias{}
+	}
+	s.biases[serialNumber] = b
+}
+
+func (*BiasCorrectedOpcMerge) Name() string { return "bias_corrected" }
+
+func (s *BiasCorrectedOpcMerge) Merge(ctx OpcMergeContext, v1, v2 uint16) (uint16, string) {
+	s.mu.RLock()
+	b, ok := s.biases[ctx.SerialNumber]
+	s.mu.RUnlock()
+	if !ok {
+		return meanUint16(v1, v2), MERGE_RULE_MEAN
+	}
+	return clampUint16(b.correctedMean(float64(v1), float64(v2))), MERGE_RULE_BIAS_CORRECT
+}
+
+func (s *BiasCorrectedOpcMerge) MergeFloat(ctx OpcMergeContext, v1, v2 float32) (float32, string) {
+	s.mu.RLock()
+	b, ok := s.biases[ctx.SerialNumber]
+	s.mu.RUnlock()
+	if !ok {
+		return (v1 + v2) / 2, MERGE_RULE_MEAN
+	}
+	return float32(max(b.correctedMean(float64(v1), float64(v2)), 0)), MERGE_RULE_BIAS_CORRECT
+}
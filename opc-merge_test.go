@@ -0,0 +1,247 @@
+package telosairduetcommon
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+/*
+MergePTValue as it was before the merge strategies, kept to pin the legacy output. Its uint16 product & sum overflow.
+*/
+func preStrategyMergePTValue(v1 uint16, v2 uint16) uint16 {
+	if v1*v2 == 0 {
+		return 0
+	}
+	if ratio := float32(v1) / float32(v2); (ratio < .5) || (ratio > 2) {
+		if v1 <= v2 {
+			return v1
+		}
+		return v2
+	}
+	return (v1 + v2) / 2
+}
+
+func TestLegacyOpcMergeUnchanged(t *testing.T) {
+	values := []uint16{0, 1, 2, 3, 5, 9, 10, 11, 19, 20, 21, 40, 99, 100, 101, 150, 199, 200, 201, 255}
+	for _, v1 := range values {
+		for _, v2 := range values {
+			if got, want := MergePTValue(v1, v2), preStrategyMergePTValue(v1, v2); got != want {
+				t.Errorf("MergePTValue(%d, %d) = %d; was %d", v1, v2, got, want)
+			}
+		}
+	}
+
+	// A dual-PMS sample decodes to the same merged channel
+	pt1 := Pms5003Measurement{PM1: 4, PM2p5: 10, PM10: 12, PN0p3: 0, PN0p5: 200, PN1: 90, PN2p5: 8, PN5: 2, PN10: 1}
+	pt2 := Pms5003Measurement{PM1: 5, PM2p5: 30, PM10: 13, PN0p3: 150, PN0p5: 190, PN1: 100, PN2p5: 3, PN5: 2, PN10: 0}
+	var merged Pms5003Measurement
+	if err := MergePT(&pt1, &pt2, &merged); err != nil {
+		t.Fatal(err)
+	}
+	want := Pms5003Measurement{PM1: 4, PM2p5: 10, PM10: 12, PN0p3: 0, PN0p5: 195, PN1: 95, PN2p5: 3, PN5: 2, PN10: 0}
+	if merged != want {
+		t.Errorf("MergePT = %+v; want %+v", merged, want)
+	}
+
+	// Where the old product or sum overflowed, the legacy rules now hold
+	for _, td := range []struct {
+		v1, v2, want uint16
+		rule         string
+	}{
+		{256, 256, 256, MERGE_RULE_MEAN},       // product wrapped to 0, was 0
+		{40000, 40000, 40000, MERGE_RULE_MEAN}, // sum wrapped, was 7232
+		{65535, 65535, 65535, MERGE_RULE_MEAN}, // was 32767
+		{65535, 65534, 65534, MERGE_RULE_MEAN}, // was 32766
+		{65535, 30000, 30000, MERGE_RULE_MIN},  // more than 2:1 apart
+		{65535, 0, 0, MERGE_RULE_ZERO},         // a zero channel still zeroes the result
+		{math.MaxUint16, 40000, 52767, MERGE_RULE_MEAN},
+	} {
+		v, rule := LegacyOpcMerge{}.Merge(OpcMergeContext{}, td.v1, td.v2)
+		if v != td.want || rule != td.rule {
+			t.Errorf("legacy merge of %d & %d = %d (%s); want %d (%s)", td.v1, td.v2, v, rule, td.want, td.rule)
+		}
+	}
+}
+
+func TestMeanOpcMerge(t *testing.T) {
+	for _, td := range []struct{ v1, v2, want uint16 }{
+		{10, 30, 20},
+		{0, 30, 15},
+		{65535, 65533, 65534},
+		{65535, 65535, 65535},
+	} {
+		if v, rule := (MeanOpcMerge{}).Merge(OpcMergeContext{}, td.v1, td.v2); v != td.want || rule != MERGE_RULE_MEAN {
+			t.Errorf("mean of %d & %d = %d (%s); want %d", td.v1, td.v2, v, rule, td.want)
+		}
+	}
+	if v, _ := (MeanOpcMerge{}).MergeFloat(OpcMergeContext{}, 1, 0); v != 0.5 {
+		t.Errorf("float mean = %f; want 0.5", v)
+	}
+}
+
+// Fault bits as one firmware might assign them to the two OPCs
+const (
+	testOpc1FaultBit uint8 = 1 << 0
+	testOpc2FaultBit uint8 = 1 << 1
+)
+
+func TestHealthierOpcMerge(t *testing.T) {
+	s := HealthierOpcMerge{FaultBits1: testOpc1FaultBit, FaultBits2: testOpc2FaultBit}
+	for _, td := range []struct {
+		states uint8
+		want   uint16
+		rule   string
+	}{
+		{testOpc1FaultBit, 30, MERGE_RULE_SENSOR2},
+		{testOpc2FaultBit | testScdFaultBit, 10, MERGE_RULE_SENSOR1},
+		// Both or neither faulted: the legacy rules, here more than 2:1 apart
+		{0, 10, MERGE_RULE_MIN},
+		{testOpc1FaultBit | testOpc2FaultBit, 10, MERGE_RULE_MIN},
+	} {
+		v, rule := s.Merge(OpcMergeContext{SensorStates: td.states}, 10, 30)
+		if v != td.want || rule != td.rule {
+			t.Errorf("states %#x: got %d (%s); want %d (%s)", td.states, v, rule, td.want, td.rule)
+		}
+		f, frule := s.MergeFloat(OpcMergeContext{SensorStates: td.states}, 10, 30)
+		if f != float32(td.want) || frule != td.rule {
+			t.Errorf("states %#x: float got %f (%s); want %d (%s)", td.states, f, frule, td.want, td.rule)
+		}
+	}
+
+	s.Fallback = MeanOpcMerge{}
+	if v, rule := s.Merge(OpcMergeContext{}, 10, 30); v != 20 || rule != MERGE_RULE_MEAN {
+		t.Errorf("expected the mean fallback, got %d (%s)", v, rule)
+	}
+	// A fallback without float support falls back to the legacy rules for floats
+	s.Fallback = struct{ OpcMergeStrategy }{MeanOpcMerge{}}
+	if v, rule := s.MergeFloat(OpcMergeContext{}, 10, 30); v != 10 || rule != MERGE_RULE_MIN {
+		t.Errorf("expected the legacy float rules, got %f (%s)", v, rule)
+	}
+}
+
+func TestHealthierOpcMergeNeedsFaultBits(t *testing.T) {
+	d := &DuetDataMk1Var0{
+		SensorStates: testOpc2FaultBit,
+		Pt1:          Pms5003Measurement{PM2p5: 10},
+		Pt2:          Pms5003Measurement{PM2p5: 30},
+	}
+	for _, s := range []HealthierOpcMerge{{}, {FaultBits1: testOpc1FaultBit}, {FaultBits2: testOpc2FaultBit}} {
+		if err := s.Validate(); !errors.Is(err, ErrFaultBitsUnset) {
+			t.Errorf("%+v: expected ErrFaultBitsUnset, got %v", s, err)
+		}
+		if _, err := MergePTWith(&d.Pt1, &d.Pt2, &d.PtM, OpcMergeContext{}, s); !errors.Is(err, ErrFaultBitsUnset) {
+			t.Errorf("%+v: expected MergePTWith to refuse, got %v", s, err)
+		}
+		if _, ok := ApplyOpcMerge(d, s); ok {
+			t.Errorf("%+v: expected ApplyOpcMerge to refuse", s)
+		}
+	}
+	if d.OpcMerge != "" {
+		t.Errorf("a refused strategy was recorded: %s", d.OpcMerge)
+	}
+}
+
+func TestMedianHistoryOpcMerge(t *testing.T) {
+	s := NewMedianHistoryOpcMerge()
+	s.History = 3
+	ctx := OpcMergeContext{SerialNumber: 1, Field: "pm25"}
+	for _, td := range []struct {
+		v1, v2, want uint16
+		rule         string
+	}{
+		{0, 30, 0, MERGE_RULE_MIN}, // no history yet, so the lower value; here the zero
+		{10, 12, 11, MERGE_RULE_MEAN},
+		{12, 14, 13, MERGE_RULE_MEAN},
+		// History 0, 11, 13: median 11
+		{10, 40, 10, MERGE_RULE_HISTORY1},
+		// History 11, 13, 10: median 11
+		{50, 12, 12, MERGE_RULE_HISTORY2},
+		{0, 0, 0, MERGE_RULE_MEAN},
+	} {
+		v, rule := s.Merge(ctx, td.v1, td.v2)
+		if v != td.want || rule != td.rule {
+			t.Errorf("merge of %d & %d = %d (%s); want %d (%s)", td.v1, td.v2, v, rule, td.want, td.rule)
+		}
+	}
+	if n := len(s.history[opcHistoryKey{1, "pm25"}]); n != 3 {
+		t.Errorf("kept %d history values; want 3", n)
+	}
+
+	// Floats take the same rules, with their own mean
+	fs := NewMedianHistoryOpcMerge()
+	for _, td := range []struct {
+		v1, v2, want float32
+		rule         string
+	}{
+		{1, 4, 1, MERGE_RULE_MIN},
+		{1.5, 2.5, 2, MERGE_RULE_MEAN},
+		// History 1, 2: median 1.5
+		{1.2, 9, 1.2, MERGE_RULE_HISTORY1},
+	} {
+		if v, rule := fs.MergeFloat(ctx, td.v1, td.v2); v != td.want || rule != td.rule {
+			t.Errorf("float merge of %.1f & %.1f = %f (%s); want %f (%s)", td.v1, td.v2, v, rule, td.want, td.rule)
+		}
+	}
+
+	// History is per device and field
+	for _, other := range []OpcMergeContext{{SerialNumber: 2, Field: "pm25"}, {SerialNumber: 1, Field: "pm10"}} {
+		if v, rule := s.Merge(other, 10, 40); v != 10 || rule != MERGE_RULE_MIN {
+			t.Errorf("%+v: expected no history, got %d (%s)", other, v, rule)
+		}
+	}
+}
+
+func TestBiasCorrectedOpcMerge(t *testing.T) {
+	s := NewBiasCorrectedOpcMerge()
+	if v, rule := s.Merge(OpcMergeContext{SerialNumber: 3}, 10, 30); v != 20 || rule != MERGE_RULE_MEAN {
+		t.Errorf("expected the plain mean without a bias, got %d (%s)", v, rule)
+	}
+
+	s.SetBias(3, OpcChannelBias{Scale1: 2, Offset2: -10})
+	ctx := OpcMergeContext{SerialNumber: 3}
+	for _, td := range []struct{ v1, v2, want uint16 }{
+		{10, 30, 20},
+		{0, 5, 0},
+		{65535, 65535, 65535},
+	} {
+		if v, rule := s.Merge(ctx, td.v1, td.v2); v != td.want || rule != MERGE_RULE_BIAS_CORRECT {
+			t.Errorf("bias corrected %d & %d = %d (%s); want %d", td.v1, td.v2, v, rule, td.want)
+		}
+	}
+	if v, _ := s.MergeFloat(ctx, 1, 2); v != 0 {
+		t.Errorf("float bias corrected = %f; want clamped to 0", v)
+	}
+	if v, _ := s.MergeFloat(ctx, 10, 30); v != 20 {
+		t.Errorf("float bias corrected = %f; want 20", v)
+	}
+}
+
+func TestApplyOpcMergeDiagnostics(t *testing.T) {
+	d := &DuetDataMk1Var0{
+		SensorStates: testOpc2FaultBit,
+		Pt1:          Pms5003Measurement{PM1: 4, PM2p5: 10, PM10: 12},
+		Pt2:          Pms5003Measurement{PM1: 5, PM2p5: 30, PM10: 13},
+	}
+	diag, ok := ApplyOpcMerge(d, HealthierOpcMerge{FaultBits1: testOpc1FaultBit, FaultBits2: testOpc2FaultBit})
+	if !ok {
+		t.Fatal("ApplyOpcMerge failed for a dual PMS5003 variant")
+	}
+	if len(diag) != len(opcMergeFields) || diag["pm25"] != MERGE_RULE_SENSOR1 {
+		t.Errorf("unexpected diagnostics: %v", diag)
+	}
+	if d.PtM.PM2p5 != 10 {
+		t.Errorf("merged pm2.5 = %d; want sensor 1's 10", d.PtM.PM2p5)
+	}
+	m := d.ToMap("")
+	if m[KEY_OPC_MERGE] != "healthier_sensor" || m[KEY_PREFIX_MERGE_RULE+"pm25"] != MERGE_RULE_SENSOR1 || m["pm25_m"] != uint16(10) {
+		t.Errorf("unexpected map: %v, %v, %v", m[KEY_OPC_MERGE], m[KEY_PREFIX_MERGE_RULE+"pm25"], m["pm25_m"])
+	}
+
+	if _, ok := ApplyOpcMerge(&DuetDataMk4Var7{}, LegacyOpcMerge{}); ok {
+		t.Error("Mk4.7 has a single OPC")
+	}
+	if _, err := MergePTWith(&d.Pt1, &d.Pt2, &d.PtM, OpcMergeContext{}, nil); err == nil {
+		t.Error("expected an error without a strategy")
+	}
+}
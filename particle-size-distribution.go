@@ -0,0 +1,177 @@
+package telosairduetcommon
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+/* ~~ Particle Size Distribution ~~ */
+
+// OPC-N3 bin boundaries in µm (optical diameter, PSL calibrated): 24 bins, 25 edges.
+var OpcN3BinBoundaries = []float64{
+	0.35, 0.46, 0.66, 1.0, 1.3, 1.7, 2.3, 3.0, 4.0, 5.2, 6.5, 8.0,
+	10.0, 12.0, 14.0, 16.0, 18.0, 20.0, 22.0, 25.0, 28.0, 31.0, 34.0, 37.0, 40.0,
+}
+
+const (
+	// Alphasense's default particle density for the OPC-N3 PM calculation, g/cm³
+	DefaultParticleDensity = 1.65
+)
+
+// Older firmware sends bin counts without the flow rate & sampling period needed to turn them into concentrations.
+var ErrOpcN3NoFlow = errors.New("opc-n3 sample has no flow rate or sampling period")
+
+type SizeDistributionOptions struct {
+	// Particle density in g/cm³. Defaults to DefaultParticleDensity.
+	Density float64
+	// Multiplier on the bin boundaries correcting for aerosol refractive index differing from the PSL calibration. Defaults to 1.
+	RefractiveIndexFactor float64
+}
+
+func (o SizeDistributionOptions) withDefaults() SizeDistributionOptions {
+	if o.Density <= 0 {
+		o.Density = DefaultParticleDensity
+	}
+	if o.RefractiveIndexFactor <= 0 {
+		o.RefractiveIndexFactor = 1
+	}
+	return o
+}
+
+type SizeBin struct {
+	Lower, Upper float64 // µm
+	Midpoint     float64 // geometric midpoint, µm
+	Count        float64 // #/cm³
+	DNdlogDp     float64 // #/cm³
+	DSdlogDp     float64 // µm²/cm³
+	DVdlogDp     float64 // µm³/cm³
+}
+
+type ParticleSizeDistribution struct {
+	Bins         []SizeBin
+	TotalCount   float64 // #/cm³
+	TotalSurface float64 // µm²/cm³
+	TotalVolume  float64 // µm³/cm³
+
+	// Mass concentrations recomputed from the bins, µg/m³
+	PM1, PM2p5, PM4, PM10 float64
+
+	CountMedianDiameter float64 // µm
+}
+
+/*
+Size distribution from an OPC-N3 sample. Bin counts are converted to concentrations using the sample flow rate and
+sampling period, so samples from firmware that doesn't send them return ErrOpcN3NoFlow.
+*/
+func OpcN3SizeDistribution(m AlphasenseOpcN3Measurement, opts SizeDistributionOptions) (ParticleSizeDistribution, error) {
+	if !m.flowSet {
+		return ParticleSizeDistribution{}, ErrOpcN3NoFlow
+	}
+	counts := make([]float64, len(m.Bins))
+	sampledCm3 := float64(m.SampleFlowRate) * float64(m.SamplingPeriod)
+	if sampledCm3 <= 0 {
+		return ParticleSizeDistribution{}, fmt.Errorf("invalid sampled volume: flow %f ml/s over %f s", m.SampleFlowRate, m.SamplingPeriod)
+	}
+	for i, c := range m.Bins {
+		counts[i] = float64(c) / sampledCm3
+	}
+	return SizeDistributionFromBins(OpcN3BinBoundaries, counts, opts)
+}
+
+/*
+Size distribution from concentrations (#/cm³) in bins bounded by the given diameters (µm), len(boundaries) == len(counts)+1.
+Particles are assumed log-uniformly distributed within each bin, and spherical for surface, volume and mass.
+*/
+func SizeDistributionFromBins(boundaries []float64, counts []float64, opts SizeDistributionOptions) (ParticleSizeDistribution, error) {
+	var psd ParticleSizeDistribution
+	if len(boundaries) != len(counts)+1 {
+		return psd, fmt.Errorf("expected %d bin boundaries for %d bins, got %d", len(counts)+1, len(counts), len(boundaries))
+	}
+	opts = opts.withDefaults()
+
+	for i, n := range counts {
+		lo := boundaries[i] * opts.RefractiveIndexFactor
+		hi := boundaries[i+1] * opts.RefractiveIndexFactor
+		if lo <= 0 || hi <= lo {
+			return psd, fmt.Errorf("bin %d has invalid boundaries %f-%f", i, lo, hi)
+		}
+		mid := math.Sqrt(lo * hi)
+		dlogDp := math.Log10(hi / lo)
+		s := math.Pi * mid * mid * n
+		v := math.Pi / 6 * mid * mid * mid * n
+
+		psd.Bins = append(psd.Bins, SizeBin{
+			Lower:    lo,
+			Upper:    hi,
+			Midpoint: mid,
+			Count:    n,
+			DNdlogDp: n / dlogDp,
+			DSdlogDp: s / dlogDp,
+			DVdlogDp: v / dlogDp,
+		})
+		psd.TotalCount += n
+		psd.TotalSurface += s
+		psd.TotalVolume += v
+	}
+
+	// 1 µm³/cm³ at 1 g/cm³ is 1 µg/m³
+	psd.PM1 = psd.volumeBelow(1) * opts.Density
+	psd.PM2p5 = psd.volumeBelow(2.5) * opts.Density
+	psd.PM4 = psd.volumeBelow(4) * opts.Density
+	psd.PM10 = psd.volumeBelow(10) * opts.Density
+	psd.CountMedianDiameter = psd.countMedianDiameter()
+
+	return psd, nil
+}
+
+/*
+Particle volume (µm³/cm³) below the given diameter, splitting a straddling bin in log space.
+*/
+func (psd ParticleSizeDistribution) volumeBelow(dp float64) float64 {
+	v := 0.0
+	for _, b := range psd.Bins {
+		switch {
+		case b.Upper <= dp:
+			v += b.DVdlogDp * math.Log10(b.Upper/b.Lower)
+		case b.Lower < dp:
+			frac := math.Log10(dp/b.Lower) / math.Log10(b.Upper/b.Lower)
+			mid := math.Sqrt(b.Lower * dp)
+			v += math.Pi / 6 * mid * mid * mid * b.Count * frac
+		}
+	}
+	return v
+}
+
+func (psd ParticleSizeDistribution) countMedianDiameter() float64 {
+	if psd.TotalCount <= 0 {
+		return 0
+	}
+	half := psd.TotalCount / 2
+	cum := 0.0
+	for _, b := range psd.Bins {
+		if b.Count > 0 && cum+b.Count >= half {
+			frac := (half - cum) / b.Count
+			return b.Lower * math.Pow(b.Upper/b.Lower, frac)
+		}
+		cum += b.Count
+	}
+	return psd.Bins[len(psd.Bins)-1].Upper
+}
+
+func (psd ParticleSizeDistribution) ToMap() map[string]any {
+	ret := map[string]any{
+		"psd_total_count":   psd.TotalCount,
+		"psd_total_surface": psd.TotalSurface,
+		"psd_total_volume":  psd.TotalVolume,
+		"psd_pm10":          psd.PM1,
+		"psd_pm25":          psd.PM2p5,
+		"psd_pm40":          psd.PM4,
+		"psd_pm100":         psd.PM10,
+		"psd_cmd":           psd.CountMedianDiameter,
+	}
+	for i, b := range psd.Bins {
+		ret[fmt.Sprintf("psd_dndlogdp%d", i)] = b.DNdlogDp
+	}
+	return ret
+}
@@ -0,0 +1,89 @@
+package telosairduetcommon
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSizeDistributionFromBins(t *testing.T) {
+	// 1 #/cm³ in each of 1-2 µm and 2-4 µm, at unit density
+	psd, err := SizeDistributionFromBins([]float64{1, 2, 4}, []float64{1, 1}, SizeDistributionOptions{Density: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := psd.Bins[0]
+	if b.Midpoint != math.Sqrt2 || math.Abs(b.DNdlogDp-1/math.Log10(2)) > 1e-9 {
+		t.Errorf("unexpected bin: %+v", b)
+	}
+	// Spheres at the geometric midpoints
+	v1, v2 := math.Pi/6*math.Pow(math.Sqrt2, 3), math.Pi/6*math.Pow(math.Sqrt(8), 3)
+	// The 2-4 µm bin straddles 2.5 µm: the part below, log-uniformly, at its own midpoint
+	frac := math.Log10(2.5/2) / math.Log10(2)
+	v2Below := math.Pi / 6 * math.Pow(math.Sqrt(5), 3) * frac
+	for _, td := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"TotalCount", psd.TotalCount, 2},
+		{"TotalVolume", psd.TotalVolume, v1 + v2},
+		{"TotalSurface", psd.TotalSurface, math.Pi * (2 + 8)},
+		{"PM1", psd.PM1, 0},
+		{"PM2.5", psd.PM2p5, v1 + v2Below},
+		{"PM4", psd.PM4, v1 + v2},
+		{"PM10", psd.PM10, v1 + v2},
+		{"CountMedianDiameter", psd.CountMedianDiameter, 2},
+	} {
+		if math.Abs(td.got-td.want) > 1e-9 {
+			t.Errorf("%s = %f; want %f", td.name, td.got, td.want)
+		}
+	}
+
+	// Mass scales with density, and the refractive index factor scales the bin edges
+	dense, _ := SizeDistributionFromBins([]float64{1, 2, 4}, []float64{1, 1}, SizeDistributionOptions{Density: 2, RefractiveIndexFactor: 0.5})
+	if dense.Bins[1].Upper != 2 || math.Abs(dense.PM2p5-2*(v1+v2)/8) > 1e-9 {
+		t.Errorf("unexpected scaled distribution: PM2.5 %f, bins %+v", dense.PM2p5, dense.Bins)
+	}
+
+	for name, edges := range map[string][]float64{
+		"too few edges": {1, 2},
+		"not rising":    {1, 1, 4},
+		"zero edge":     {0, 2, 4},
+	} {
+		if _, err := SizeDistributionFromBins(edges, []float64{1, 1}, SizeDistributionOptions{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOpcN3SizeDistribution(t *testing.T) {
+	m := AlphasenseOpcN3Measurement{}
+	m.Bins[0] = 100
+	if _, err := OpcN3SizeDistribution(m, SizeDistributionOptions{}); !errors.Is(err, ErrOpcN3NoFlow) {
+		t.Errorf("expected ErrOpcN3NoFlow without a flow rate, got %v", err)
+	}
+
+	// 100 particles in 5 ml/s over 2 s
+	m.SampleFlowRate, m.SamplingPeriod, m.flowSet = 5, 2, true
+	psd, err := OpcN3SizeDistribution(m, SizeDistributionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(psd.Bins) != 24 || psd.TotalCount != 10 || psd.Bins[0].Lower != 0.35 {
+		t.Errorf("unexpected distribution: %+v", psd)
+	}
+	mp := psd.ToMap()
+	for _, k := range []string{"psd_pm10", "psd_pm25", "psd_pm40", "psd_pm100", "psd_dndlogdp23"} {
+		if _, ok := mp[k]; !ok {
+			t.Errorf("missing %s", k)
+		}
+	}
+	if mp["psd_pm10"] != psd.PM1 || mp["psd_pm100"] != psd.PM10 {
+		t.Errorf("psd_pm10 %v, psd_pm100 %v", mp["psd_pm10"], mp["psd_pm100"])
+	}
+
+	m.SamplingPeriod = 0
+	if _, err := OpcN3SizeDistribution(m, SizeDistributionOptions{}); err == nil {
+		t.Error("expected an error for a zero sampled volume")
+	}
+}
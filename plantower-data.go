@@ -40,20 +40,28 @@ func (m *Pms5003Measurement) ToMap(suffix string) map[string]any {
 }
 
 /*
-Merge two PMS5003 measurement valus, using mean if tha ratio is less than 2:1, min otherwise.
+The keys of `ToMap()` with the same suffix.
 */
-func MergePTValue(v1 uint16, v2 uint16) uint16 {
-	if v1*v2 == 0 {
-		return 0
+func (m *Pms5003Measurement) FieldSpecs(suffix string) []FieldSpec {
+	pm := func(key, size string) FieldSpec {
+		return rangedField(key+suffix, "uint16", UNIT_UG_M3, 0, 1000, "PM"+size+" mass concentration")
 	}
-	if ratio := float32(v1) / float32(v2); (ratio < .5) || (ratio > 2) {
-		if v1 <= v2 {
-			return v1
-		}
-		return v2
+	pn := func(key, size string) FieldSpec {
+		return field(key+suffix, "uint16", UNIT_PER_DL, "Particles > "+size+" µm")
 	}
-	return (v1 + v2) / 2
+	return []FieldSpec{
+		pm("pm10", "1"), pm("pm25", "2.5"), pm("pm100", "10"),
+		pn("pn03", "0.3"), pn("pn05", "0.5"), pn("pn10", "1"), pn("pn25", "2.5"), pn("pn50", "5"), pn("pn100", "10"),
+	}
+}
 
+/*
+Merge two PMS5003 measurement valus, using mean if tha ratio is less than 2:1, min otherwise.
+See MergePTWith() for other strategies.
+*/
+func MergePTValue(v1 uint16, v2 uint16) uint16 {
+	v, _ := LegacyOpcMerge{}.Merge(OpcMergeContext{}, v1, v2)
+	return v
 }
 
 /*
@@ -0,0 +1,280 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/* ~~ Power Supply Health ~~ */
+
+type PowerSupply string
+
+const (
+	POWER_SUPPLY_UNKNOWN PowerSupply = "unknown"
+	POWER_SUPPLY_POE     PowerSupply = "poe"
+	POWER_SUPPLY_USB     PowerSupply = "usb"
+	POWER_SUPPLY_BATTERY PowerSupply = "battery"
+)
+
+type PowerStatus string
+
+const (
+	POWER_STATUS_UNKNOWN  PowerStatus = "unknown"
+	POWER_STATUS_OK       PowerStatus = "ok"
+	POWER_STATUS_DEGRADED PowerStatus = "degraded" // undervoltage or brown-out reboots seen
+	POWER_STATUS_CRITICAL PowerStatus = "critical" // currently undervoltage
+)
+
+const (
+	KEY_SUPPLY_VOLTS       = "supply_volts"
+	KEY_SUPPLY_TYPE        = "supply_type"
+	KEY_SUPPLY_UNDERVOLT   = "supply_undervoltage"
+	KEY_POWER_STATUS       = "power_status"
+	KEY_REBOOTS            = "reboots"
+	KEY_BROWNOUT_REBOOTS   = "brownout_reboots"
+	KEY_UNDERVOLT_FRACTION = "undervoltage_fraction"
+)
+
+/*
+Supply voltage range, V, of one way of powering the board.
+*/
+type PowerBand struct {
+	Supply     PowerSupply
+	MinV, MaxV float64
+}
+
+/*
+How a hardware version reports PoeUsbVoltage and what its supplies look like. Bands are ordered by voltage, low to
+high. A reading between two bands is the band above sagging, so undervoltage.
+
+The firmware sends PoeUsbVoltage as a raw byte whose scaling depends on the board's ADC divider. That divider is not
+documented in this package, the firmware, or anywhere else we have, so no per-version profiles ship yet: the
+scaling for each hardware version is an open question with the hardware owners. Until it is answered, the caller
+must supply a profile, from the board's schematic or a bench measurement, for every hardware version it wants
+classified, and devices without one report an unknown supply.
+*/
+type PowerProfile struct {
+	VoltsPerCount float64
+	OffsetV       float64
+	Bands         []PowerBand
+}
+
+func (p PowerProfile) validate() error {
+	if p.VoltsPerCount <= 0 {
+		return fmt.Errorf("volts per count must be positive, got %v", p.VoltsPerCount)
+	}
+	if len(p.Bands) == 0 {
+		return fmt.Errorf("no supply bands")
+	}
+	for i, b := range p.Bands {
+		if b.MinV > b.MaxV {
+			return fmt.Errorf("band %s: min %v V above max %v V", b.Supply, b.MinV, b.MaxV)
+		}
+		if i > 0 && b.MinV <= p.Bands[i-1].MaxV {
+			return fmt.Errorf("band %s overlaps or is out of order with band %s", b.Supply, p.Bands[i-1].Supply)
+		}
+	}
+	return nil
+}
+
+// Seconds either side of a reboot in which an undervoltage reading implicates the supply
+const DEFAULT_POWER_CORRELATION_WINDOW_SEC = 600
+
+type PowerReading struct {
+	Volts        float64
+	Supply       PowerSupply
+	Undervoltage bool
+}
+
+/*
+Scale & classify a raw PoeUsbVoltage. A reading above every band is taken as the highest band.
+*/
+func (p PowerProfile) Classify(raw uint8) PowerReading {
+	if raw == 0 || len(p.Bands) == 0 {
+		return PowerReading{Supply: POWER_SUPPLY_UNKNOWN}
+	}
+	r := PowerReading{Volts: float64(raw)*p.VoltsPerCount + p.OffsetV}
+	for _, b := range p.Bands {
+		if r.Volts <= b.MaxV {
+			r.Supply = b.Supply
+			r.Undervoltage = r.Volts < b.MinV
+			return r
+		}
+	}
+	r.Supply = p.Bands[len(p.Bands)-1].Supply
+	return r
+}
+
+type PowerHealth struct {
+	SerialNumber uint16
+	Status       PowerStatus
+	Supply       PowerSupply
+	LastVolts    float64
+	MinVolts     float64
+	MaxVolts     float64
+	LastUnix     uint32
+
+	Samples             uint64
+	UndervoltageSamples uint64
+	Reboots             uint64
+	// Reboots with an undervoltage reading within the correlation window either side
+	BrownoutReboots uint64
+	LastReboot      uint32
+}
+
+func (h PowerHealth) ToMap() map[string]any {
+	ret := map[string]any{
+		KEY_SERIAL_NUMBER:    h.SerialNumber,
+		KEY_POWER_STATUS:     string(h.Status),
+		KEY_SUPPLY_TYPE:      string(h.Supply),
+		KEY_SUPPLY_VOLTS:     h.LastVolts,
+		KEY_REBOOTS:          h.Reboots,
+		KEY_BROWNOUT_REBOOTS: h.BrownoutReboots,
+	}
+	if h.Samples > 0 {
+		ret[KEY_UNDERVOLT_FRACTION] = float64(h.UndervoltageSamples) / float64(h.Samples)
+	}
+	return ret
+}
+
+/*
+Tracks supply voltage and reboots per device, and flags reboots that follow or precede an undervoltage reading as
+brown-outs. Samples should arrive roughly in time order. Safe for concurrent use.
+*/
+type PowerMonitor struct {
+	// By hardware version. Devices without a profile (including Mk1 & Mk3, which report no supply voltage) are only
+	// tracked for reboots, and their supply and status stay unknown.
+	Profiles map[uint8]PowerProfile
+	// Seconds either side of a reboot in which an undervoltage reading implicates the supply
+	CorrelationWindow uint32
+
+	mu      sync.Mutex
+	devices map[uint16]*powerState
+}
+
+type powerState struct {
+	health           PowerHealth
+	seen             bool
+	lastSampleTimeMs uint32
+	lastResetUnix    uint32
+	lastUndervolt    uint32 // unix of the last undervoltage reading, 0 for none
+	pendingReboot    bool   // last reboot not yet tied to an undervoltage reading
+}
+
+/*
+Create a monitor classifying supply voltage with the given profiles, by hardware version.
+*/
+func NewPowerMonitor(profiles map[uint8]PowerProfile) (*PowerMonitor, error) {
+	for hw, p := range profiles {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("invalid power profile for Mk%d: %w", hw, err)
+		}
+	}
+	return &PowerMonitor{
+		Profiles:          profiles,
+		CorrelationWindow: DEFAULT_POWER_CORRELATION_WINDOW_SEC,
+		devices:           map[uint16]*powerState{},
+	}, nil
+}
+
+func (pm *PowerMonitor) Add(d DuetData) PowerReading {
+	reading := PowerReading{Supply: POWER_SUPPLY_UNKNOWN}
+	profile, hasProfile := pm.Profiles[d.GetTypeInfo().DeviceType.Hardware]
+	raw, hasRaw := mapFloat(d.ToMap(""), KEY_POE_USB_VOLTAGE)
+	if hasProfile && hasRaw {
+		reading = profile.Classify(uint8(raw))
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.devices == nil {
+		pm.devices = map[uint16]*powerState{}
+	}
+	sn := d.GetSerialNumber()
+	s, ok := pm.devices[sn]
+	if !ok {
+		s = &powerState{health: PowerHealth{SerialNumber: sn, Status: POWER_STATUS_UNKNOWN, Supply: POWER_SUPPLY_UNKNOWN}}
+		pm.devices[sn] = s
+	}
+	s.record(d, reading, pm.CorrelationWindow)
+	return reading
+}
+
+func (s *powerState) record(d DuetData, r PowerReading, window uint32) {
+	h := &s.health
+	unix := d.Timestamp()
+	sampleMs, resetUnix := d.GetSampleTimeMs(), d.GetLastResetUnix()
+
+	// A reboot restarts SampleTimeMs, moving the derived reset time forward
+	if s.seen && sampleMs < s.lastSampleTimeMs && resetMovedForward(s.lastResetUnix, resetUnix) {
+		h.Reboots++
+		h.LastReboot = resetUnix
+		s.pendingReboot = true
+		if s.lastUndervolt != 0 && resetUnix <= s.lastUndervolt+window {
+			h.BrownoutReboots++
+			s.pendingReboot = false
+		}
+	}
+	if !s.seen || resetMovedForward(s.lastResetUnix, resetUnix) || sampleMs > s.lastSampleTimeMs {
+		s.lastSampleTimeMs, s.lastResetUnix = sampleMs, resetUnix
+	}
+	s.seen = true
+	if unix > h.LastUnix {
+		h.LastUnix = unix
+	}
+
+	if r.Supply == POWER_SUPPLY_UNKNOWN {
+		return
+	}
+	h.Samples++
+	h.Supply = r.Supply
+	h.LastVolts = r.Volts
+	if h.Samples == 1 || r.Volts < h.MinVolts {
+		h.MinVolts = r.Volts
+	}
+	if r.Volts > h.MaxVolts {
+		h.MaxVolts = r.Volts
+	}
+	if r.Undervoltage {
+		h.UndervoltageSamples++
+		s.lastUndervolt = unix
+		if s.pendingReboot && unix <= h.LastReboot+window {
+			h.BrownoutReboots++
+			s.pendingReboot = false
+		}
+	}
+
+	switch {
+	case r.Undervoltage:
+		h.Status = POWER_STATUS_CRITICAL
+	case h.UndervoltageSamples > 0 || h.BrownoutReboots > 0:
+		h.Status = POWER_STATUS_DEGRADED
+	default:
+		h.Status = POWER_STATUS_OK
+	}
+}
+
+func (pm *PowerMonitor) Health(serialNumber uint16) (PowerHealth, bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	s, ok := pm.devices[serialNumber]
+	if !ok {
+		return PowerHealth{}, false
+	}
+	return s.health, true
+}
+
+/*
+Every device's health, by serial.
+*/
+func (pm *PowerMonitor) Snapshot() []PowerHealth {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	ret := make([]PowerHealth, 0, len(pm.devices))
+	for _, s := range pm.devices {
+		ret = append(ret, s.health)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].SerialNumber < ret[j].SerialNumber })
+	return ret
+}
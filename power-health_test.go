@@ -0,0 +1,120 @@
+package telosairduetcommon
+
+import (
+	"math"
+	"testing"
+)
+
+// Illustrative scaling for the tests only, not a real board's divider
+var testPowerProfile = PowerProfile{
+	VoltsPerCount: 0.1,
+	Bands: []PowerBand{
+		{POWER_SUPPLY_BATTERY, 3.3, 4.3},
+		{POWER_SUPPLY_USB, 4.6, 5.5},
+		{POWER_SUPPLY_POE, 11.0, 13.5},
+	},
+}
+
+func powerTestSample(unix, uptimeSec uint32, raw uint8) *DuetDataMk4Var7 {
+	return &DuetDataMk4Var7{SerialNumber: 9, UnixSec: unix, SampleTimeMs: uptimeSec * 1000, LastResetUnix: unix - uptimeSec, PoeUsbVoltage: raw}
+}
+
+func TestPowerProfileClassify(t *testing.T) {
+	for _, td := range []struct {
+		raw          uint8
+		supply       PowerSupply
+		undervoltage bool
+	}{
+		{0, POWER_SUPPLY_UNKNOWN, false},
+		{30, POWER_SUPPLY_BATTERY, true},
+		{33, POWER_SUPPLY_BATTERY, false},
+		{43, POWER_SUPPLY_BATTERY, false},
+		{44, POWER_SUPPLY_USB, true},
+		{50, POWER_SUPPLY_USB, false},
+		{90, POWER_SUPPLY_POE, true},
+		{120, POWER_SUPPLY_POE, false},
+		{200, POWER_SUPPLY_POE, false},
+	} {
+		r := testPowerProfile.Classify(td.raw)
+		if r.Supply != td.supply || r.Undervoltage != td.undervoltage {
+			t.Errorf("Classify(%d) = %s, undervoltage %v; want %s, %v", td.raw, r.Supply, r.Undervoltage, td.supply, td.undervoltage)
+		}
+		if td.raw != 0 && math.Abs(r.Volts-float64(td.raw)/10) > 1e-9 {
+			t.Errorf("Classify(%d) = %f V", td.raw, r.Volts)
+		}
+	}
+}
+
+func TestNewPowerMonitorValidatesProfiles(t *testing.T) {
+	for name, p := range map[string]PowerProfile{
+		"no scaling": {Bands: testPowerProfile.Bands},
+		"no bands":   {VoltsPerCount: 0.1},
+		"overlap":    {VoltsPerCount: 0.1, Bands: []PowerBand{{POWER_SUPPLY_USB, 4.6, 5.5}, {POWER_SUPPLY_BATTERY, 3.3, 4.8}}},
+	} {
+		if _, err := NewPowerMonitor(map[uint8]PowerProfile{4: p}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := NewPowerMonitor(nil); err != nil {
+		t.Errorf("expected a monitor without profiles, got %v", err)
+	}
+}
+
+func TestPowerMonitorBrownouts(t *testing.T) {
+	pm, err := NewPowerMonitor(map[uint8]PowerProfile{4: testPowerProfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.Add(powerTestSample(10_000, 5_000, 120))
+	pm.Add(powerTestSample(10_060, 5_060, 120))
+	if h, _ := pm.Health(9); h.Status != POWER_STATUS_OK || h.Supply != POWER_SUPPLY_POE {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+
+	// Sagging, then a reboot a minute later
+	pm.Add(powerTestSample(10_120, 5_120, 95))
+	pm.Add(powerTestSample(10_180, 20, 120))
+	h, _ := pm.Health(9)
+	if h.Reboots != 1 || h.BrownoutReboots != 1 || h.Status != POWER_STATUS_DEGRADED {
+		t.Errorf("expected a brown-out reboot: %+v", h)
+	}
+
+	// A reboot with clean supply either side is not a brown-out
+	pm.Add(powerTestSample(20_000, 9_800, 120))
+	pm.Add(powerTestSample(20_060, 10, 120))
+	pm.Add(powerTestSample(20_120, 70, 120))
+	if h, _ = pm.Health(9); h.Reboots != 2 || h.BrownoutReboots != 1 {
+		t.Errorf("expected a second, clean reboot: %+v", h)
+	}
+
+	// Undervoltage seen just after a reboot implicates the supply too
+	pm.Add(powerTestSample(30_000, 10, 120))
+	pm.Add(powerTestSample(30_060, 70, 95))
+	if h, _ = pm.Health(9); h.Reboots != 3 || h.BrownoutReboots != 2 || h.Status != POWER_STATUS_CRITICAL {
+		t.Errorf("expected a brown-out from a later reading: %+v", h)
+	}
+	if frac := h.ToMap()[KEY_UNDERVOLT_FRACTION].(float64); math.Abs(frac-2.0/9) > 1e-9 {
+		t.Errorf("undervoltage fraction %f", frac)
+	}
+
+	// Clock jitter in the derived reset time is not a reboot
+	pm.Add(powerTestSample(30_125, 130, 120))
+	if h, _ = pm.Health(9); h.Reboots != 3 {
+		t.Errorf("jitter counted as a reboot: %+v", h)
+	}
+}
+
+func TestPowerMonitorWithoutProfile(t *testing.T) {
+	pm, err := NewPowerMonitor(map[uint8]PowerProfile{4: testPowerProfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.Add(&DuetDataMk1Var0{SerialNumber: 3, UnixSec: 1_000, SampleTimeMs: 900_000, LastResetUnix: 100})
+	if r := pm.Add(&DuetDataMk1Var0{SerialNumber: 3, UnixSec: 1_060, SampleTimeMs: 10_000, LastResetUnix: 1_050}); r.Supply != POWER_SUPPLY_UNKNOWN {
+		t.Errorf("expected no classification for Mk1, got %+v", r)
+	}
+	h, ok := pm.Health(3)
+	if !ok || h.Reboots != 1 || h.Status != POWER_STATUS_UNKNOWN || h.Samples != 0 {
+		t.Errorf("expected reboots only: %+v", h)
+	}
+}
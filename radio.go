@@ -1,16 +1,32 @@
 package telosairduetcommon
 
-import "fmt"
+import (
+	"encoding/binary"
+	"fmt"
+)
 
 type RadioMetadata struct {
 	LastSnr         int32
 	LastRssi        int16
 	Hops            uint8
 	RadioSentTimeMs uint32
+
+	// Whether the fields above were actually reported by a gateway (an SNR of 0 is a valid reading).
+	Present bool
+}
+
+func NewRadioMetadata(lastRssi int16, lastSnr int32, hops uint8, radioSentTimeMs uint32) RadioMetadata {
+	return RadioMetadata{
+		LastSnr:         lastSnr,
+		LastRssi:        lastRssi,
+		Hops:            hops,
+		RadioSentTimeMs: radioSentTimeMs,
+		Present:         true,
+	}
 }
 
 func (m *RadioMetadata) ToMap() map[string]any {
-	if m.LastSnr == 0 {
+	if !m.Present {
 		return nil
 	}
 	return map[string]any{
@@ -20,6 +36,119 @@ func (m *RadioMetadata) ToMap() map[string]any {
 	}
 }
 
+/*
+Optional, only present once set by a gateway.
+*/
+func (m *RadioMetadata) FieldSpecs() []FieldSpec {
+	return optionalFields([]FieldSpec{
+		rangedField(KEY_RSSI, "int16", UNIT_DBM, -150, 0, "RSSI of the last received packet"),
+		rangedField(KEY_SNR, "int32", UNIT_DB, -50, 50, "SNR of the last received packet"),
+		field(KEY_HOPS, "uint8", "", "Mesh hops to the gateway"),
+	})
+}
+
 func (m *RadioMetadata) String() string {
+	if !m.Present {
+		return "Radio: none"
+	}
 	return fmt.Sprintf("Radio: RSSI %d, SNR %d, Hops %d", m.LastRssi, m.LastSnr, m.Hops)
 }
+
+/* ~~ Gateway Frame Envelope ~~ */
+
+/*
+What the LoRa gateway forwards for every packet it receives:
+
+	typedef struct __attribute__((packed)) {
+	  uint8_t envelopeVersion; // GATEWAY_FRAME_VERSION
+	  uint8_t flags;           // bit 0: radio metadata present
+	  int16_t lastRssi;
+	  int32_t lastSnr;
+	  uint8_t hops;
+	  uint32_t radioSentTimeMs;
+	} gateway_frame_header_t;
+
+followed by the Duet payload exactly as `DuetDataFromRadioBytes` expects it (hardware version, sensor variation, sample).
+*/
+const (
+	GATEWAY_FRAME_VERSION      = 1
+	GATEWAY_FRAME_HEADER_LEN   = 13
+	GATEWAY_FLAG_RADIO_PRESENT = 0x01
+)
+
+type GatewayFrame struct {
+	Version uint8
+	Flags   uint8
+	Radio   RadioMetadata
+	Payload []byte
+}
+
+func ParseGatewayFrame(b []byte) (GatewayFrame, error) {
+	var f GatewayFrame
+	if n := len(b); n < GATEWAY_FRAME_HEADER_LEN {
+		return f, fmt.Errorf("expected at least %d bytes for gateway frame header, got %d", GATEWAY_FRAME_HEADER_LEN, n)
+	}
+	f.Version = b[0]
+	if f.Version != GATEWAY_FRAME_VERSION {
+		return f, fmt.Errorf("unsupported gateway frame version: %d", f.Version)
+	}
+	f.Flags = b[1]
+	if checkBitSet(uint16(f.Flags), GATEWAY_FLAG_RADIO_PRESENT) {
+		f.Radio = NewRadioMetadata(
+			int16(binary.LittleEndian.Uint16(b[2:4])),
+			int32(binary.LittleEndian.Uint32(b[4:8])),
+			b[8],
+			binary.LittleEndian.Uint32(b[9:13]),
+		)
+	}
+	f.Payload = b[GATEWAY_FRAME_HEADER_LEN:]
+	return f, nil
+}
+
+func (f GatewayFrame) Bytes() []byte {
+	flags := f.Flags &^ GATEWAY_FLAG_RADIO_PRESENT
+	if f.Radio.Present {
+		flags |= GATEWAY_FLAG_RADIO_PRESENT
+	}
+	b := make([]byte, GATEWAY_FRAME_HEADER_LEN, GATEWAY_FRAME_HEADER_LEN+len(f.Payload))
+	b[0] = GATEWAY_FRAME_VERSION
+	b[1] = flags
+	binary.LittleEndian.PutUint16(b[2:4], uint16(f.Radio.LastRssi))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(f.Radio.LastSnr))
+	b[8] = f.Radio.Hops
+	binary.LittleEndian.PutUint32(b[9:13], f.Radio.RadioSentTimeMs)
+	return append(b, f.Payload...)
+}
+
+/*
+Decode a full gateway frame: the Duet sample plus the radio metadata the gateway attached to it.
+The sample time is derived from the radio metadata when present; otherwise (or if the radio timing is unusable)
+the receive time is used and the sample is not marked as time-resolved.
+*/
+func DuetDataFromGatewayFrame(frame []byte, recievedUnixSec uint32, receivedTimeOk bool) (DuetData, error) {
+	f, err := ParseGatewayFrame(frame)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gateway frame: %w", err)
+	}
+	d, err := duetDataFromBytes(f.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	d.SetConnectionType(CONNECTION_TYPE_LORA_GATEWAY)
+	timeOk := receivedTimeOk
+	if f.Radio.Present {
+		d.SetRadioData(f.Radio)
+		if err := d.SetTimeRadio(recievedUnixSec); err != nil {
+			d.SetTimeSerial(recievedUnixSec)
+			timeOk = false
+		}
+	} else {
+		d.SetTimeSerial(recievedUnixSec)
+		timeOk = false
+	}
+	d.RecalculateLastResetUnix()
+	d.MarkTimeResolved(timeOk)
+
+	return d, nil
+}
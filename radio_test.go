@@ -0,0 +1,68 @@
+package telosairduetcommon
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func mk4Var17TestPayload(serialNumber uint16, sampleTimeMs uint32) []byte {
+	b := make([]byte, 2+DuetTypeMk4Var17.ExpectedBytes)
+	b[0], b[1] = 4, 17
+	binary.LittleEndian.PutUint16(b[4:6], serialNumber)
+	binary.LittleEndian.PutUint32(b[12:16], sampleTimeMs)
+	return b
+}
+
+func TestGatewayFrameRoundTrip(t *testing.T) {
+	f := GatewayFrame{
+		Radio:   NewRadioMetadata(-112, 0, 2, 65_000),
+		Payload: mk4Var17TestPayload(42, 5_000),
+	}
+	parsed, err := ParseGatewayFrame(f.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Radio != f.Radio {
+		t.Errorf("radio metadata = %+v; want %+v", parsed.Radio, f.Radio)
+	}
+
+	d, err := DuetDataFromGatewayFrame(f.Bytes(), 1_000_000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.GetSerialNumber(); got != 42 {
+		t.Errorf("serial number = %d; want 42", got)
+	}
+	// Sent 60s after sampling, so the sample is 60s older than receipt
+	if got := d.Timestamp(); got != 1_000_000-60 {
+		t.Errorf("timestamp = %d; want %d", got, 1_000_000-60)
+	}
+	if !d.TimeResolved() {
+		t.Error("expected time to be resolved")
+	}
+	// SNR of 0 is a real reading and must still be emitted
+	if _, ok := d.ToMap("gw")[KEY_SNR]; !ok {
+		t.Errorf("expected %s in map for present radio metadata with SNR 0", KEY_SNR)
+	}
+}
+
+func TestGatewayFrameWithoutRadioMetadata(t *testing.T) {
+	f := GatewayFrame{Payload: mk4Var17TestPayload(42, 5_000)}
+	d, err := DuetDataFromGatewayFrame(f.Bytes(), 1_000_000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.GetRadioData().Present {
+		t.Error("expected radio metadata to be absent")
+	}
+	if _, ok := d.ToMap("gw")[KEY_RSSI]; ok {
+		t.Errorf("expected no %s in map without radio metadata", KEY_RSSI)
+	}
+	if d.TimeResolved() {
+		t.Error("expected time to be unresolved without radio timing")
+	}
+
+	if _, err := ParseGatewayFrame([]byte{GATEWAY_FRAME_VERSION, 0}); err == nil {
+		t.Error("expected error for truncated header")
+	}
+}
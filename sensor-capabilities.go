@@ -0,0 +1,160 @@
+package telosairduetcommon
+
+/* ~~ Sensor Capabilities ~~ */
+
+/*
+A sensor a Duet variant can carry. Named like the measurements' `DirectoryName()`.
+TGS methane, FS3000 and GPS have no measurement type; see MethaneSensorData, AirflowData and GpsLocated.
+*/
+type SensorKind string
+
+const (
+	SENSOR_PMS5003       SensorKind = "pms5003"
+	SENSOR_SPS30         SensorKind = "sps30"
+	SENSOR_OPC_N3        SensorKind = "alphasense-opc-n3"
+	SENSOR_SI7021        SensorKind = "si7021"
+	SENSOR_HTU21         SensorKind = "htu21df"
+	SENSOR_SCD41         SensorKind = "scd41"
+	SENSOR_PLANTOWER_CO2 SensorKind = "plantower_co2"
+	SENSOR_SGP30         SensorKind = "sgp30"
+	SENSOR_SGP40         SensorKind = "sgp40"
+	SENSOR_MPRLS         SensorKind = "mprls"
+	SENSOR_GAS           SensorKind = "gas"
+
+	// Not a sensor: the temp & hum `ToMap()` reports, combined from the variant's temp / RH sensors.
+	SENSOR_TEMP_RH SensorKind = "combined_temp_rh"
+)
+
+var AllSensorKinds = []SensorKind{
+	SENSOR_PMS5003, SENSOR_SPS30, SENSOR_OPC_N3, SENSOR_SI7021, SENSOR_HTU21, SENSOR_SCD41, SENSOR_PLANTOWER_CO2,
+	SENSOR_SGP30, SENSOR_SGP40, SENSOR_MPRLS, SENSOR_GAS, SENSOR_TEMP_RH,
+}
+
+/*
+Whether every sample of this type carries the sensor.
+*/
+func (typeInfo DuetTypeInfo) HasSensor(kind SensorKind) bool {
+	return typeInfo.StructInstanceGetter().HasSensor(kind)
+}
+
+/*
+The sensors every sample of this type carries, in AllSensorKinds order.
+*/
+func (typeInfo DuetTypeInfo) Sensors() []SensorKind {
+	d := typeInfo.StructInstanceGetter()
+	var ret []SensorKind
+	for _, kind := range AllSensorKinds {
+		if d.HasSensor(kind) {
+			ret = append(ret, kind)
+		}
+	}
+	return ret
+}
+
+/*
+SensorBitField for the named gases, see GasSensorNames and GAS_BIT_H2S. For variants that carry gas readings as loose
+fields.
+*/
+func gasSensorBits(names ...string) uint16 {
+	var ret uint16
+	for _, name := range names {
+		if name == KEY_GAS_H2S {
+			ret |= GAS_BIT_H2S
+		}
+		for i, n := range GasSensorNames {
+			if n == name {
+				ret |= 1 << i
+			}
+		}
+	}
+	return ret
+}
+
+/* ~~ Typed Accessors ~~ */
+
+/*
+The reported PM2.5 in µg/m³: the merged value for dual OPC variants, otherwise the variant's only OPC.
+*/
+func SamplePm2p5(d DuetData) (float32, bool) {
+	for _, kind := range []SensorKind{SENSOR_SPS30, SENSOR_PMS5003, SENSOR_OPC_N3} {
+		m, ok := d.Measurement(kind)
+		if !ok {
+			continue
+		}
+		switch m := m.(type) {
+		case Pms5003Measurement:
+			if dd, ok := d.(DualOpcData); ok {
+				_, _, merged := dd.OpcChannels()
+				return float32(merged.PM2p5), true
+			}
+			return float32(m.PM2p5), true
+		case Sps30FloatMeasurement:
+			return m.PM2p5, true
+		case AlphasenseOpcN3Measurement:
+			return m.PM2p5, true
+		}
+	}
+	return 0, false
+}
+
+/*
+CO2 in ppm, from the SCD41 or the Plantower CO2 sensor.
+*/
+func SampleCo2(d DuetData) (uint16, bool) {
+	if m, ok := d.Measurement(SENSOR_SCD41); ok {
+		return m.(Scd41Measurement).Co2, true
+	}
+	if m, ok := d.Measurement(SENSOR_PLANTOWER_CO2); ok {
+		return m.(PlantowerCo2Measurement).Co2, true
+	}
+	return 0, false
+}
+
+func sampleTempRh(d DuetData) (TempRhMeasurement, bool) {
+	m, ok := d.Measurement(SENSOR_TEMP_RH)
+	if !ok {
+		return nil, false
+	}
+	t, ok := m.(TempRhMeasurement)
+	return t, ok
+}
+
+/*
+The reported temperature in °C, as `ToMap()` emits it under KEY_TEMP.
+*/
+func SampleTemperature(d DuetData) (float32, bool) {
+	if t, ok := sampleTempRh(d); ok {
+		return t.Temperature(), true
+	}
+	return 0, false
+}
+
+/*
+The reported relative humidity in %, as `ToMap()` emits it under KEY_HUM.
+*/
+func SampleHumidity(d DuetData) (float32, bool) {
+	if t, ok := sampleTempRh(d); ok {
+		return t.Humidity(), true
+	}
+	return 0, false
+}
+
+/*
+MPRLS pressure, in kPa (some firmware reports hPa).
+*/
+func SamplePressure(d DuetData) (float32, bool) {
+	if m, ok := d.Measurement(SENSOR_MPRLS); ok {
+		return m.(MprlsMeasurement).Pressure, true
+	}
+	return 0, false
+}
+
+/*
+SGP40 VOC index.
+*/
+func SampleVocIndex(d DuetData) (uint32, bool) {
+	if m, ok := d.Measurement(SENSOR_SGP40); ok {
+		return m.(Sgp40Measurement).VocIndex, true
+	}
+	return 0, false
+}
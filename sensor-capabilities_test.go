@@ -0,0 +1,89 @@
+package telosairduetcommon
+
+import (
+	"math"
+	"testing"
+)
+
+/*
+Every registered type's capabilities must agree with the keys its `ToMap()` emits.
+*/
+func TestSensorCapabilitiesMatchToMap(t *testing.T) {
+	for _, typeInfo := range RegisteredDuetTypes() {
+		d := typeInfo.StructInstanceGetter()
+		m := d.ToMap("")
+		for _, kind := range AllSensorKinds {
+			_, ok := d.Measurement(kind)
+			if d.HasSensor(kind) != ok || typeInfo.HasSensor(kind) != ok {
+				t.Errorf("%s: HasSensor(%s) disagrees with Measurement()", typeInfo.TypeAlias, kind)
+			}
+		}
+		if len(typeInfo.Sensors()) == 0 {
+			t.Errorf("%s: no sensors", typeInfo.TypeAlias)
+		}
+
+		for _, td := range []struct {
+			key string
+			ok  bool
+		}{
+			{"pm25_m", pick2(SamplePm2p5(d))},
+			{KEY_SCD_CO2, pick2(SampleCo2(d))},
+			{KEY_TEMP, pick2(SampleTemperature(d))},
+			{KEY_HUM, pick2(SampleHumidity(d))},
+			{KEY_MPRLS_PRESSURE, pick2(SamplePressure(d))},
+		} {
+			if _, inMap := m[td.key]; inMap != td.ok {
+				t.Errorf("%s: `%s` in ToMap() is %v, accessor ok is %v", typeInfo.TypeAlias, td.key, inMap, td.ok)
+			}
+		}
+	}
+}
+
+func pick2[T any](_ T, ok bool) bool {
+	return ok
+}
+
+func TestSensorCapabilities(t *testing.T) {
+	sps1 := [SPS30_FLOAT_VALUE_LEN]float32{0.4, 1.2, 1.6, 2.0, 10, 12, 13, 13.5, 14, 0.55}
+	sps2 := [SPS30_FLOAT_VALUE_LEN]float32{0.6, 1.4, 1.8, 2.2, 11, 12, 13, 13.5, 14, 0.45}
+	d, err := DuetDataFromRadioBytes(mk4Var28TestPayload(sps1, sps2), 1_000_000, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pm, ok := SamplePm2p5(d); !ok || math.Abs(float64(pm)-1.3) > 1e-6 {
+		t.Errorf("SamplePm2p5 = %v, %v; want the merged 1.3", pm, ok)
+	}
+	if p, ok := SamplePressure(d); !ok || p != 101.3 {
+		t.Errorf("SamplePressure = %v, %v; want 101.3", p, ok)
+	}
+	if _, ok := SampleVocIndex(d); !ok {
+		t.Error("expected an SGP40 VOC index")
+	}
+	if d.HasSensor(SENSOR_PMS5003) || d.HasSensor(SENSOR_GAS) {
+		t.Error("Mk4.28 has neither a PMS5003 nor a gas board")
+	}
+
+	if !DuetTypeMk4Var24.HasSensor(SENSOR_OPC_N3) || DuetTypeMk4Var24.HasSensor(SENSOR_SPS30) {
+		t.Errorf("unexpected Mk4.24 sensors: %v", DuetTypeMk4Var24.Sensors())
+	}
+	if !DuetTypeMk1Var3.HasSensor(SENSOR_SGP30) || !DuetTypeMk1Var0.HasSensor(SENSOR_PLANTOWER_CO2) {
+		t.Error("expected an SGP30 on Mk1.3 and a Plantower CO2 on Mk1.0")
+	}
+
+	mk421 := &DuetDataMk4Var21{Co: 0.5, No2: 12, H2s: 3}
+	gas, ok := mk421.Measurement(SENSOR_GAS)
+	if !ok {
+		t.Fatal("expected a gas board on Mk4.21")
+	}
+	data := gas.DirectoryData()
+	if data[KEY_GAS_CO] != 0.5 || data[KEY_GAS_NO2] != 12 || data[KEY_GAS_H2S] != 3 {
+		t.Errorf("unexpected gas data: %v", data)
+	}
+	mk413 := &DuetDataMk4Var13{H2s: 4}
+	if gas, ok := mk413.Measurement(SENSOR_GAS); !ok || gas.(GasSensorsMeasurement).ToMap()[KEY_GAS_H2S] != float32(4) {
+		t.Errorf("expected H2S in the Mk4.13 gas board, got %v", gas)
+	}
+	if _, ok := data[KEY_GAS_O3]; ok {
+		t.Errorf("Mk4.21 has no O3 sensor: %v", data)
+	}
+}
@@ -9,41 +9,73 @@ import (
 	"strings"
 )
 
+// SPS30 in its uint16 output mode, which the firmware packs in the PMS5003 layout.
 type Sps30Measurement = Pms5003Measurement
 
+/*
+SPS30 in its float output mode: mass in µg/m³, number in #/cm³, typical particle size in µm.
+Unlike the uint16 mode (`Sps30Measurement`) this keeps sub-µg/m³ resolution and PM4.
+*/
 type Sps30FloatMeasurement struct {
-	PM1, PM2p5, PM10                    float32
-	PN0p3, PN0p5, PN1, PN2p5, PN5, PN10 float32
+	PM1, PM2p5, PM4, PM10        float32
+	PN0p5, PN1, PN2p5, PN4, PN10 float32
+	TypicalSize                  float32
 }
 
+const (
+	SPS30_FLOAT_BYTES     = 40
+	SPS30_FLOAT_VALUE_LEN = 10
+	KEY_PREFIX_TYP_SIZE   = "typ_size"
+)
+
 func (m *Sps30FloatMeasurement) String() string {
-	return fmt.Sprintf("PM 1: %.1f, 2.5: %.1f, 10: %.1f | PN 0.3: %.1f, 0.5: %.1f, 1: %.1f, 2.5: %.1f, 5: %.1f, 10: %.1f",
-		m.PM1, m.PM2p5, m.PM10, m.PN0p3, m.PN0p5, m.PN1, m.PN2p5, m.PN5, m.PN10)
+	return fmt.Sprintf("PM 1: %.2f, 2.5: %.2f, 4: %.2f, 10: %.2f | PN 0.5: %.2f, 1: %.2f, 2.5: %.2f, 4: %.2f, 10: %.2f | Size %.3f",
+		m.PM1, m.PM2p5, m.PM4, m.PM10, m.PN0p5, m.PN1, m.PN2p5, m.PN4, m.PN10, m.TypicalSize)
 }
 
 /*
-Convert the sample to a map, adding the suffix to the end of each key.
+Convert the sample to a map, adding the suffix to the end of each key. Keys match `Pms5003Measurement.ToMap()` where
+the sensors overlap.
 */
 func (m *Sps30FloatMeasurement) ToMap(suffix string) map[string]any {
 	return map[string]any{
 		"pm10" + suffix:  m.PM1,
 		"pm25" + suffix:  m.PM2p5,
+		"pm40" + suffix:  m.PM4,
 		"pm100" + suffix: m.PM10,
 
-		"pn03" + suffix:  m.PN0p3,
 		"pn05" + suffix:  m.PN0p5,
 		"pn10" + suffix:  m.PN1,
 		"pn25" + suffix:  m.PN2p5,
-		"pn50" + suffix:  m.PN5,
+		"pn40" + suffix:  m.PN4,
 		"pn100" + suffix: m.PN10,
+
+		KEY_PREFIX_TYP_SIZE + suffix: m.TypicalSize,
 	}
 }
 
 /*
-Take the raw uint16s encoded as bytes and convert them, LittleEndian, to fill a PMS5003 measurement.
+The keys of `ToMap()` with the same suffix. Number concentrations are cumulative from 0.3 µm.
+*/
+func (m *Sps30FloatMeasurement) FieldSpecs(suffix string) []FieldSpec {
+	pm := func(key, size string) FieldSpec {
+		return rangedField(key+suffix, "float32", UNIT_UG_M3, 0, 1000, "PM"+size+" mass concentration")
+	}
+	pn := func(key, size string) FieldSpec {
+		return rangedField(key+suffix, "float32", UNIT_PER_CM3, 0, 3000, "Particles 0.3 – "+size+" µm")
+	}
+	return []FieldSpec{
+		pm("pm10", "1"), pm("pm25", "2.5"), pm("pm40", "4"), pm("pm100", "10"),
+		pn("pn05", "0.5"), pn("pn10", "1"), pn("pn25", "2.5"), pn("pn40", "4"), pn("pn100", "10"),
+		rangedField(KEY_PREFIX_TYP_SIZE+suffix, "float32", UNIT_UM, 0, 10, "Typical particle size"),
+	}
+}
+
+/*
+Read the raw float32s, LittleEndian, in the sensor's output order.
 */
 func (m *Sps30FloatMeasurement) PopulateFromBytesReader(reader io.Reader) error {
-	for p := range m.PointerIterable() {
+	for _, p := range m.PointerIterable() {
 		if err := binary.Read(reader, binary.LittleEndian, p); err != nil {
 			return fmt.Errorf("failed to read a float: %w", err)
 		}
@@ -52,18 +84,18 @@ func (m *Sps30FloatMeasurement) PopulateFromBytesReader(reader io.Reader) error
 }
 
 /*
-Take the raw uint16s encoded as bytes and convert them, LittleEndian, to fill a PMS5003 measurement.
+Take the raw float32s encoded as bytes and convert them, LittleEndian, to fill the measurement.
 */
 func (m *Sps30FloatMeasurement) PopulateFromBytes(buff []byte) error {
-	if len(buff) < 36 {
-		return fmt.Errorf("expected >%d bytes, got %d", 36, len(buff))
+	if len(buff) < SPS30_FLOAT_BYTES {
+		return fmt.Errorf("expected >%d bytes, got %d", SPS30_FLOAT_BYTES, len(buff))
 	}
 	reader := bytes.NewReader(buff)
 	return m.PopulateFromBytesReader(reader)
 }
 
 func (p *Sps30FloatMeasurement) PointerIterable() []any {
-	return []any{&p.PM1, &p.PM2p5, &p.PM10, &p.PN0p3, &p.PN0p5, &p.PN1, &p.PN2p5, &p.PN5, &p.PN10}
+	return []any{&p.PM1, &p.PM2p5, &p.PM4, &p.PM10, &p.PN0p5, &p.PN1, &p.PN2p5, &p.PN4, &p.PN10, &p.TypicalSize}
 }
 
 func (p *Sps30FloatMeasurement) FromSerialString(s string) error {
@@ -71,66 +103,18 @@ func (p *Sps30FloatMeasurement) FromSerialString(s string) error {
 	splitStr := strings.Split(strings.Trim(s, "[]"), ",")
 
 	// Make sure the length is correct.
-	if len(splitStr) != 9 {
-		return fmt.Errorf("expected list of length 9 for PlantowerData. Instead, have %d: %v", len(splitStr), splitStr)
+	if len(splitStr) != SPS30_FLOAT_VALUE_LEN {
+		return fmt.Errorf("expected list of length %d for Sps30 (float). Instead, have %d: %v", SPS30_FLOAT_VALUE_LEN, len(splitStr), splitStr)
 	}
 
 	// Try to convert each token from the slice to a float32
-	convErr := fmt.Errorf("failed to convert a sps30 (float) data point to float32 from %v", splitStr)
-	if val, err := strconv.ParseFloat(splitStr[0], 32); err != nil {
-		return convErr
-	} else {
-		p.PM1 = float32(val)
-	}
-
-	if val, err := strconv.ParseFloat(splitStr[1], 32); err != nil {
-		return convErr
-	} else {
-		p.PM2p5 = float32(val)
-	}
-
-	if val, err := strconv.ParseFloat(splitStr[2], 32); err != nil {
-		return convErr
-	} else {
-		p.PM10 = float32(val)
-	}
-
-	if val, err := strconv.ParseFloat(splitStr[3], 32); err != nil {
-		return convErr
-	} else {
-		p.PN0p3 = float32(val)
-	}
-
-	if val, err := strconv.ParseFloat(splitStr[4], 32); err != nil {
-		return convErr
-	} else {
-		p.PN0p5 = float32(val)
-	}
-
-	if val, err := strconv.ParseFloat(splitStr[5], 32); err != nil {
-		return convErr
-	} else {
-		p.PN1 = float32(val)
-	}
-
-	if val, err := strconv.ParseFloat(splitStr[6], 32); err != nil {
-		return convErr
-	} else {
-		p.PN2p5 = float32(val)
-	}
-
-	if val, err := strconv.ParseFloat(splitStr[7], 32); err != nil {
-		return convErr
-	} else {
-		p.PN5 = float32(val)
-	}
-
-	if val, err := strconv.ParseFloat(splitStr[8], 32); err != nil {
-		return convErr
-	} else {
-		p.PN10 = float32(val)
+	for i, ptr := range p.PointerIterable() {
+		val, err := strconv.ParseFloat(strings.TrimSpace(splitStr[i]), 32)
+		if err != nil {
+			return fmt.Errorf("failed to convert a sps30 (float) data point to float32 from %v", splitStr)
+		}
+		*ptr.(*float32) = float32(val)
 	}
-
 	return nil
 }
 
@@ -139,15 +123,25 @@ func (p Sps30FloatMeasurement) DirectoryName() string {
 }
 func (m Sps30FloatMeasurement) DirectoryData() map[string]float32 {
 	return map[string]float32{
-		"pm1":   float32(m.PM1),
-		"pm2p5": float32(m.PM2p5),
-		"pm10":  float32(m.PM10),
-
-		"pn0p3": float32(m.PN0p3),
-		"pn0p5": float32(m.PN0p5),
-		"pn1":   float32(m.PN1),
-		"pn2p5": float32(m.PN2p5),
-		"pn5":   float32(m.PN5),
-		"pn10":  float32(m.PN10),
+		"pm1":   m.PM1,
+		"pm2p5": m.PM2p5,
+		"pm4":   m.PM4,
+		"pm10":  m.PM10,
+
+		"pn0p5": m.PN0p5,
+		"pn1":   m.PN1,
+		"pn2p5": m.PN2p5,
+		"pn4":   m.PN4,
+		"pn10":  m.PN10,
+
+		"typical_size": m.TypicalSize,
 	}
 }
+
+/*
+Merge two SPS30 (float) measurements with the legacy rules. See MergeSps30FloatWith() for other strategies.
+*/
+func MergeSps30Float(s1, s2, sResult *Sps30FloatMeasurement) error {
+	_, err := MergeSps30FloatWith(s1, s2, sResult, OpcMergeContext{}, LegacyOpcMerge{})
+	return err
+}
@@ -0,0 +1,293 @@
+package telosairduetcommon
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+/* ~~ Temperature & RH Fusion ~~ */
+
+const KEY_TEMP_RH_FUSION = "temp_rh_fusion"
+
+/*
+One temperature & humidity sensor on a sample. Name is the sensor's `DirectoryName()`, e.g. "htu21df".
+*/
+type TempRhSource struct {
+	Name    string
+	Reading TempRhMeasurement
+}
+
+/*
+Implemented by variants with more than one temperature & humidity sensor feeding a combined value.
+*/
+type TempRhFusionData interface {
+	DuetData
+	// Primary (the variant's reference sensor) first
+	TempRhSources() []TempRhSource
+	SensorStateBits() uint8
+	SetFusedTempRh(m CombinedTempRhMeasurements, strategy string)
+}
+
+type TempRhFusionStrategy interface {
+	// Recorded in the output as `temp_rh_fusion`
+	Name() string
+	// Returns false if no usable value could be produced, in which case the sample is left as decoded.
+	Fuse(sources []TempRhSource, sensorStates uint8) (CombinedTempRhMeasurements, bool)
+}
+
+/* ~~ Strategies ~~ */
+
+/*
+Plain mean of every sensor, as `CombineTempRhMeasurements` does.
+*/
+type MeanFusion struct{}
+
+func (MeanFusion) Name() string { return "mean" }
+
+func (MeanFusion) Fuse(sources []TempRhSource, _ uint8) (CombinedTempRhMeasurements, bool) {
+	return weightedTempRhMean(sources, nil, nil)
+}
+
+/*
+Use one sensor only. Falls back to the mean if the named sensor isn't on the sample; an empty Primary means the variant's primary.
+*/
+type PreferPrimaryFusion struct {
+	Primary string
+}
+
+func (PreferPrimaryFusion) Name() string { return "prefer_primary" }
+
+func (f PreferPrimaryFusion) Fuse(sources []TempRhSource, states uint8) (CombinedTempRhMeasurements, bool) {
+	if len(sources) == 0 {
+		return CombinedTempRhMeasurements{}, false
+	}
+	if f.Primary == "" {
+		return readingOf(sources[0]), true
+	}
+	for _, s := range sources {
+		if s.Name == f.Primary {
+			return readingOf(s), true
+		}
+	}
+	return MeanFusion{}.Fuse(sources, states)
+}
+
+type TempRhOffset struct {
+	Temp float32 `json:"temp"`
+	Hum  float32 `json:"hum"`
+}
+
+/*
+Weighted mean after subtracting a per-sensor offset, e.g. an SCD41 self-heated by the enclosure reading 2°C high.
+Sensors without a weight get 1.
+*/
+type WeightedOffsetFusion struct {
+	Offsets map[string]TempRhOffset
+	Weights map[string]float64
+}
+
+func (WeightedOffsetFusion) Name() string { return "weighted_offset" }
+
+func (f WeightedOffsetFusion) Fuse(sources []TempRhSource, _ uint8) (CombinedTempRhMeasurements, bool) {
+	return weightedTempRhMean(sources, f.Offsets, f.Weights)
+}
+
+/*
+Drop sensors whose fault bits are set in the sample's sensor states, then fuse the rest with Fallback (the mean if nil).
+Which bit belongs to which sensor depends on the firmware, so it is configured by sensor name. Without any bits it
+produces no value, as HealthierOpcMerge refuses to merge.
+*/
+type FaultAwareFusion struct {
+	FaultBits map[string]uint8
+	Fallback  TempRhFusionStrategy
+}
+
+func (FaultAwareFusion) Name() string { return "fault_aware" }
+
+func (f FaultAwareFusion) Validate() error {
+	for _, bit := range f.FaultBits {
+		if bit != 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", f.Name(), ErrFaultBitsUnset)
+}
+
+func (f FaultAwareFusion) Fuse(sources []TempRhSource, states uint8) (CombinedTempRhMeasurements, bool) {
+	if f.Validate() != nil {
+		return CombinedTempRhMeasurements{}, false
+	}
+	var healthy []TempRhSource
+	for _, s := range sources {
+		if states&f.FaultBits[s.Name] == 0 {
+			healthy = append(healthy, s)
+		}
+	}
+	var fallback TempRhFusionStrategy = MeanFusion{}
+	if f.Fallback != nil {
+		fallback = f.Fallback
+	}
+	return fallback.Fuse(healthy, states)
+}
+
+/*
+Reject physically implausible readings, then readings further than MaxTempDiff/MaxHumDiff from the median, and average the rest.
+With only two plausible sensors that disagree there is no majority, so the primary is used.
+*/
+type OutlierRejectFusion struct {
+	MaxTempDiff float32
+	MaxHumDiff  float32
+}
+
+func NewOutlierRejectFusion() OutlierRejectFusion {
+	return OutlierRejectFusion{MaxTempDiff: 2, MaxHumDiff: 10}
+}
+
+func (OutlierRejectFusion) Name() string { return "outlier_reject" }
+
+func (f OutlierRejectFusion) Fuse(sources []TempRhSource, states uint8) (CombinedTempRhMeasurements, bool) {
+	var plausible []TempRhSource
+	for _, s := range sources {
+		t, h := s.Reading.Temperature(), s.Reading.Humidity()
+		if t >= -40 && t <= 85 && h >= 0 && h <= 100 && !math.IsNaN(float64(t)) && !math.IsNaN(float64(h)) {
+			plausible = append(plausible, s)
+		}
+	}
+
+	switch len(plausible) {
+	case 0:
+		return CombinedTempRhMeasurements{}, false
+	case 1:
+		return readingOf(plausible[0]), true
+	case 2:
+		a, b := plausible[0].Reading, plausible[1].Reading
+		if f.disagree(a.Temperature()-b.Temperature(), a.Humidity()-b.Humidity()) {
+			return readingOf(plausible[0]), true
+		}
+		return MeanFusion{}.Fuse(plausible, states)
+	}
+
+	temps := make([]float64, len(plausible))
+	hums := make([]float64, len(plausible))
+	for i, s := range plausible {
+		temps[i] = float64(s.Reading.Temperature())
+		hums[i] = float64(s.Reading.Humidity())
+	}
+	medT, medH := float32(median(temps)), float32(median(hums))
+	var kept []TempRhSource
+	for _, s := range plausible {
+		if !f.disagree(s.Reading.Temperature()-medT, s.Reading.Humidity()-medH) {
+			kept = append(kept, s)
+		}
+	}
+	return MeanFusion{}.Fuse(kept, states)
+}
+
+func (f OutlierRejectFusion) disagree(dt, dh float32) bool {
+	return (f.MaxTempDiff > 0 && float32(math.Abs(float64(dt))) > f.MaxTempDiff) ||
+		(f.MaxHumDiff > 0 && float32(math.Abs(float64(dh))) > f.MaxHumDiff)
+}
+
+func readingOf(s TempRhSource) CombinedTempRhMeasurements {
+	return CombinedTempRhMeasurements{Temp: s.Reading.Temperature(), Hum: s.Reading.Humidity()}
+}
+
+func weightedTempRhMean(sources []TempRhSource, offsets map[string]TempRhOffset, weights map[string]float64) (CombinedTempRhMeasurements, bool) {
+	var t, h, wSum float64
+	for _, s := range sources {
+		w := 1.0
+		if v, ok := weights[s.Name]; ok {
+			w = v
+		}
+		if w <= 0 {
+			continue
+		}
+		off := offsets[s.Name]
+		t += w * float64(s.Reading.Temperature()-off.Temp)
+		h += w * float64(s.Reading.Humidity()-off.Hum)
+		wSum += w
+	}
+	if wSum == 0 {
+		return CombinedTempRhMeasurements{}, false
+	}
+	return CombinedTempRhMeasurements{Temp: float32(t / wSum), Hum: float32(h / wSum)}, true
+}
+
+/* ~~ Selection ~~ */
+
+/*
+Chooses a strategy per device serial, then per variant (`TypeAlias`, e.g. "Mk4.21"), then Default. Safe for concurrent use.
+*/
+type TempRhFusionSelector struct {
+	mu        sync.RWMutex
+	Default   TempRhFusionStrategy
+	byVariant map[string]TempRhFusionStrategy
+	byDevice  map[uint16]TempRhFusionStrategy
+}
+
+func NewTempRhFusionSelector(def TempRhFusionStrategy) *TempRhFusionSelector {
+	return &TempRhFusionSelector{
+		Default:   def,
+		byVariant: map[string]TempRhFusionStrategy{},
+		byDevice:  map[uint16]TempRhFusionStrategy{},
+	}
+}
+
+func (s *TempRhFusionSelector) SetForVariant(typeAlias string, strategy TempRhFusionStrategy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byVariant == nil {
+		s.byVariant = map[string]TempRhFusionStrategy{}
+	}
+	s.byVariant[typeAlias] = strategy
+}
+
+func (s *TempRhFusionSelector) SetForDevice(serialNumber uint16, strategy TempRhFusionStrategy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byDevice == nil {
+		s.byDevice = map[uint16]TempRhFusionStrategy{}
+	}
+	s.byDevice[serialNumber] = strategy
+}
+
+func (s *TempRhFusionSelector) For(d DuetData) TempRhFusionStrategy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if st, ok := s.byDevice[d.GetSerialNumber()]; ok {
+		return st
+	}
+	if st, ok := s.byVariant[d.GetTypeInfo().TypeAlias]; ok {
+		return st
+	}
+	return s.Default
+}
+
+/*
+Re-fuse the sample's combined temperature & humidity with the selected strategy.
+Returns false for variants without multiple sensors, if no strategy applies, or if the strategy produced no value.
+*/
+func (s *TempRhFusionSelector) Apply(d DuetData) bool {
+	st := s.For(d)
+	if st == nil {
+		return false
+	}
+	return FuseTempRh(d, st)
+}
+
+/*
+Re-fuse a sample's combined temperature & humidity with the given strategy, recording its name.
+*/
+func FuseTempRh(d DuetData, strategy TempRhFusionStrategy) bool {
+	fd, ok := d.(TempRhFusionData)
+	if !ok {
+		return false
+	}
+	m, ok := strategy.Fuse(fd.TempRhSources(), fd.SensorStateBits())
+	if !ok {
+		return false
+	}
+	fd.SetFusedTempRh(m, strategy.Name())
+	return true
+}
@@ -0,0 +1,172 @@
+package telosairduetcommon
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// HTU21 at 20°C/40%, SCD41 self-heated to 23°C/34%
+func fusionTestSample(states uint8) *DuetDataMk4Var7 {
+	return &DuetDataMk4Var7{
+		SerialNumber: 7,
+		SensorStates: states,
+		Htu:          Htu21Measurement{Temp: 20, Hum: 40},
+		Scd:          Scd41Measurement{Temp: 23, Hum: 34},
+	}
+}
+
+func checkFused(t *testing.T, name string, got CombinedTempRhMeasurements, ok bool, temp, hum float32) {
+	t.Helper()
+	if !ok || math.Abs(float64(got.Temp-temp)) > 1e-4 || math.Abs(float64(got.Hum-hum)) > 1e-4 {
+		t.Errorf("%s: got %+v, %v; want %.2f°C, %.2f%%", name, got, ok, temp, hum)
+	}
+}
+
+func TestTempRhFusionStrategies(t *testing.T) {
+	d := fusionTestSample(0)
+	sources := d.TempRhSources()
+	htu, scd := Htu21Measurement{}.DirectoryName(), Scd41Measurement{}.DirectoryName()
+
+	got, ok := MeanFusion{}.Fuse(sources, 0)
+	checkFused(t, "mean", got, ok, 21.5, 37)
+
+	got, ok = PreferPrimaryFusion{}.Fuse(sources, 0)
+	checkFused(t, "prefer primary", got, ok, 20, 40)
+	got, ok = PreferPrimaryFusion{Primary: scd}.Fuse(sources, 0)
+	checkFused(t, "prefer scd41", got, ok, 23, 34)
+	got, ok = PreferPrimaryFusion{Primary: "si7021"}.Fuse(sources, 0)
+	checkFused(t, "prefer a missing sensor", got, ok, 21.5, 37)
+
+	weighted := WeightedOffsetFusion{
+		Offsets: map[string]TempRhOffset{scd: {Temp: 2, Hum: -4}},
+		Weights: map[string]float64{htu: 3},
+	}
+	got, ok = weighted.Fuse(sources, 0)
+	checkFused(t, "weighted offset", got, ok, (3*20+21)/4.0, (3*40+38)/4.0)
+	zeroWeights := WeightedOffsetFusion{Weights: map[string]float64{htu: 0, scd: 0}}
+	if _, ok = zeroWeights.Fuse(sources, 0); ok {
+		t.Error("weighted offset: expected no value with every weight 0")
+	}
+
+	if _, ok = (MeanFusion{}).Fuse(nil, 0); ok {
+		t.Error("mean: expected no value without sources")
+	}
+}
+
+// Fault bits as one firmware might assign them; the package assumes no layout
+const (
+	testScdFaultBit uint8 = 1 << 2
+	testHtuFaultBit uint8 = 1 << 3
+)
+
+func fusionTestFaultBits() map[string]uint8 {
+	return map[string]uint8{
+		Htu21Measurement{}.DirectoryName():  testHtuFaultBit,
+		Scd41Measurement{}.DirectoryName():  testScdFaultBit,
+		Si7021Measurement{}.DirectoryName(): testHtuFaultBit,
+	}
+}
+
+func TestFaultAwareFusion(t *testing.T) {
+	f := FaultAwareFusion{FaultBits: fusionTestFaultBits()}
+	for _, td := range []struct {
+		states    uint8
+		temp, hum float32
+		ok        bool
+	}{
+		{0, 21.5, 37, true},
+		// Bits not configured for a sensor don't matter
+		{0x01 | 0x10, 21.5, 37, true},
+		{testScdFaultBit, 20, 40, true},
+		{testHtuFaultBit, 23, 34, true},
+		{testHtuFaultBit | testScdFaultBit, 0, 0, false},
+	} {
+		d := fusionTestSample(td.states)
+		got, ok := f.Fuse(d.TempRhSources(), d.SensorStateBits())
+		if !td.ok {
+			if ok {
+				t.Errorf("states %#x: expected no value, got %+v", td.states, got)
+			}
+			continue
+		}
+		checkFused(t, "fault aware", got, ok, td.temp, td.hum)
+	}
+
+	// Without any bits there is nothing to go on, so no value rather than a silent mean
+	for _, unset := range []FaultAwareFusion{{}, {FaultBits: map[string]uint8{Htu21Measurement{}.DirectoryName(): 0}}} {
+		if !errors.Is(unset.Validate(), ErrFaultBitsUnset) {
+			t.Errorf("%+v: expected ErrFaultBitsUnset", unset)
+		}
+		if _, ok := unset.Fuse(fusionTestSample(0).TempRhSources(), 0); ok {
+			t.Errorf("%+v: expected no value", unset)
+		}
+	}
+
+	// A sensor without a bit is never dropped, and a fallback fuses the healthy sensors
+	d := fusionTestSample(0x80 | testHtuFaultBit)
+	f = FaultAwareFusion{FaultBits: map[string]uint8{Scd41Measurement{}.DirectoryName(): 0x80}, Fallback: PreferPrimaryFusion{}}
+	got, ok := f.Fuse(d.TempRhSources(), d.SensorStateBits())
+	checkFused(t, "fault aware by name", got, ok, 20, 40)
+
+	// Mk1.3 carries an Si7021 and an SCD41
+	mk1 := &DuetDataMk1Var3{SensorStates: testHtuFaultBit, Si: Si7021Measurement{Temp: 18, Hum: 50}, Scd: Scd41Measurement{Temp: 22, Hum: 45}}
+	got, ok = FaultAwareFusion{FaultBits: fusionTestFaultBits()}.Fuse(mk1.TempRhSources(), mk1.SensorStateBits())
+	checkFused(t, "fault aware Mk1.3", got, ok, 22, 45)
+}
+
+func TestOutlierRejectFusion(t *testing.T) {
+	f := NewOutlierRejectFusion()
+	reading := func(name string, temp, hum float32) TempRhSource {
+		return TempRhSource{Name: name, Reading: Htu21Measurement{Temp: temp, Hum: hum}}
+	}
+	for _, td := range []struct {
+		name      string
+		sources   []TempRhSource
+		temp, hum float32
+	}{
+		{"agreeing pair", []TempRhSource{reading("a", 20, 40), reading("b", 21, 44)}, 20.5, 42},
+		{"disagreeing pair keeps the primary", []TempRhSource{reading("a", 20, 40), reading("b", 25, 40)}, 20, 40},
+		{"implausible reading dropped", []TempRhSource{reading("a", 20, 40), reading("b", 20, 140)}, 20, 40},
+		{"outlier from the median", []TempRhSource{reading("a", 20, 40), reading("b", 21, 42), reading("c", 30, 41)}, 20.5, 41},
+	} {
+		got, ok := f.Fuse(td.sources, 0)
+		checkFused(t, td.name, got, ok, td.temp, td.hum)
+	}
+	if _, ok := f.Fuse([]TempRhSource{reading("a", float32(math.NaN()), 40)}, 0); ok {
+		t.Error("expected no value from only a NaN reading")
+	}
+}
+
+func TestTempRhFusionSelector(t *testing.T) {
+	s := NewTempRhFusionSelector(MeanFusion{})
+	s.SetForVariant(DuetTypeMk4Var7.TypeAlias, PreferPrimaryFusion{})
+	s.SetForDevice(9, FaultAwareFusion{FaultBits: fusionTestFaultBits()})
+
+	if st := s.For(&DuetDataMk4Var16{SerialNumber: 7}); st.Name() != "mean" {
+		t.Errorf("expected the default for Mk4.16, got %s", st.Name())
+	}
+	if st := s.For(fusionTestSample(0)); st.Name() != "prefer_primary" {
+		t.Errorf("expected the Mk4.7 strategy, got %s", st.Name())
+	}
+	d := fusionTestSample(testHtuFaultBit)
+	d.SerialNumber = 9
+	if st := s.For(d); st.Name() != "fault_aware" {
+		t.Errorf("expected the device strategy, got %s", st.Name())
+	}
+
+	if !s.Apply(d) {
+		t.Fatal("expected the sample to be re-fused")
+	}
+	m := d.ToMap("")
+	if m[KEY_TEMP] != float32(23) || m[KEY_TEMP_RH_FUSION] != "fault_aware" {
+		t.Errorf("unexpected fused output: %v, %v", m[KEY_TEMP], m[KEY_TEMP_RH_FUSION])
+	}
+
+	if s.Apply(&DuetDataMk1Var0{}) {
+		t.Error("Mk1.0 has only one temperature sensor")
+	}
+	if NewTempRhFusionSelector(nil).Apply(fusionTestSample(0)) {
+		t.Error("expected no fusion without a strategy")
+	}
+}
@@ -0,0 +1,213 @@
+package telosairduetcommon
+
+import (
+	"math"
+	"sync"
+)
+
+/* ~~ TGS2611 Methane Conversion ~~ */
+
+const KEY_CH4_ESTIMATE = "ch4_est"
+
+/*
+Implemented by variants carrying Figaro TGS2611 metal-oxide methane sensors.
+*/
+type MethaneSensorData interface {
+	DuetData
+	Tgs2611Resistances() []float32
+	SetCh4Estimate(ppm float32)
+}
+
+/*
+Implemented by variants that also carry a Figaro TGS2600 next to their TGS2611. The TGS2600 barely responds to methane
+but strongly to hydrogen, ethanol and CO, which the TGS2611 also responds to, so it serves as an interference reference.
+*/
+type Tgs2600ReferenceData interface {
+	MethaneSensorData
+	Tgs2600Resistance() float32
+}
+
+// Baseline sensor index of the TGS2600 reference, for SetBaseline & Baseline
+const TGS2600_BASELINE_SENSOR = -1
+
+/*
+A TGS2600 below this fraction of its clean-air resistance means reducing gases other than methane are present. In the
+TGS2600 datasheet's sensitivity curves methane barely moves Rs/R0, while a few ppm of hydrogen or ethanol take it well
+below this. Tune per deployment.
+*/
+const DEFAULT_TGS2600_INTERFERENCE_RATIO = 0.6
+
+/*
+Power law relating the sensor's resistance ratio to methane concentration:
+
+	ppm = CleanAirPpm * (Rs/R0)^(1/Slope)
+
+with R0 the (compensated) resistance in clean air. Slope is the log-log slope of Rs/R0 against concentration, so negative.
+*/
+type TgsCurve struct {
+	CleanAirPpm float64
+	Slope       float64
+}
+
+// Approximate fit of the TGS2611 datasheet curve referenced to ambient methane. Fit per deployment where possible.
+var DefaultTgs2611Curve = TgsCurve{CleanAirPpm: 2.0, Slope: -0.35}
+
+/*
+Converts TGS2611 resistances to CH4 estimates, compensating for temperature & humidity and tracking
+per-sensor clean-air baselines (R0). Safe for concurrent use.
+*/
+type MethaneConverter struct {
+	Curve TgsCurve
+
+	// Fractional change in Rs per °C and per %RH away from the datasheet reference of 20°C, 65%RH.
+	TempCoeff, HumCoeff float64
+
+	// When set, R0 follows the clean-air resistance: it rises toward higher readings at BaselineRise per sample,
+	// and sinks toward lower readings at BaselineDecay per sample to follow long-term drift.
+	TrackBaseline               bool
+	BaselineRise, BaselineDecay float64
+
+	// No estimate is made while a TGS2600 reference reads below this fraction of its baseline. 0 disables the check.
+	InterferenceRatio float64
+
+	mu        sync.Mutex
+	baselines map[tgsBaselineKey]float64
+}
+
+type tgsBaselineKey struct {
+	serialNumber uint16
+	sensor       int
+}
+
+func NewMethaneConverter() *MethaneConverter {
+	return &MethaneConverter{
+		Curve:         DefaultTgs2611Curve,
+		TempCoeff:     -0.0075,
+		HumCoeff:      -0.0033,
+		TrackBaseline: true,
+		BaselineRise:  0.1,
+		BaselineDecay: 0.001,
+
+		InterferenceRatio: DEFAULT_TGS2600_INTERFERENCE_RATIO,
+	}
+}
+
+/*
+Set the clean-air resistance for one of a device's TGS2611 sensors (0 for the first), or its TGS2600 reference
+(TGS2600_BASELINE_SENSOR), e.g. from a colocation.
+*/
+func (c *MethaneConverter) SetBaseline(serialNumber uint16, sensor int, r0 float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.baselines == nil {
+		c.baselines = map[tgsBaselineKey]float64{}
+	}
+	c.baselines[tgsBaselineKey{serialNumber, sensor}] = r0
+}
+
+func (c *MethaneConverter) Baseline(serialNumber uint16, sensor int) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r0, ok := c.baselines[tgsBaselineKey{serialNumber, sensor}]
+	return r0, ok
+}
+
+/*
+Rs corrected to the datasheet reference conditions.
+*/
+func (c *MethaneConverter) compensate(rs, tempC, hum float64) float64 {
+	f := 1 + c.TempCoeff*(tempC-20) + c.HumCoeff*(hum-65)
+	if f <= 0 {
+		return rs
+	}
+	return rs / f
+}
+
+/*
+Move a sensor's baseline toward a compensated reading, or start it there. Returns the baseline and whether one exists.
+*/
+func (c *MethaneConverter) trackBaseline(k tgsBaselineKey, rsComp float64) (float64, bool) {
+	r0, ok := c.baselines[k]
+	if !c.TrackBaseline {
+		return r0, ok
+	}
+	switch {
+	case !ok:
+		r0 = rsComp
+	case rsComp > r0:
+		r0 += c.BaselineRise * (rsComp - r0)
+	default:
+		r0 += c.BaselineDecay * (rsComp - r0)
+	}
+	c.baselines[k] = r0
+	return r0, true
+}
+
+/*
+Estimate CH4 in ppm from every TGS2611 on the sample, averaged. Updates baselines if tracking is enabled.
+Returns false if the sample has no usable readings, no baseline could be established, or its TGS2600 reference shows
+interfering gases.
+*/
+func (c *MethaneConverter) Estimate(d MethaneSensorData) (float32, bool) {
+	tempC, hum := 20.0, 65.0
+	t, okT := SampleTemperature(d)
+	h, okH := SampleHumidity(d)
+	if okT && okH {
+		tempC, hum = float64(t), float64(h)
+	}
+	curve := c.Curve
+	if curve.Slope == 0 {
+		curve = DefaultTgs2611Curve
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.baselines == nil {
+		c.baselines = map[tgsBaselineKey]float64{}
+	}
+
+	interfered := false
+	if rd, ok := d.(Tgs2600ReferenceData); ok {
+		if rs := float64(rd.Tgs2600Resistance()); rs > 0 && !math.IsNaN(rs) {
+			rsComp := c.compensate(rs, tempC, hum)
+			r0, ok := c.trackBaseline(tgsBaselineKey{d.GetSerialNumber(), TGS2600_BASELINE_SENSOR}, rsComp)
+			interfered = ok && c.InterferenceRatio > 0 && rsComp < c.InterferenceRatio*r0
+		}
+	}
+
+	sum, n := 0.0, 0
+	for i, rs := range d.Tgs2611Resistances() {
+		if rs <= 0 || math.IsNaN(float64(rs)) {
+			continue
+		}
+		rsComp := c.compensate(float64(rs), tempC, hum)
+		r0, ok := c.trackBaseline(tgsBaselineKey{d.GetSerialNumber(), i}, rsComp)
+		if !ok {
+			continue
+		}
+
+		// Readings above the baseline are clean air
+		ratio := math.Min(rsComp/r0, 1)
+		sum += curve.CleanAirPpm * math.Pow(ratio, 1/curve.Slope)
+		n++
+	}
+	if n == 0 || interfered {
+		return 0, false
+	}
+	return float32(sum / float64(n)), true
+}
+
+/*
+Estimate CH4 for the sample and attach it, so `ToMap()` emits it. Returns false for variants without TGS2611 sensors.
+*/
+func (c *MethaneConverter) Apply(d DuetData) bool {
+	md, ok := d.(MethaneSensorData)
+	if !ok {
+		return false
+	}
+	ppm, ok := c.Estimate(md)
+	if ok {
+		md.SetCh4Estimate(ppm)
+	}
+	return ok
+}
@@ -0,0 +1,99 @@
+package telosairduetcommon
+
+import (
+	"math"
+	"testing"
+)
+
+func methaneTestSample(temp, hum, rs1, rs2 float32) *DuetDataMk4Var21 {
+	return &DuetDataMk4Var21{SerialNumber: 3, TempRh: CombinedTempRhMeasurements{Temp: temp, Hum: hum}, TGS2611_Rs1: rs1, TGS2611_Rs2: rs2}
+}
+
+func TestMethaneConverterCalibratedBaseline(t *testing.T) {
+	c := NewMethaneConverter()
+	c.TrackBaseline = false
+	if _, ok := c.Estimate(methaneTestSample(20, 65, 10_000, 10_000)); ok {
+		t.Error("expected no estimate without a baseline")
+	}
+
+	c.SetBaseline(3, 0, 10_000)
+	for _, td := range []struct {
+		temp, hum, rs float32
+		ppm           float64
+	}{
+		// At the reference conditions, clean air and half the clean-air resistance
+		{20, 65, 10_000, 2},
+		{20, 65, 5_000, 2 * math.Pow(0.5, 1/-0.35)},
+		// Above the baseline is still clean air
+		{20, 65, 12_000, 2},
+		// 10°C warmer reads 7.5% lower for the same gas, 30%RH wetter 9.9% lower
+		{30, 65, 9_250, 2},
+		{20, 95, 9_010, 2},
+		{30, 95, 4_000, 2 * math.Pow(4_000/(10_000*(1-0.075-0.099)), 1/-0.35)},
+	} {
+		// The second sensor has no baseline so is left out
+		ppm, ok := c.Estimate(methaneTestSample(td.temp, td.hum, td.rs, 5_000))
+		if !ok || math.Abs(float64(ppm)-td.ppm) > 1e-3*td.ppm {
+			t.Errorf("Estimate(%.0fC, %.0f%%, %.0f) = %f, %v; want %f", td.temp, td.hum, td.rs, ppm, ok, td.ppm)
+		}
+	}
+	if r0, _ := c.Baseline(3, 0); r0 != 10_000 {
+		t.Errorf("a fixed baseline moved to %f", r0)
+	}
+
+	for _, rs := range []float32{0, -1, float32(math.NaN())} {
+		if _, ok := c.Estimate(methaneTestSample(20, 65, rs, 0)); ok {
+			t.Errorf("expected no estimate for Rs %v", rs)
+		}
+	}
+}
+
+func TestMethaneConverterTracksBaseline(t *testing.T) {
+	c := NewMethaneConverter()
+	// The first reading becomes the baseline for both sensors
+	ppm, ok := c.Estimate(methaneTestSample(20, 65, 10_000, 20_000))
+	if !ok || ppm != 2 {
+		t.Fatalf("Estimate = %f, %v; want 2", ppm, ok)
+	}
+	if r0, _ := c.Baseline(3, 1); r0 != 20_000 {
+		t.Errorf("second baseline %f", r0)
+	}
+
+	// Rises quickly, sinks slowly
+	c.Estimate(methaneTestSample(20, 65, 20_000, 20_000))
+	if r0, _ := c.Baseline(3, 0); r0 != 11_000 {
+		t.Errorf("baseline rose to %f; want 11000", r0)
+	}
+	c.Estimate(methaneTestSample(20, 65, 1_000, 20_000))
+	if r0, _ := c.Baseline(3, 0); r0 != 10_990 {
+		t.Errorf("baseline sank to %f; want 10990", r0)
+	}
+
+	d := methaneTestSample(20, 65, 10_990, 20_000)
+	if !c.Apply(d) || d.ToMap("")[KEY_CH4_ESTIMATE] != float32(2) {
+		t.Errorf("expected Apply to attach 2 ppm: %v", d.ToMap("")[KEY_CH4_ESTIMATE])
+	}
+	if c.Apply(&DuetDataMk4Var7{}) {
+		t.Error("Mk4.7 has no TGS2611")
+	}
+}
+
+func TestMethaneConverterTgs2600Interference(t *testing.T) {
+	c := NewMethaneConverter()
+	c.TrackBaseline = false
+	c.SetBaseline(4, 0, 10_000)
+	c.SetBaseline(4, TGS2600_BASELINE_SENSOR, 50_000)
+
+	d := &DuetDataMk4Var10{SerialNumber: 4, TempRh: CombinedTempRhMeasurements{Temp: 20, Hum: 65}, Tgs2611_Rs: 5_000, Tgs2600_Rs: 45_000}
+	if _, ok := c.Estimate(d); !ok {
+		t.Error("expected an estimate with the TGS2600 near its baseline")
+	}
+	d.Tgs2600_Rs = 20_000
+	if _, ok := c.Estimate(d); ok {
+		t.Error("expected no estimate while the TGS2600 shows interfering gases")
+	}
+	c.InterferenceRatio = 0
+	if _, ok := c.Estimate(d); !ok {
+		t.Error("expected an estimate with the interference check disabled")
+	}
+}
@@ -1,5 +1,7 @@
 package telosairduetcommon
 
+import "sort"
+
 /* ~~ Keys & Constants ~~ */
 const (
 	KEY_HTU_TEMP        = "temp_htu"
@@ -41,10 +43,78 @@ const (
 	KEY_FS3000_VELOCITY = "flow_rate"
 
 	CONNECTION_TYPE_LORA_GATEWAY = 0
-	CONNECTION_TYPE_LORAWAN      = 1 // TODO: is this true? Unused I think now
+	CONNECTION_TYPE_LORAWAN      = 1 // Via a LoRaWAN network server (ChirpStack, TTN), see lorawan.go
 	CONNECTION_TYPE_USB_SERIAL   = 2
 )
 
+/* ~~ Reboot Detection ~~ */
+
+// How far LastResetUnix may wander (gateway clock jitter, radio latency) before we call it a reboot.
+const rebootResetSlackSec = 30
+
+/*
+Whether a sample's derived reset time has moved far enough past the previous one to mean the device restarted.
+*/
+func resetMovedForward(prevResetUnix, resetUnix uint32) bool {
+	return resetUnix > prevResetUnix+rebootResetSlackSec
+}
+
+/* ~~ Map Helpers ~~ */
+
+/*
+Read a numeric value out of a `ToMap()` result, whatever numeric type the variant stored it as.
+*/
+func mapFloat(m map[string]any, key string) (float64, bool) {
+	switch v := m[key].(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+/* ~~ Stats Helpers ~~ */
+
+/*
+Linearly interpolated percentile (0-100) of an already sorted slice.
+*/
+func percentileSorted(sorted []float64, p float64) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(n-1)
+	lo := int(rank)
+	if lo >= n-1 {
+		return sorted[n-1]
+	}
+	frac := rank - float64(lo)
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
+
+func median(vals []float64) float64 {
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+	return percentileSorted(sorted, 50)
+}
+
 // func validateConnectionType(t int) error {
 // 	switch t {
 // 	case CONNECTION_TYPE_LORA_GATEWAY, CONNECTION_TYPE_LORAWAN, CONNECTION_TYPE_USB_SERIAL: